@@ -3,26 +3,80 @@ package main
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/motevets/s83/pkg/springboard"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
 
 type configYaml struct {
-	Federates           []string
-	Port                uint
-	FQDN                string
-	PropagateWait       time.Duration `yaml:"propagate_wait"`
-	AdminBoard          string        `yaml:"admin_board"`
-	SQLDriver           string        `yaml:"sql_driver"`
-	SQLConnectionString string        `yaml:"sql_connection_string"`
+	Federates                 []string
+	PropagateTo               []string `yaml:"propagate_to"`
+	Port                      uint
+	FQDN                      string
+	PropagateWait             time.Duration `yaml:"propagate_wait"`
+	AdminBoard                string        `yaml:"admin_board"`
+	SQLDriver                 string        `yaml:"sql_driver"`
+	SQLConnectionString       string        `yaml:"sql_connection_string"`
+	Notice                    string
+	AllowFormPosts            bool          `yaml:"allow_form_posts"`
+	BoardTTL                  time.Duration `yaml:"board_ttl"`
+	PurgePolicy               string        `yaml:"purge_policy"`
+	CountViews                bool          `yaml:"count_views"`
+	StaticDir                 string        `yaml:"static_dir"`
+	ServeExpiredBoards        bool          `yaml:"serve_expired_boards"`
+	BootstrapBoard            string        `yaml:"bootstrap_board"`
+	BootstrapSignature        string        `yaml:"bootstrap_signature"`
+	AdminKeyPath              string        `yaml:"admin_key_path"`
+	AdminRefreshInterval      time.Duration `yaml:"admin_refresh_interval"`
+	PublishAllowCIDRs         []string      `yaml:"publish_allow_cidrs"`
+	EnableComposer            bool          `yaml:"enable_composer"`
+	PullInterval              time.Duration `yaml:"pull_interval"`
+	IndexPageSize             int           `yaml:"index_page_size"`
+	WrapBoardPages            bool          `yaml:"wrap_board_pages"`
+	LenientTimeTags           bool          `yaml:"lenient_time_tags"`
+	LogPropagation            bool          `yaml:"log_propagation"`
+	PropagationLogRetention   time.Duration `yaml:"propagation_log_retention"`
+	MaxConcurrentPropagations int           `yaml:"max_concurrent_propagations"`
+	MaxFederates              int           `yaml:"max_federates"`
+	RequestTimeout            time.Duration `yaml:"request_timeout"`
+	PinnedBoards              []string      `yaml:"pinned_boards"`
+	IndexOrder                string        `yaml:"index_order"`
+	RejectTagOnlyBoards       bool          `yaml:"reject_tag_only_boards"`
+	LogViaChain               bool          `yaml:"log_via_chain"`
+	AllowBoardConnections     bool          `yaml:"allow_board_connections"`
+	MaxHeaderBytes            int           `yaml:"max_header_bytes"`
+	ContentDenyPatterns       []string      `yaml:"content_deny_patterns"`
+	PropagationBacklogDepth   int           `yaml:"propagation_backlog_depth"`
+	PropagationBacklogAge     time.Duration `yaml:"propagation_backlog_age"`
+	PathPrefix                string        `yaml:"path_prefix"`
+	MinifyBoards              bool          `yaml:"minify_boards"`
+	ReplayOnStartup           bool          `yaml:"replay_on_startup"`
+	DataDir                   string        `yaml:"data_dir"`
+	MaxConcurrentReads        int           `yaml:"max_concurrent_reads"`
+	MaxConcurrentWrites       int           `yaml:"max_concurrent_writes"`
+	MaxExpiryHorizon          time.Duration `yaml:"max_expiry_horizon"`
+	Webhooks                  []string      `yaml:"webhooks"`
+	ReverifyInterval          time.Duration `yaml:"reverify_interval"`
+	ReverifyBatchSize         int           `yaml:"reverify_batch_size"`
+}
+
+// configFlags are settings given on serve's command line, which take
+// precedence over environment variables and the config file. Unset flags are
+// empty.
+type configFlags struct {
+	AdminBoard string
+	Federates  []string
+	FQDN       string
 }
 
 type Config struct {
-	yaml configYaml
+	yaml  configYaml
+	flags configFlags
 }
 
 func ConfigFromFile(path string) (config Config, err error) {
@@ -41,6 +95,9 @@ func ConfigFromFile(path string) (config Config, err error) {
 }
 
 func (config Config) Federates() []string {
+	if config.flags.Federates != nil {
+		return config.flags.Federates
+	}
 	fromEnv, inEnv := os.LookupEnv("SB_FEDERATES")
 	if inEnv {
 		return strings.Split(fromEnv, ",")
@@ -48,9 +105,18 @@ func (config Config) Federates() []string {
 	return config.yaml.Federates
 }
 
+// PropagateTo returns nil when unset, so the server pushes to every federate.
+func (config Config) PropagateTo() []string {
+	fromEnv, inEnv := os.LookupEnv("SB_PROPAGATE_TO")
+	if inEnv {
+		return strings.Split(fromEnv, ",")
+	}
+	return config.yaml.PropagateTo
+}
+
 func (config Config) Port() uint {
 	envPort, err := strconv.ParseUint(os.Getenv("PORT"), 10, 16)
-	if err != nil && envPort != 0 {
+	if err == nil && envPort != 0 {
 		return uint(envPort)
 	} else if config.yaml.Port != 0 {
 		return config.yaml.Port
@@ -60,6 +126,9 @@ func (config Config) Port() uint {
 }
 
 func (config Config) FQDN() string {
+	if config.flags.FQDN != "" {
+		return config.flags.FQDN
+	}
 	fromEnv, inEnv := os.LookupEnv("SB_FQDN")
 	if inEnv {
 		return fromEnv
@@ -68,7 +137,7 @@ func (config Config) FQDN() string {
 		return config.yaml.FQDN
 	}
 	hostname, err := os.Hostname()
-	if err != nil {
+	if err == nil {
 		return hostname
 	} else {
 		return "localhost"
@@ -92,6 +161,9 @@ func (config Config) PropagateWait() time.Duration {
 }
 
 func (config Config) AdminBoard() string {
+	if config.flags.AdminBoard != "" {
+		return config.flags.AdminBoard
+	}
 	fromEnv, inEnv := os.LookupEnv("SB_ADMIN_BOARD")
 	if inEnv {
 		return fromEnv
@@ -118,6 +190,629 @@ func (config Config) SQLConnectionString() string {
 	} else if config.yaml.SQLConnectionString != "" {
 		return config.yaml.SQLConnectionString
 	} else {
-		return "./spring83.db"
+		return filepath.Join(config.DataDir(), dbFileName)
+	}
+}
+
+// dbFileName is the name of the sqlite database in DataDir.
+const dbFileName = "spring83.db"
+
+func (config Config) Notice() string {
+	fromEnv, inEnv := os.LookupEnv("SB_NOTICE")
+	if inEnv {
+		return fromEnv
+	}
+	return config.yaml.Notice
+}
+
+func (config Config) AllowFormPosts() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_ALLOW_FORM_POSTS")
+	if inEnv {
+		allow, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return allow
+	}
+	return config.yaml.AllowFormPosts
+}
+
+func (config Config) BoardTTL() time.Duration {
+	fromEnv, inEnv := os.LookupEnv("SB_BOARD_TTL")
+	if inEnv {
+		duration, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return duration
+	}
+	if config.yaml.BoardTTL == 0 {
+		return springboard.DefaultBoardTTL
+	} else {
+		return config.yaml.BoardTTL
+	}
+}
+
+func (config Config) PurgePolicy() springboard.PurgePolicy {
+	name := config.yaml.PurgePolicy
+	if fromEnv, inEnv := os.LookupEnv("SB_PURGE_POLICY"); inEnv {
+		name = fromEnv
+	}
+	policy, err := springboard.ParsePurgePolicy(name)
+	if err != nil {
+		panic(err)
+	}
+	return policy
+}
+
+func (config Config) CountViews() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_COUNT_VIEWS")
+	if inEnv {
+		count, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return count
+	}
+	return config.yaml.CountViews
+}
+
+func (config Config) StaticDir() string {
+	fromEnv, inEnv := os.LookupEnv("SB_STATIC_DIR")
+	if inEnv {
+		return fromEnv
+	}
+	return config.yaml.StaticDir
+}
+
+func (config Config) ServeExpiredBoards() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_SERVE_EXPIRED_BOARDS")
+	if inEnv {
+		serve, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return serve
+	}
+	return config.yaml.ServeExpiredBoards
+}
+
+func (config Config) BootstrapBoard() string {
+	fromEnv, inEnv := os.LookupEnv("SB_BOOTSTRAP_BOARD")
+	if inEnv {
+		return fromEnv
+	}
+	return config.yaml.BootstrapBoard
+}
+
+func (config Config) BootstrapSignature() string {
+	fromEnv, inEnv := os.LookupEnv("SB_BOOTSTRAP_SIGNATURE")
+	if inEnv {
+		return fromEnv
+	}
+	return config.yaml.BootstrapSignature
+}
+
+func (config Config) AdminKeyPath() string {
+	fromEnv, inEnv := os.LookupEnv("SB_ADMIN_KEY_PATH")
+	if inEnv {
+		return fromEnv
+	}
+	return config.yaml.AdminKeyPath
+}
+
+func (config Config) AdminRefreshInterval() time.Duration {
+	fromEnv, inEnv := os.LookupEnv("SB_ADMIN_REFRESH_INTERVAL")
+	if inEnv {
+		duration, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return duration
+	}
+	if config.yaml.AdminRefreshInterval == 0 {
+		return springboard.DefaultAdminRefreshInterval
+	} else {
+		return config.yaml.AdminRefreshInterval
+	}
+}
+
+func (config Config) PublishAllowCIDRs() []string {
+	fromEnv, inEnv := os.LookupEnv("SB_PUBLISH_ALLOW_CIDRS")
+	if inEnv {
+		return strings.Split(fromEnv, ",")
+	}
+	return config.yaml.PublishAllowCIDRs
+}
+
+func (config Config) PublishGate() springboard.PublishGate {
+	cidrs := config.PublishAllowCIDRs()
+	if len(cidrs) == 0 {
+		return springboard.AllowAllGate{}
+	}
+	allowlist, err := springboard.NewCIDRAllowlist(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return allowlist
+}
+
+func (config Config) EnableComposer() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_ENABLE_COMPOSER")
+	if inEnv {
+		enable, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return enable
+	}
+	return config.yaml.EnableComposer
+}
+
+func (config Config) PullInterval() time.Duration {
+	fromEnv, inEnv := os.LookupEnv("SB_PULL_INTERVAL")
+	if inEnv {
+		duration, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return duration
+	}
+	return config.yaml.PullInterval
+}
+
+func (config Config) IndexPageSize() int {
+	fromEnv, inEnv := os.LookupEnv("SB_INDEX_PAGE_SIZE")
+	if inEnv {
+		size, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return size
+	}
+	if config.yaml.IndexPageSize == 0 {
+		return springboard.DefaultIndexPageSize
+	} else {
+		return config.yaml.IndexPageSize
+	}
+}
+
+func (config Config) WrapBoardPages() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_WRAP_BOARD_PAGES")
+	if inEnv {
+		wrap, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return wrap
+	}
+	return config.yaml.WrapBoardPages
+}
+
+func (config Config) LenientTimeTags() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_LENIENT_TIME_TAGS")
+	if inEnv {
+		lenient, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return lenient
+	}
+	return config.yaml.LenientTimeTags
+}
+
+func (config Config) LogPropagation() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_LOG_PROPAGATION")
+	if inEnv {
+		logPropagation, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return logPropagation
+	}
+	return config.yaml.LogPropagation
+}
+
+func (config Config) PropagationLogRetention() time.Duration {
+	fromEnv, inEnv := os.LookupEnv("SB_PROPAGATION_LOG_RETENTION")
+	if inEnv {
+		retention, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return retention
+	}
+	if config.yaml.PropagationLogRetention == 0 {
+		return springboard.DefaultPropagationLogRetention
+	} else {
+		return config.yaml.PropagationLogRetention
+	}
+}
+
+func (config Config) MaxConcurrentPropagations() int {
+	fromEnv, inEnv := os.LookupEnv("SB_MAX_CONCURRENT_PROPAGATIONS")
+	if inEnv {
+		limit, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return limit
+	}
+	if config.yaml.MaxConcurrentPropagations == 0 {
+		return springboard.DefaultMaxConcurrentPropagations
+	} else {
+		return config.yaml.MaxConcurrentPropagations
+	}
+}
+
+func (config Config) MaxFederates() int {
+	fromEnv, inEnv := os.LookupEnv("SB_MAX_FEDERATES")
+	if inEnv {
+		limit, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return limit
+	}
+	if config.yaml.MaxFederates == 0 {
+		return springboard.DefaultMaxFederates
+	} else {
+		return config.yaml.MaxFederates
+	}
+}
+
+func (config Config) RequestTimeout() time.Duration {
+	fromEnv, inEnv := os.LookupEnv("SB_REQUEST_TIMEOUT")
+	if inEnv {
+		timeout, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return timeout
+	}
+	if config.yaml.RequestTimeout == 0 {
+		return springboard.DefaultRequestTimeout
+	} else {
+		return config.yaml.RequestTimeout
+	}
+}
+
+func (config Config) PinnedBoards() []string {
+	fromEnv, inEnv := os.LookupEnv("SB_PINNED_BOARDS")
+	if inEnv {
+		return strings.Split(fromEnv, ",")
+	}
+	return config.yaml.PinnedBoards
+}
+
+func (config Config) IndexOrder() springboard.IndexOrder {
+	name := config.yaml.IndexOrder
+	if fromEnv, inEnv := os.LookupEnv("SB_INDEX_ORDER"); inEnv {
+		name = fromEnv
+	}
+	order, err := springboard.ParseIndexOrder(name)
+	if err != nil {
+		panic(err)
+	}
+	return order
+}
+
+func (config Config) RejectTagOnlyBoards() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_REJECT_TAG_ONLY_BOARDS")
+	if inEnv {
+		reject, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return reject
+	}
+	return config.yaml.RejectTagOnlyBoards
+}
+
+func (config Config) LogViaChain() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_LOG_VIA_CHAIN")
+	if inEnv {
+		logChain, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return logChain
+	}
+	return config.yaml.LogViaChain
+}
+
+func (config Config) AllowBoardConnections() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_ALLOW_BOARD_CONNECTIONS")
+	if inEnv {
+		allow, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return allow
+	}
+	return config.yaml.AllowBoardConnections
+}
+
+func (config Config) MaxHeaderBytes() int {
+	fromEnv, inEnv := os.LookupEnv("SB_MAX_HEADER_BYTES")
+	if inEnv {
+		limit, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return limit
+	}
+	if config.yaml.MaxHeaderBytes == 0 {
+		return springboard.DefaultMaxHeaderBytes
+	} else {
+		return config.yaml.MaxHeaderBytes
+	}
+}
+
+// ContentDenyPatterns are newline separated in SB_CONTENT_DENY_PATTERNS, since
+// regular expressions may contain commas.
+func (config Config) ContentDenyPatterns() []string {
+	fromEnv, inEnv := os.LookupEnv("SB_CONTENT_DENY_PATTERNS")
+	if inEnv {
+		return strings.Split(strings.TrimSpace(fromEnv), "\n")
+	}
+	return config.yaml.ContentDenyPatterns
+}
+
+func (config Config) PropagationBacklogDepth() int {
+	fromEnv, inEnv := os.LookupEnv("SB_PROPAGATION_BACKLOG_DEPTH")
+	if inEnv {
+		depth, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return depth
+	}
+	if config.yaml.PropagationBacklogDepth == 0 {
+		return springboard.DefaultPropagationBacklogDepth
+	} else {
+		return config.yaml.PropagationBacklogDepth
+	}
+}
+
+func (config Config) PropagationBacklogAge() time.Duration {
+	fromEnv, inEnv := os.LookupEnv("SB_PROPAGATION_BACKLOG_AGE")
+	if inEnv {
+		age, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return age
+	}
+	if config.yaml.PropagationBacklogAge == 0 {
+		return springboard.DefaultPropagationBacklogAge
+	} else {
+		return config.yaml.PropagationBacklogAge
+	}
+}
+
+func (config Config) PathPrefix() string {
+	fromEnv, inEnv := os.LookupEnv("SB_PATH_PREFIX")
+	if inEnv {
+		return fromEnv
+	}
+	return config.yaml.PathPrefix
+}
+
+func (config Config) MinifyBoards() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_MINIFY_BOARDS")
+	if inEnv {
+		minify, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return minify
+	}
+	return config.yaml.MinifyBoards
+}
+
+func (config Config) ReplayOnStartup() bool {
+	fromEnv, inEnv := os.LookupEnv("SB_REPLAY_ON_STARTUP")
+	if inEnv {
+		replay, err := strconv.ParseBool(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return replay
+	}
+	return config.yaml.ReplayOnStartup
+}
+
+// DataDir is where the server keeps its sqlite database by default:
+// $XDG_DATA_HOME/springboard, or ~/.local/share/springboard. Servers set up
+// before it existed keep their ./spring83.db until data_dir is set.
+func (config Config) DataDir() string {
+	fromEnv, inEnv := os.LookupEnv("SB_DATA_DIR")
+	if inEnv {
+		return fromEnv
+	}
+	if config.yaml.DataDir != "" {
+		return config.yaml.DataDir
+	}
+	if _, err := os.Stat(dbFileName); err == nil {
+		return "."
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "."
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "springboard")
+}
+
+func (config Config) MaxConcurrentReads() int {
+	fromEnv, inEnv := os.LookupEnv("SB_MAX_CONCURRENT_READS")
+	if inEnv {
+		limit, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return limit
+	}
+	return config.yaml.MaxConcurrentReads
+}
+
+func (config Config) MaxConcurrentWrites() int {
+	fromEnv, inEnv := os.LookupEnv("SB_MAX_CONCURRENT_WRITES")
+	if inEnv {
+		limit, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return limit
+	}
+	return config.yaml.MaxConcurrentWrites
+}
+
+func (config Config) MaxExpiryHorizon() time.Duration {
+	fromEnv, inEnv := os.LookupEnv("SB_MAX_EXPIRY_HORIZON")
+	if inEnv {
+		horizon, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return horizon
+	}
+	if config.yaml.MaxExpiryHorizon == 0 {
+		return springboard.DefaultMaxExpiryHorizon
+	} else {
+		return config.yaml.MaxExpiryHorizon
+	}
+}
+
+func (config Config) Webhooks() []string {
+	fromEnv, inEnv := os.LookupEnv("SB_WEBHOOKS")
+	if inEnv {
+		return strings.Split(fromEnv, ",")
+	}
+	return config.yaml.Webhooks
+}
+
+func (config Config) ReverifyInterval() time.Duration {
+	fromEnv, inEnv := os.LookupEnv("SB_REVERIFY_INTERVAL")
+	if inEnv {
+		interval, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return interval
+	}
+	return config.yaml.ReverifyInterval
+}
+
+func (config Config) ReverifyBatchSize() int {
+	fromEnv, inEnv := os.LookupEnv("SB_REVERIFY_BATCH_SIZE")
+	if inEnv {
+		size, err := strconv.Atoi(fromEnv)
+		if err != nil {
+			panic(err)
+		}
+		return size
+	}
+	if config.yaml.ReverifyBatchSize == 0 {
+		return springboard.DefaultReverifyBatchSize
+	} else {
+		return config.yaml.ReverifyBatchSize
+	}
+}
+
+// ConfigSetting is a setting's effective value and where it came from: "flag",
+// "env", "yaml", or "default".
+type ConfigSetting struct {
+	Name   string
+	Value  any
+	Source string
+}
+
+// Settings lists the effective value of every setting, in the order they're
+// documented in the README.
+func (config Config) Settings() []ConfigSetting {
+	fromYaml := config.yaml
+	setting := func(name string, envVar string, inYaml bool, value any) ConfigSetting {
+		source := "default"
+		if config.flagged(name) {
+			source = "flag"
+		} else if _, inEnv := os.LookupEnv(envVar); inEnv {
+			source = "env"
+		} else if inYaml {
+			source = "yaml"
+		}
+		return ConfigSetting{Name: name, Value: value, Source: source}
+	}
+	portEnvVar := "PORT"
+	if envPort, err := strconv.ParseUint(os.Getenv("PORT"), 10, 16); err != nil || envPort == 0 {
+		portEnvVar = "" // Port ignores a PORT that isn't a valid port number
+	}
+	return []ConfigSetting{
+		setting("port", portEnvVar, fromYaml.Port != 0, config.Port()),
+		setting("federates", "SB_FEDERATES", fromYaml.Federates != nil, config.Federates()),
+		setting("propagate_to", "SB_PROPAGATE_TO", fromYaml.PropagateTo != nil, config.PropagateTo()),
+		setting("fqdn", "SB_FQDN", fromYaml.FQDN != "", config.FQDN()),
+		setting("propagate_wait", "SB_PROPAGATE_WAIT", fromYaml.PropagateWait != 0, config.PropagateWait()),
+		setting("admin_board", "SB_ADMIN_BOARD", fromYaml.AdminBoard != "", config.AdminBoard()),
+		setting("sql_driver", "SB_SQL_DRIVER", fromYaml.SQLDriver != "", config.SQLDriver()),
+		setting("sql_connection_string", "SB_SQL_CONNECTION_STRING", fromYaml.SQLConnectionString != "", config.SQLConnectionString()),
+		setting("notice", "SB_NOTICE", fromYaml.Notice != "", config.Notice()),
+		setting("allow_form_posts", "SB_ALLOW_FORM_POSTS", fromYaml.AllowFormPosts, config.AllowFormPosts()),
+		setting("board_ttl", "SB_BOARD_TTL", fromYaml.BoardTTL != 0, config.BoardTTL()),
+		setting("purge_policy", "SB_PURGE_POLICY", fromYaml.PurgePolicy != "", config.PurgePolicy()),
+		setting("count_views", "SB_COUNT_VIEWS", fromYaml.CountViews, config.CountViews()),
+		setting("static_dir", "SB_STATIC_DIR", fromYaml.StaticDir != "", config.StaticDir()),
+		setting("serve_expired_boards", "SB_SERVE_EXPIRED_BOARDS", fromYaml.ServeExpiredBoards, config.ServeExpiredBoards()),
+		setting("bootstrap_board", "SB_BOOTSTRAP_BOARD", fromYaml.BootstrapBoard != "", config.BootstrapBoard()),
+		setting("bootstrap_signature", "SB_BOOTSTRAP_SIGNATURE", fromYaml.BootstrapSignature != "", config.BootstrapSignature()),
+		setting("admin_key_path", "SB_ADMIN_KEY_PATH", fromYaml.AdminKeyPath != "", config.AdminKeyPath()),
+		setting("admin_refresh_interval", "SB_ADMIN_REFRESH_INTERVAL", fromYaml.AdminRefreshInterval != 0, config.AdminRefreshInterval()),
+		setting("publish_allow_cidrs", "SB_PUBLISH_ALLOW_CIDRS", fromYaml.PublishAllowCIDRs != nil, config.PublishAllowCIDRs()),
+		setting("enable_composer", "SB_ENABLE_COMPOSER", fromYaml.EnableComposer, config.EnableComposer()),
+		setting("pull_interval", "SB_PULL_INTERVAL", fromYaml.PullInterval != 0, config.PullInterval()),
+		setting("index_page_size", "SB_INDEX_PAGE_SIZE", fromYaml.IndexPageSize != 0, config.IndexPageSize()),
+		setting("wrap_board_pages", "SB_WRAP_BOARD_PAGES", fromYaml.WrapBoardPages, config.WrapBoardPages()),
+		setting("lenient_time_tags", "SB_LENIENT_TIME_TAGS", fromYaml.LenientTimeTags, config.LenientTimeTags()),
+		setting("log_propagation", "SB_LOG_PROPAGATION", fromYaml.LogPropagation, config.LogPropagation()),
+		setting("propagation_log_retention", "SB_PROPAGATION_LOG_RETENTION", fromYaml.PropagationLogRetention != 0, config.PropagationLogRetention()),
+		setting("max_concurrent_propagations", "SB_MAX_CONCURRENT_PROPAGATIONS", fromYaml.MaxConcurrentPropagations != 0, config.MaxConcurrentPropagations()),
+		setting("max_federates", "SB_MAX_FEDERATES", fromYaml.MaxFederates != 0, config.MaxFederates()),
+		setting("request_timeout", "SB_REQUEST_TIMEOUT", fromYaml.RequestTimeout != 0, config.RequestTimeout()),
+		setting("pinned_boards", "SB_PINNED_BOARDS", fromYaml.PinnedBoards != nil, config.PinnedBoards()),
+		setting("index_order", "SB_INDEX_ORDER", fromYaml.IndexOrder != "", config.IndexOrder()),
+		setting("reject_tag_only_boards", "SB_REJECT_TAG_ONLY_BOARDS", fromYaml.RejectTagOnlyBoards, config.RejectTagOnlyBoards()),
+		setting("log_via_chain", "SB_LOG_VIA_CHAIN", fromYaml.LogViaChain, config.LogViaChain()),
+		setting("allow_board_connections", "SB_ALLOW_BOARD_CONNECTIONS", fromYaml.AllowBoardConnections, config.AllowBoardConnections()),
+		setting("max_header_bytes", "SB_MAX_HEADER_BYTES", fromYaml.MaxHeaderBytes != 0, config.MaxHeaderBytes()),
+		setting("content_deny_patterns", "SB_CONTENT_DENY_PATTERNS", fromYaml.ContentDenyPatterns != nil, config.ContentDenyPatterns()),
+		setting("propagation_backlog_depth", "SB_PROPAGATION_BACKLOG_DEPTH", fromYaml.PropagationBacklogDepth != 0, config.PropagationBacklogDepth()),
+		setting("propagation_backlog_age", "SB_PROPAGATION_BACKLOG_AGE", fromYaml.PropagationBacklogAge != 0, config.PropagationBacklogAge()),
+		setting("path_prefix", "SB_PATH_PREFIX", fromYaml.PathPrefix != "", config.PathPrefix()),
+		setting("minify_boards", "SB_MINIFY_BOARDS", fromYaml.MinifyBoards, config.MinifyBoards()),
+		setting("replay_on_startup", "SB_REPLAY_ON_STARTUP", fromYaml.ReplayOnStartup, config.ReplayOnStartup()),
+		setting("data_dir", "SB_DATA_DIR", fromYaml.DataDir != "", config.DataDir()),
+		setting("max_concurrent_reads", "SB_MAX_CONCURRENT_READS", fromYaml.MaxConcurrentReads != 0, config.MaxConcurrentReads()),
+		setting("max_concurrent_writes", "SB_MAX_CONCURRENT_WRITES", fromYaml.MaxConcurrentWrites != 0, config.MaxConcurrentWrites()),
+		setting("max_expiry_horizon", "SB_MAX_EXPIRY_HORIZON", fromYaml.MaxExpiryHorizon != 0, config.MaxExpiryHorizon()),
+		setting("webhooks", "SB_WEBHOOKS", fromYaml.Webhooks != nil, config.Webhooks()),
+		setting("reverify_interval", "SB_REVERIFY_INTERVAL", fromYaml.ReverifyInterval != 0, config.ReverifyInterval()),
+		setting("reverify_batch_size", "SB_REVERIFY_BATCH_SIZE", fromYaml.ReverifyBatchSize != 0, config.ReverifyBatchSize()),
+	}
+}
+
+// flagged reports whether a setting was given as a flag.
+func (config Config) flagged(name string) bool {
+	switch name {
+	case "admin_board":
+		return config.flags.AdminBoard != ""
+	case "federates":
+		return config.flags.Federates != nil
+	case "fqdn":
+		return config.flags.FQDN != ""
 	}
+	return false
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/motevets/s83/pkg/springboard"
+)
+
+// configFromYaml writes yaml to a config file and loads it.
+func configFromYaml(t *testing.T, yaml string) Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "springboard.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+// settingsByName indexes a config's effective settings by name.
+func settingsByName(config Config) map[string]ConfigSetting {
+	settings := map[string]ConfigSetting{}
+	for _, setting := range config.Settings() {
+		settings[setting.Name] = setting
+	}
+	return settings
+}
+
+func TestSettingsReportEnvOverrides(t *testing.T) {
+	config := configFromYaml(t, "fqdn: yaml.example\npropagate_wait: 1m\nport: 9000\n")
+	t.Setenv("SB_FQDN", "env.example")
+	t.Setenv("PORT", "9100")
+
+	settings := settingsByName(config)
+	for _, want := range []ConfigSetting{
+		{Name: "fqdn", Value: "env.example", Source: "env"},
+		{Name: "port", Value: uint(9100), Source: "env"},
+		{Name: "propagate_wait", Value: time.Minute, Source: "yaml"},
+		{Name: "board_ttl", Value: springboard.DefaultBoardTTL, Source: "default"},
+	} {
+		if got := settings[want.Name]; got != want {
+			t.Errorf("Setting %s is %+v, want %+v", want.Name, got, want)
+		}
+	}
+}
+
+func TestServeFlagsOverrideEnvAndYaml(t *testing.T) {
+	config := configFromYaml(t, "fqdn: yaml.example\nadmin_board: yamlkey\nfederates:\n  - https://yaml.example\n")
+	t.Setenv("SB_FQDN", "env.example")
+	t.Setenv("SB_ADMIN_BOARD", "envkey")
+	t.Setenv("SB_FEDERATES", "https://env.example")
+
+	// Without flags, the environment wins over the file.
+	if config.FQDN() != "env.example" || config.AdminBoard() != "envkey" || len(config.Federates()) != 1 || config.Federates()[0] != "https://env.example" {
+		t.Errorf("Without flags, got %s, %s and %v, want the environment's values", config.FQDN(), config.AdminBoard(), config.Federates())
+	}
+
+	config.flags = configFlags{
+		AdminBoard: "flagkey",
+		Federates:  []string{"https://one.example", "https://two.example"},
+		FQDN:       "flag.example",
+	}
+	serverConfig := buildServerConfig(config, false)
+	if serverConfig.FQDN != "flag.example" || serverConfig.AdminBoard != "flagkey" {
+		t.Errorf("Server runs as %s with admin board %s, want the flags' values", serverConfig.FQDN, serverConfig.AdminBoard)
+	}
+	if len(serverConfig.Federates) != 2 || serverConfig.Federates[1] != "https://two.example" {
+		t.Errorf("Server federates with %v, want every --federate", serverConfig.Federates)
+	}
+	settings := settingsByName(config)
+	for _, name := range []string{"fqdn", "admin_board", "federates"} {
+		if source := settings[name].Source; source != "flag" {
+			t.Errorf("Setting %s comes from %q, want flag", name, source)
+		}
+	}
+
+	// Flags that aren't given leave the other sources alone.
+	config.flags = configFlags{FQDN: "flag.example"}
+	if config.AdminBoard() != "envkey" || settingsByName(config)["admin_board"].Source != "env" {
+		t.Errorf("Admin board is %s without --admin-board, want the environment's", config.AdminBoard())
+	}
+}
+
+func TestDatabaseIsCreatedInDataDir(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "not", "yet", "there")
+	config := configFromYaml(t, "data_dir: "+dataDir+"\n")
+	if got := config.SQLConnectionString(); got != filepath.Join(dataDir, dbFileName) {
+		t.Errorf("Database is at %s, want it in the data dir", got)
+	}
+	if err := createDatabaseDir(config); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := make(chan error, 1)
+	go func() { stopped <- springboard.RunServerWithListener(listener, buildServerConfig(config, false)) }()
+	defer func() {
+		listener.Close()
+		<-stopped
+	}()
+	resp, err := http.Get("http://" + listener.Addr().String() + "/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if _, err := os.Stat(filepath.Join(dataDir, dbFileName)); err != nil {
+		t.Errorf("Database wasn't created in the data dir: %s", err)
+	}
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/motevets/s83/pkg/springboard"
 )
@@ -18,10 +26,30 @@ func main() {
 	switch os.Args[1] {
 	case "post":
 		err = post()
+	case "unpublish":
+		err = unpublish()
+	case "watch":
+		err = watch()
+	case "check":
+		err = check()
 	case "serve":
-		serve()
+		err = serve()
+	case "config":
+		err = showConfig()
+	case "diff":
+		err = diff()
+	case "events":
+		err = events()
+	case "sign":
+		err = sign()
+	case "verify-sig":
+		err = verifySig()
 	case "generate-key":
 		err = generateKey()
+	case "key-info":
+		err = keyInfo()
+	case "estimate-key":
+		err = estimateKey()
 	case "help":
 		help()
 	default:
@@ -42,10 +70,30 @@ func help() {
 	switch os.Args[2] {
 	case "post":
 		printPostHelp()
+	case "unpublish":
+		printUnpublishHelp()
+	case "watch":
+		printWatchHelp()
+	case "check":
+		printCheckHelp()
 	case "serve":
 		printServeHelp()
+	case "config":
+		printConfigHelp()
+	case "diff":
+		printDiffHelp()
+	case "events":
+		printEventsHelp()
+	case "sign":
+		printSignHelp()
+	case "verify-sig":
+		printVerifySigHelp()
 	case "generate-key":
 		printGenerateKeyHelp()
+	case "key-info":
+		printKeyInfoHelp()
+	case "estimate-key":
+		printEstimateKeyHelp()
 	case "help":
 		printRootHelp()
 	default:
@@ -56,21 +104,243 @@ func help() {
 }
 
 func generateKey() (err error) {
-	if len(os.Args) > 2 && (os.Args[2] == "-h" || os.Args[2] == "--help") {
-		printGenerateKeyHelp()
+	flags := flag.NewFlagSet("generate-key", flag.ContinueOnError)
+	flags.Usage = printGenerateKeyHelp
+	count := flags.Int("count", 1, "")
+	printKey := flags.Bool("print-key", false, "")
+	vanity := flags.String("vanity", "", "")
+	asJSON := flags.Bool("json", false, "")
+	args, err := parseFlags(flags, os.Args[2:])
+	if err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return
+	}
+	if *printKey && *asJSON {
+		return fmt.Errorf("--print-key and --json cannot be used together")
+	}
+	var keyPairDir string
+	if len(args) > 0 {
+		keyPairDir = args[0]
+	}
+	keys, err := springboard.GenerateVanityKeyBatch(keyPairDir, *vanity, *count, os.Stderr)
+	if err != nil {
+		return
+	}
+	return printGeneratedKeys(os.Stdout, keys, *printKey, *asJSON)
+}
+
+// printGeneratedKeys writes the keys generate-key found to out: as JSON, as
+// nothing but their public keys with printKey, or described in a sentence.
+func printGeneratedKeys(out io.Writer, keys []springboard.KeyInfo, printKey bool, asJSON bool) (err error) {
+	for _, key := range keys {
+		if asJSON {
+			err = printKeyInfoJSON(out, key)
+		} else if printKey {
+			_, err = fmt.Fprintln(out, key.PublicKey)
+		} else {
+			_, err = fmt.Fprintf(out, "Generated key %s\n", key.PublicKey)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func keyInfo() (err error) {
+	flags := flag.NewFlagSet("key-info", flag.ContinueOnError)
+	flags.Usage = printKeyInfoHelp
+	asJSON := flags.Bool("json", false, "")
+	args, err := parseFlags(flags, os.Args[2:])
+	if err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
 		return
 	}
 	var keyPairDir string
+	if len(args) > 0 {
+		keyPairDir = args[0]
+	}
+	key, err := springboard.GetKeyInfo(keyPairDir)
+	if err != nil {
+		return
+	}
+	if *asJSON {
+		return printKeyInfoJSON(os.Stdout, key)
+	}
+	fmt.Printf("Public key:       %s\n", key.PublicKey)
+	fmt.Printf("Public key file:  %s\n", key.PublicKeyPath)
+	fmt.Printf("Private key file: %s\n", key.PrivateKeyPath)
+	if key.Expiry != nil {
+		fmt.Printf("Expires:          %s\n", key.Expiry.Format("2006-01-02"))
+	} else {
+		fmt.Println("Expires:          (not a valid Spring '83 key: it doesn't end in 83eMMYY)")
+	}
+	return
+}
+
+// printKeyInfoJSON writes a key pair's description to out as one line of
+// JSON.
+func printKeyInfoJSON(out io.Writer, key springboard.KeyInfo) error {
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(encoded))
+	return err
+}
+
+func estimateKey() (err error) {
+	if len(os.Args) > 2 && (os.Args[2] == "-h" || os.Args[2] == "--help") {
+		printEstimateKeyHelp()
+		return
+	}
+	duration := 5 * time.Second
 	if len(os.Args) > 2 {
-		keyPairDir = os.Args[2]
+		duration, err = time.ParseDuration(os.Args[2])
+		if err != nil {
+			return
+		}
+		if duration <= 0 {
+			return fmt.Errorf("Duration must be positive")
+		}
 	}
-	err = springboard.GenerateValidKeys(keyPairDir)
+
+	workers := springboard.KeyWorkers()
+	fmt.Printf("Generating keys on %d cores for %s...\n", workers, duration)
+	rate := springboard.MeasureKeyRate(duration, workers)
+	average, ninetieth := springboard.EstimateKeySearch(rate)
+	fmt.Printf(" - %.0f keys/second\n", rate)
+	fmt.Printf(" - generate-key will take about %s on average\n", average.Round(time.Second))
+	fmt.Printf(" - 90%% of searches finish within %s\n", ninetieth.Round(time.Second))
 	return
 }
 
 func serve() (err error) {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.Usage = printServeHelp
+	noDifficulty := flags.Bool("no-difficulty", false, "")
+	var overrides configFlags
+	flags.StringVar(&overrides.AdminBoard, "admin-board", "", "")
+	flags.Func("federate", "", func(federate string) error {
+		overrides.Federates = append(overrides.Federates, federate)
+		return nil
+	})
+	flags.StringVar(&overrides.FQDN, "fqdn", "", "")
+	args, err := parseFlags(flags, os.Args[2:])
+	if err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return
+	}
+
+	var config Config
+	if len(args) > 0 {
+		config, err = ConfigFromFile(args[0])
+		if err != nil {
+			return
+		}
+	}
+	config.flags = overrides
+	if err = createDatabaseDir(config); err != nil {
+		return
+	}
+
+	serverConfig := buildServerConfig(config, *noDifficulty)
+	serverConfig.ReloadConfig = func() (reloaded springboard.ServerConfig, err error) {
+		// Config accessors panic on invalid values, which mustn't bring the
+		// running server down.
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("%v", recovered)
+			}
+		}()
+		var config Config
+		if len(args) > 0 {
+			config, err = ConfigFromFile(args[0])
+			if err != nil {
+				return
+			}
+		}
+		config.flags = overrides
+		return buildServerConfig(config, *noDifficulty), nil
+	}
+	err = springboard.RunServer(serverConfig)
+	return
+}
+
+// buildServerConfig is the configuration serve runs the server with.
+func buildServerConfig(config Config, noDifficulty bool) springboard.ServerConfig {
+	return springboard.ServerConfig{
+		Port:                      config.Port(),
+		Federates:                 config.Federates(),
+		PropagateTo:               config.PropagateTo(),
+		AdminBoard:                config.AdminBoard(),
+		FQDN:                      config.FQDN(),
+		PropagateWait:             config.PropagateWait(),
+		SQLDriver:                 config.SQLDriver(),
+		SQLConnectionString:       config.SQLConnectionString(),
+		Notice:                    config.Notice(),
+		AllowFormPosts:            config.AllowFormPosts(),
+		BoardTTL:                  config.BoardTTL(),
+		PurgePolicy:               config.PurgePolicy(),
+		CountViews:                config.CountViews(),
+		StaticDir:                 config.StaticDir(),
+		ServeExpiredBoards:        config.ServeExpiredBoards(),
+		BootstrapBoard:            config.BootstrapBoard(),
+		BootstrapSignature:        config.BootstrapSignature(),
+		AdminKeyPath:              config.AdminKeyPath(),
+		AdminRefreshInterval:      config.AdminRefreshInterval(),
+		PublishGate:               config.PublishGate(),
+		EnableComposer:            config.EnableComposer(),
+		PullInterval:              config.PullInterval(),
+		NoDifficulty:              noDifficulty,
+		IndexPageSize:             config.IndexPageSize(),
+		WrapBoardPages:            config.WrapBoardPages(),
+		LenientTimeTags:           config.LenientTimeTags(),
+		LogPropagation:            config.LogPropagation(),
+		PropagationLogRetention:   config.PropagationLogRetention(),
+		MaxConcurrentPropagations: config.MaxConcurrentPropagations(),
+		MaxFederates:              config.MaxFederates(),
+		RequestTimeout:            config.RequestTimeout(),
+		PinnedBoards:              config.PinnedBoards(),
+		IndexOrder:                config.IndexOrder(),
+		RejectTagOnlyBoards:       config.RejectTagOnlyBoards(),
+		LogViaChain:               config.LogViaChain(),
+		AllowBoardConnections:     config.AllowBoardConnections(),
+		MaxHeaderBytes:            config.MaxHeaderBytes(),
+		ContentDenyPatterns:       config.ContentDenyPatterns(),
+		PropagationBacklogDepth:   config.PropagationBacklogDepth(),
+		PropagationBacklogAge:     config.PropagationBacklogAge(),
+		PathPrefix:                config.PathPrefix(),
+		MinifyBoards:              config.MinifyBoards(),
+		ReplayOnStartup:           config.ReplayOnStartup(),
+		MaxConcurrentReads:        config.MaxConcurrentReads(),
+		MaxConcurrentWrites:       config.MaxConcurrentWrites(),
+		MaxExpiryHorizon:          config.MaxExpiryHorizon(),
+		Webhooks:                  config.Webhooks(),
+		ReverifyInterval:          config.ReverifyInterval(),
+		ReverifyBatchSize:         config.ReverifyBatchSize(),
+	}
+}
+
+// createDatabaseDir creates the directory an sqlite database goes in, e.g. a
+// data_dir that doesn't exist yet.
+func createDatabaseDir(config Config) error {
+	if config.SQLDriver() != "sqlite" {
+		return nil
+	}
+	dbPath := strings.SplitN(config.SQLConnectionString(), "?", 2)[0]
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return fmt.Errorf("Could not create the database's directory: %s", err)
+	}
+	return nil
+}
+
+func showConfig() (err error) {
 	if len(os.Args) > 2 && (os.Args[2] == "-h" || os.Args[2] == "--help") {
-		printServeHelp()
+		printConfigHelp()
 		return
 	}
 
@@ -82,51 +352,496 @@ func serve() (err error) {
 		}
 	}
 
-	springboard.RunServer(config.Port(), config.Federates(), config.AdminBoard(), config.FQDN(), config.PropagateWait(), config.SQLDriver(), config.SQLConnectionString())
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SETTING\tSOURCE\tVALUE")
+	for _, setting := range config.Settings() {
+		fmt.Fprintf(writer, "%s\t%s\t%v\n", setting.Name, setting.Source, setting.Value)
+	}
+	return writer.Flush()
+}
+
+func events() (err error) {
+	flags := flag.NewFlagSet("events", flag.ContinueOnError)
+	flags.Usage = printEventsHelp
+	asJSON := flags.Bool("json", false, "")
+	args, err := parseFlags(flags, os.Args[2:])
+	if err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return
+	}
+	if len(args) == 0 {
+		printEventsHelp()
+		return
+	}
+	var keyPath string
+	if len(args) > 1 {
+		keyPath = args[1]
+	}
+
+	client := springboard.NewClient(args[0])
+	return client.StreamEvents(keyPath, func(event springboard.ServerEvent) error {
+		if *asJSON {
+			line, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(line))
+			return nil
+		}
+		fmt.Println(formatEvent(event))
+		return nil
+	})
+}
+
+// formatEvent describes an event on one line.
+func formatEvent(event springboard.ServerEvent) string {
+	line := fmt.Sprintf("%s %s", event.At.Format(time.RFC3339), event.Type)
+	if event.Key != "" {
+		line += " " + event.Key
+	}
+	if event.Modified != nil {
+		line += " modified " + event.Modified.UTC().Format(time.RFC3339)
+	}
+	if event.Destination != "" {
+		line += " to " + event.Destination
+	}
+	if event.Count > 0 {
+		line += fmt.Sprintf(" (%d boards)", event.Count)
+	}
+	return line
+}
+
+func diff() (err error) {
+	if len(os.Args) > 2 && (os.Args[2] == "-h" || os.Args[2] == "--help") {
+		printDiffHelp()
+		return
+	}
+	if len(os.Args) != 4 {
+		printDiffHelp()
+		return fmt.Errorf("diff needs two server URLs")
+	}
+	serverA, serverB := os.Args[2], os.Args[3]
+	indexA, err := springboard.NewClient(serverA).GetIndex()
+	if err != nil {
+		return fmt.Errorf("Could not fetch the index of %s: %s", serverA, err)
+	}
+	indexB, err := springboard.NewClient(serverB).GetIndex()
+	if err != nil {
+		return fmt.Errorf("Could not fetch the index of %s: %s", serverB, err)
+	}
+
+	result := springboard.DiffIndexes(indexA, indexB)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, key := range result.OnlyInA {
+		fmt.Fprintf(writer, "only on A\t%s\n", key)
+	}
+	for _, key := range result.OnlyInB {
+		fmt.Fprintf(writer, "only on B\t%s\n", key)
+	}
+	for _, modified := range result.Modified {
+		fmt.Fprintf(writer, "modified\t%s\tA: %s\tB: %s\n", modified.Key, modified.A.UTC().Format(time.RFC3339), modified.B.UTC().Format(time.RFC3339))
+	}
+	if err = writer.Flush(); err != nil {
+		return
+	}
+
+	fmt.Printf("A: %s (%d boards)\nB: %s (%d boards)\n", serverA, len(indexA.Boards), serverB, len(indexB.Boards))
+	if result.Diverged() {
+		return fmt.Errorf("%d only on A, %d only on B, %d modified differently", len(result.OnlyInA), len(result.OnlyInB), len(result.Modified))
+	}
+	fmt.Println("in sync")
 	return
 }
 
+// parseFlags parses flags that may appear before, between, or after the
+// positional arguments, and returns the positional arguments.
+func parseFlags(flags *flag.FlagSet, args []string) (positional []string, err error) {
+	for {
+		if err = flags.Parse(args); err != nil {
+			return
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
 func post() (err error) {
-	if len(os.Args) == 2 || (os.Args[2] == "-h" || os.Args[2] == "--help") {
+	flags := flag.NewFlagSet("post", flag.ContinueOnError)
+	flags.Usage = printPostHelp
+	quiet := flags.Bool("quiet", false, "")
+	verbose := flags.Bool("verbose", false, "")
+	gzip := flags.Bool("gzip", false, "")
+	modified := flags.String("modified", "", "")
+	fromURL := flags.String("from-url", "", "")
+	appendToBoard := flags.Bool("append", false, "")
+	timeBuffer, err := timeBufferFlag(flags)
+	if err != nil {
+		return
+	}
+	args, err := parseFlags(flags, os.Args[2:])
+	if err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return
+	}
+	if len(args) == 0 {
 		printPostHelp()
 		return
 	}
+	if *quiet && *verbose {
+		return fmt.Errorf("--quiet and --verbose cannot be used together")
+	}
+	if *appendToBoard && *modified != "" {
+		return fmt.Errorf("--append and --modified cannot be used together")
+	}
+	if err = springboard.CheckTimeBuffer(*timeBuffer); err != nil {
+		return
+	}
 	var apiUrl string
 	var keyPath string
 
-	apiUrl = os.Args[2]
-	if len(os.Args) > 3 {
-		keyPath = os.Args[3]
+	apiUrl = args[0]
+	if len(args) > 1 {
+		keyPath = args[1]
 	}
 
 	client := springboard.NewClient(apiUrl)
-	body, err := ioutil.ReadAll(os.Stdin)
+	if *quiet {
+		client.Output = springboard.OutputQuiet
+	} else if *verbose {
+		client.Output = springboard.OutputVerbose
+	}
+	client.Gzip = *gzip
+	client.TimeBuffer = *timeBuffer
+	var body []byte
+	if *fromURL != "" {
+		body, err = springboard.FetchBoardContent(*fromURL)
+		if err != nil {
+			return
+		}
+	} else {
+		body, err = ioutil.ReadAll(os.Stdin)
+	}
+	if *appendToBoard {
+		return client.SignAndAppendToBoard(body, keyPath)
+	}
+	if *modified != "" {
+		modifiedAt, parseErr := time.Parse(time.RFC3339, *modified)
+		if parseErr != nil {
+			return fmt.Errorf("--modified must be an RFC 3339 time, e.g. 2022-06-01T12:00:00Z")
+		}
+		return client.SignAndPostBoardAt(body, keyPath, modifiedAt)
+	}
 	err = client.SignAndPostBoard(body, keyPath)
 
 	return
 }
 
+func unpublish() (err error) {
+	flags := flag.NewFlagSet("unpublish", flag.ContinueOnError)
+	flags.Usage = printUnpublishHelp
+	timeBuffer, err := timeBufferFlag(flags)
+	if err != nil {
+		return
+	}
+	args, err := parseFlags(flags, os.Args[2:])
+	if err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return
+	}
+	if len(args) == 0 {
+		printUnpublishHelp()
+		return
+	}
+	if err = springboard.CheckTimeBuffer(*timeBuffer); err != nil {
+		return
+	}
+	var keyPath string
+	if len(args) > 1 {
+		keyPath = args[1]
+	}
+
+	client := springboard.NewClient(args[0])
+	client.TimeBuffer = *timeBuffer
+	err = client.SignAndDeleteBoard(keyPath)
+	return
+}
+
+func check() (err error) {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.Usage = printCheckHelp
+	timeBuffer, err := timeBufferFlag(flags)
+	if err != nil {
+		return
+	}
+	args, err := parseFlags(flags, os.Args[2:])
+	if err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return
+	}
+	if len(args) == 0 {
+		printCheckHelp()
+		return
+	}
+	if err = springboard.CheckTimeBuffer(*timeBuffer); err != nil {
+		return
+	}
+	var keyPath string
+	if len(args) > 1 {
+		keyPath = args[1]
+	}
+	return checkBoardFile(os.Stdout, args[0], keyPath, *timeBuffer, time.Now())
+}
+
+// checkBoardFile assembles the board in path as post would at now, signed
+// with the key pair in keyPath, and writes a report of each check to out. It
+// fails if the board would be rejected.
+func checkBoardFile(out io.Writer, path string, keyPath string, timeBuffer time.Duration, now time.Time) (err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	_, privkey, err := springboard.GetKeys(keyPath)
+	if err != nil {
+		return
+	}
+	// The board is assembled as post would, dated now less the time buffer.
+	board, err := springboard.PrepareBoard(content, privkey, now.Add(-timeBuffer))
+	if err != nil {
+		fmt.Fprintf(out, "FAIL  assemble: %s\n", err)
+		return fmt.Errorf("%s would be rejected", path)
+	}
+	fmt.Fprintf(out, "ok    assemble: %d of %d bytes\n", len(board.Board), springboard.MaxBoardSize)
+	signature, _ := hex.DecodeString(board.Signature)
+	failed := false
+	for _, result := range springboard.CheckBoard(board.Key, board.Bytes(), signature, now) {
+		if result.Err != nil {
+			failed = true
+			fmt.Fprintf(out, "FAIL  %s: %s\n", result.Check, result.Err)
+		} else {
+			fmt.Fprintf(out, "ok    %s\n", result.Check)
+		}
+	}
+	if failed {
+		return fmt.Errorf("%s would be rejected", path)
+	}
+	fmt.Fprintf(out, "%s is ready to post\n", path)
+	return
+}
+
+func sign() (err error) {
+	if len(os.Args) > 2 && (os.Args[2] == "-h" || os.Args[2] == "--help") {
+		printSignHelp()
+		return
+	}
+	var keyPath string
+	if len(os.Args) > 2 {
+		keyPath = os.Args[2]
+	}
+	message, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return
+	}
+	signature, err := springboard.SignMessage(message, keyPath)
+	if err != nil {
+		return
+	}
+	fmt.Println(signature)
+	return
+}
+
+func verifySig() (err error) {
+	if len(os.Args) > 2 && (os.Args[2] == "-h" || os.Args[2] == "--help") {
+		printVerifySigHelp()
+		return
+	}
+	if len(os.Args) != 5 {
+		printVerifySigHelp()
+		return fmt.Errorf("verify-sig needs a key, a message, and a signature")
+	}
+	message := []byte(os.Args[3])
+	if os.Args[3] == "-" {
+		if message, err = ioutil.ReadAll(os.Stdin); err != nil {
+			return
+		}
+	}
+	if err = springboard.VerifyMessage(os.Args[2], message, os.Args[4]); err != nil {
+		return
+	}
+	fmt.Println("Valid signature")
+	return
+}
+
+// timeBufferFlag adds the --time-buffer flag, which defaults to
+// SB_TIME_BUFFER if set.
+func timeBufferFlag(flags *flag.FlagSet) (*time.Duration, error) {
+	buffer := springboard.DefaultTimeBuffer
+	if fromEnv, inEnv := os.LookupEnv("SB_TIME_BUFFER"); inEnv {
+		parsed, err := time.ParseDuration(fromEnv)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SB_TIME_BUFFER: %s", err)
+		}
+		buffer = parsed
+	}
+	return flags.Duration("time-buffer", buffer, ""), nil
+}
+
+func watch() (err error) {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flags.Usage = printWatchHelp
+	quiet := flags.Bool("quiet", false, "")
+	debounce := flags.Duration("debounce", springboard.DefaultWatchDebounce, "")
+	timeBuffer, err := timeBufferFlag(flags)
+	if err != nil {
+		return
+	}
+	args, err := parseFlags(flags, os.Args[2:])
+	if err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return
+	}
+	if len(args) < 2 {
+		printWatchHelp()
+		return
+	}
+	if err = springboard.CheckTimeBuffer(*timeBuffer); err != nil {
+		return
+	}
+	var keyPath string
+	if len(args) > 2 {
+		keyPath = args[2]
+	}
+
+	client := springboard.NewClient(args[0])
+	if *quiet {
+		client.Output = springboard.OutputQuiet
+	}
+	client.TimeBuffer = *timeBuffer
+	return client.WatchBoard(args[1], keyPath, *debounce)
+}
+
 func printServeHelp() {
 	fmt.Println(`springboard serve
 
 Usage:
 
-  [PORT=...] springboard serve
+  [PORT=...] springboard serve [FLAGS] [CONFIG_PATH]
+
+Flags:
+
+  --no-difficulty: accept new keys regardless of the difficulty factor, so
+                   clients can be tested with easily generated keys
+                   (for testing only, never in production)
+  --admin-board KEY: the admin board's key
+  --federate URL:    a server to federate with; repeat it for each one
+  --fqdn NAME:       who the server says it is during propagation
+
+  --admin-board, --federate, and --fqdn take precedence over environment
+  variables and CONFIG_PATH, e.g. for quick tests without editing them.
+
+Parameters:
+
+  CONFIG_PATH: (optional) path to a YAML config file (see the README)
 
 Environment Variables:
 
   PORT: port on which to listen (default: 8000)`)
 }
 
+func printConfigHelp() {
+	fmt.Println(`springboard config
+
+Usage:
+
+  springboard config [CONFIG_PATH]
+
+  Prints the settings serve would use, and whether each one comes from
+  an environment variable (env), the config file (yaml), or the default.
+
+Parameters:
+
+  CONFIG_PATH: (optional) path to a YAML config file (see the README)`)
+}
+
+func printDiffHelp() {
+	fmt.Println(`springboard diff
+
+Usage:
+
+  springboard diff SERVER_A SERVER_B
+
+  Compares the boards listed in two servers' /index.json: keys that only
+  one server has, and keys whose boards were modified at different times.
+  Exits with status 1 if the servers have diverged.
+
+Parameters:
+
+  SERVER_A: the full URL of the first spring83 server
+
+  SERVER_B: the full URL of the second spring83 server`)
+}
+
+func printEventsHelp() {
+	fmt.Println(`springboard events
+
+Usage:
+
+  springboard events [FLAGS] SERVER_URL [KEY_PAIR_FOLDER_PATH]
+
+  Prints the server's events (boards published, propagated, deleted, and
+  purged) as they happen, until stopped with ctrl-c. Only the owner of the
+  server's admin board can follow them.
+
+Flags:
+
+  --json: print each event as a line of JSON
+
+Parameters:
+
+  SERVER_URL:           the full URL for the spring83 server
+
+  KEY_PAIR_FOLDER_PATH: (optional) path of folder with the admin board's key pair
+                        if not provided, uses a standard path e.g. ~/.config/spring83`)
+}
+
 func printPostHelp() {
 	fmt.Println(`springboard post
 
 Usage:
 
-  springboard post SERVER_URL [KEY_PAIR_FOLDER_PATH]
+  springboard post [FLAGS] SERVER_URL [KEY_PAIR_FOLDER_PATH]
 
   Updates a board with the text from standard input. 
   You can either pipe the input or enter it and press ctrl-d.
+  With --from-url, the board's text is downloaded instead.
+
+Flags:
+
+  --quiet:              only print errors
+  --verbose:            print the full request and response, including headers
+  --gzip:               compress the board on the wire (the server must support
+                        Content-Encoding: gzip)
+  --time-buffer DURATION: how far to backdate the board's <time> tag, in case
+                        this computer's clock is ahead of the server's
+                        (default: $SB_TIME_BUFFER or 10m, at most 24h)
+  --modified TIME:      date the board at TIME (RFC 3339, e.g. 2022-06-01T12:00:00Z)
+                        instead of now, e.g. to republish an archived board;
+                        it can't be in the future
+  --from-url URL:       post the HTML at URL instead of standard input, e.g.
+                        to mirror a page or repost a board; its <time> tags
+                        are replaced and it must fit in 2217 bytes
+  --append:             add the text to the end of the key's current board on
+                        the server instead of replacing it; the current board's
+                        signature is checked, its <time> tag is replaced, and
+                        the combined board must still fit in 2217 bytes
 
 Parameters:
 
@@ -138,18 +853,179 @@ Parameters:
                         creates/finds a new valid key pair if none exist at path`)
 }
 
+func printUnpublishHelp() {
+	fmt.Println(`springboard unpublish
+
+Usage:
+
+  springboard unpublish [FLAGS] SERVER_URL [KEY_PAIR_FOLDER_PATH]
+
+  Deletes your board from a server by sending it a signed tombstone.
+  The server relays the tombstone to its federates.
+
+Flags:
+
+  --time-buffer DURATION: how far to backdate the tombstone's <time> tag
+                        (default: $SB_TIME_BUFFER or 10m, at most 24h)
+
+Parameters:
+
+  SERVER_URL:           the full URL for the spring83 server
+
+  KEY_PAIR_FOLDER_PATH: (optional) path of folder with valid public/private key path
+                        if not provided, uses a standard path e.g. ~/.config/spring83`)
+}
+
+func printCheckHelp() {
+	fmt.Println(`springboard check
+
+Usage:
+
+  springboard check [FLAGS] FILE [KEY_PAIR_FOLDER_PATH]
+
+  Assembles and signs FILE as post would, and checks that servers would
+  accept it: its size, <time> tag, and encoding, the key's expiry, and the
+  signature. Nothing is sent anywhere. Exits with status 1 if any check fails.
+
+Flags:
+
+  --time-buffer DURATION: how far to backdate the board's <time> tag, as post
+                          does (default: $SB_TIME_BUFFER or 10m, at most 24h)
+
+Parameters:
+
+  FILE: the board's HTML, without a <time> tag
+  KEY_PAIR_FOLDER_PATH: (optional) path of folder with valid public/private key path
+                        if not provided, uses a standard path e.g. ~/.config/spring83`)
+}
+
+func printSignHelp() {
+	fmt.Println(`springboard sign
+
+Usage:
+
+  springboard sign [KEY_PAIR_FOLDER_PATH] < MESSAGE
+
+  Prints the hex ed25519 signature of standard input by your private key,
+  e.g. to prove you own your board's key somewhere else. Every byte is signed,
+  including a trailing newline.
+
+Parameters:
+
+  KEY_PAIR_FOLDER_PATH: (optional) path of folder with valid public/private key path
+                        if not provided, uses a standard path e.g. ~/.config/spring83`)
+}
+
+func printVerifySigHelp() {
+	fmt.Println(`springboard verify-sig
+
+Usage:
+
+  springboard verify-sig KEY MESSAGE SIGNATURE
+
+  Checks that SIGNATURE is KEY's signature of MESSAGE, exiting with status 1
+  if it isn't.
+
+Parameters:
+
+  KEY:       the hex public key
+
+  MESSAGE:   the signed message, or - to read it from standard input (use this
+             for messages signed with a trailing newline)
+
+  SIGNATURE: the hex signature, as printed by springboard sign`)
+}
+
+func printWatchHelp() {
+	fmt.Println(`springboard watch
+
+Usage:
+
+  springboard watch [FLAGS] SERVER_URL FILE [KEY_PAIR_FOLDER_PATH]
+
+  Posts the board in FILE, then reposts a freshly signed copy every time
+  FILE changes. Stop watching with ctrl-c.
+
+Flags:
+
+  --quiet:              only print errors
+  --debounce DURATION:  how long to wait for FILE to stop changing before
+                        reposting (default: 500ms)
+  --time-buffer DURATION: how far to backdate the board's <time> tag
+                        (default: $SB_TIME_BUFFER or 10m, at most 24h)
+
+Parameters:
+
+  SERVER_URL:           the full URL for the spring83 server
+
+  FILE:                 path of the file containing the board's HTML
+
+  KEY_PAIR_FOLDER_PATH: (optional) path of folder with valid public/private key path
+                        if not provided, uses a standard path e.g. ~/.config/spring83`)
+}
+
 func printGenerateKeyHelp() {
 	fmt.Println(`springboard generate-key
 
 Usage:
 
-  springboard generate-key [KEY_LOCATION]
+  springboard generate-key [FLAGS] [KEY_LOCATION]
+
+Flags:
+
+  --count N: generate N distinct key pairs, written to numbered folders
+             KEY_LOCATION/1 to KEY_LOCATION/N (default: 1, written to
+             KEY_LOCATION itself)
+  --print-key: print nothing but the public key (one per line with --count)
+               to standard output, e.g. KEY=$(springboard generate-key --print-key).
+               Progress is always printed to standard error.
+  --vanity PREFIX: only accept keys that also start with PREFIX, up to 4 hex
+                   characters (0-9, a-f). Each character makes the search 16
+                   times longer: 2 characters take ~256 times as long.
+  --json: print each key pair as a line of JSON with its public_key,
+          public_key_path, private_key_path, and expiry. The private key
+          itself is never printed.
 
 Parameters:
 
   KEY_LOCATION: (optional) path to a folder that contains a valid Spring '83 key pair (defaults to ~/.config/spring83)`)
 }
 
+func printKeyInfoHelp() {
+	fmt.Println(`springboard key-info
+
+Usage:
+
+  springboard key-info [FLAGS] [KEY_LOCATION]
+
+  Shows a key pair's public key, where its files are, and when it expires.
+
+Flags:
+
+  --json: print them as JSON with public_key, public_key_path,
+          private_key_path, and expiry. The private key itself is never
+          printed.
+
+Parameters:
+
+  KEY_LOCATION: (optional) path to a folder that contains a Spring '83 key pair (defaults to ~/.config/spring83)`)
+}
+
+func printEstimateKeyHelp() {
+	fmt.Println(`springboard estimate-key
+
+Usage:
+
+  springboard estimate-key [DURATION]
+
+  Measures how fast this machine generates keys and estimates how long
+  generate-key will take.
+
+Parameters:
+
+  DURATION: (optional) how long to measure for, e.g. 10s (defaults to 5s)`)
+}
+
 func printRootHelp() {
 	fmt.Println(`springboard
 
@@ -160,7 +1036,17 @@ Usage:
 Valid SUBCOMMANDS are:
 
   post (posts a board to a server)
+  unpublish (deletes your board from a server)
+  watch (reposts a board file whenever it changes)
+  check (checks a board would be accepted, without posting it)
   serve (starts a Spring '83 server)
+  config (shows the settings a server would use)
+  diff (compares the boards on two servers)
+  events (prints a server's events as they happen)
+  sign (signs a message with your key)
+  verify-sig (checks a message's signature)
   generate-key (generates a new Spring '83 compliant key)
+  key-info (describes a key pair)
+  estimate-key (estimates how long generate-key will take)
   help (shows the help for a sub-command)`)
 }
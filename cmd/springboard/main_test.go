@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/motevets/s83/pkg/springboard"
+)
+
+func TestPrintGeneratedKeys(t *testing.T) {
+	keys := []springboard.KeyInfo{
+		{PublicKey: "aaaa83e1027", PublicKeyPath: "/keys/aaaa/key.pub", PrivateKeyPath: "/keys/aaaa/key.priv"},
+		{PublicKey: "bbbb83e1027", PublicKeyPath: "/keys/bbbb/key.pub", PrivateKeyPath: "/keys/bbbb/key.priv"},
+	}
+
+	t.Run("print-key writes only the keys", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printGeneratedKeys(&out, keys, true, false); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := out.String(), "aaaa83e1027\nbbbb83e1027\n"; got != want {
+			t.Errorf("Expected stdout to be just the keys %q, got %q", want, got)
+		}
+	})
+
+	t.Run("json writes a line per key", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printGeneratedKeys(&out, keys, false, true); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if len(lines) != len(keys) {
+			t.Fatalf("Expected %d lines, got %q", len(keys), out.String())
+		}
+		for i, line := range lines {
+			var decoded map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+				t.Fatalf("Line %d is not JSON: %s", i, err)
+			}
+			if decoded["public_key"] != keys[i].PublicKey {
+				t.Errorf("Expected line %d to describe %s, got %q", i, keys[i].PublicKey, line)
+			}
+		}
+	})
+
+	t.Run("default describes each key", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := printGeneratedKeys(&out, keys, false, false); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := out.String(), "Generated key aaaa83e1027\nGenerated key bbbb83e1027\n"; got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	})
+}
+
+func TestKeyInfoJSONLeavesOutPrivateKey(t *testing.T) {
+	_, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// key-info only reads the public key, so it needn't match the private
+	// one for the expiry to be parsed from its suffix.
+	pubkey := strings.Repeat("0", 57) + "83e1030"
+	encodedPrivkey := hex.EncodeToString(privkey)
+	keyPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(keyPath, "key.pub"), []byte(pubkey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(keyPath, "key.priv"), []byte(encodedPrivkey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := springboard.GetKeyInfo(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := printKeyInfoJSON(&out, info); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output isn't JSON (%q): %s", out.String(), err)
+	}
+	for _, field := range []string{"public_key", "private_key_path", "public_key_path", "expiry"} {
+		if decoded[field] == nil {
+			t.Errorf("Output has no %s: %q", field, out.String())
+		}
+	}
+	if decoded["public_key"] != pubkey {
+		t.Errorf("public_key is %v, want %s", decoded["public_key"], pubkey)
+	}
+	if len(decoded) != 4 {
+		t.Errorf("Output has fields besides the four expected: %q", out.String())
+	}
+	if strings.Contains(out.String(), encodedPrivkey) || strings.Contains(out.String(), encodedPrivkey[:64]) {
+		t.Errorf("Output includes the private key: %q", out.String())
+	}
+}
+
+// checkKeyPub and checkKeyPriv are a real key pair whose public key ends in
+// 83e1055, found ahead of time since grinding one takes too long for a test.
+// It's valid from October 2053 through October 2055.
+const (
+	checkKeyPub  = "73854adb3590c0f132e3a71c429fac7482efc69077e78c9af706b2d2583e1055"
+	checkKeyPriv = "51536b5219877bc7d33f07b45996419ea9cf72b37952c97988402a7b859c5dd1" + checkKeyPub
+)
+
+// writeFile writes content to name in dir and returns its path.
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckBoardFile(t *testing.T) {
+	keyPath := t.TempDir()
+	writeFile(t, keyPath, "key.pub", checkKeyPub)
+	writeFile(t, keyPath, "key.priv", checkKeyPriv)
+	_, otherPrivkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsuffixedKeyPath := t.TempDir()
+	writeFile(t, unsuffixedKeyPath, "key.pub", hex.EncodeToString(otherPrivkey.Public().(ed25519.PublicKey)))
+	writeFile(t, unsuffixedKeyPath, "key.priv", hex.EncodeToString(otherPrivkey))
+
+	boards := t.TempDir()
+	valid := writeFile(t, boards, "valid.html", "<p>hello</p>")
+	validKeyTime := time.Date(2055, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		name    string
+		path    string
+		keyPath string
+		now     time.Time
+		// failure is the report line for the first failing check, or empty
+		// if the board should pass.
+		failure string
+	}{
+		{"valid board", valid, keyPath, validKeyTime, ""},
+		{"expired key", valid, keyPath, time.Date(2055, 11, 2, 0, 0, 0, 0, time.UTC), "FAIL  key: Key has expired"},
+		{"key too far ahead", valid, keyPath, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), "FAIL  key: Key is set to expire"},
+		{"key without 83eMMYY", valid, unsuffixedKeyPath, validKeyTime, "FAIL  key: Signature must end with 83eMMYY"},
+		{"too large", writeFile(t, boards, "large.html", strings.Repeat("a", springboard.MaxContentSize+1)), keyPath, validKeyTime, "FAIL  assemble: Board is"},
+		{"own time tag", writeFile(t, boards, "tagged.html", `<time datetime="2055-01-01T00:00:00Z"></time>`), keyPath, validKeyTime, "FAIL  assemble:"},
+		{"not UTF-8", writeFile(t, boards, "latin1.html", "caf\xe9"), keyPath, validKeyTime, "FAIL  board: Board must be valid UTF-8"},
+	} {
+		var out bytes.Buffer
+		err := checkBoardFile(&out, test.path, test.keyPath, time.Minute, test.now)
+		report := out.String()
+		if test.failure == "" {
+			if err != nil || !strings.Contains(report, "ok    signature\n") || !strings.HasSuffix(report, "is ready to post\n") {
+				t.Errorf("%s: got %v with report %q, want it to pass", test.name, err, report)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "would be rejected") {
+			t.Errorf("%s: got %v, want it to be rejected", test.name, err)
+		}
+		if !strings.Contains(report, test.failure) || strings.Contains(report, "ready to post") {
+			t.Errorf("%s: report is %q, want it to include %q", test.name, report, test.failure)
+		}
+	}
+
+	if err := checkBoardFile(io.Discard, valid, t.TempDir(), time.Minute, validKeyTime); err == nil {
+		t.Errorf("Checking without a key pair succeeded")
+	}
+}
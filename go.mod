@@ -5,6 +5,7 @@ go 1.18
 require github.com/glebarez/go-sqlite v1.17.3
 
 require (
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/lib/pq v1.10.6
 	github.com/mattn/go-isatty v0.0.14 // indirect
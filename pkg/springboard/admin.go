@@ -0,0 +1,52 @@
+package springboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// purgeAllInterval is how long after a purge of every board the next one is
+// allowed.
+const purgeAllInterval = time.Minute
+
+// purgeAllBoards deletes every board, including the admin board, when the
+// admin board's owner asks with POST /admin/purge-all, and responds with how
+// many were deleted. It's meant for wiping test servers without restarting
+// them, so it can only run once every purgeAllInterval.
+func (s *Spring83Server) purgeAllBoards(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	s.purgeAllMutex.Lock()
+	defer s.purgeAllMutex.Unlock()
+	if wait := time.Until(s.lastPurgeAll.Add(purgeAllInterval)); wait > 0 {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Boards were purged recently, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	deleted, err := s.repo.DeleteAllBoards()
+	if err != nil {
+		log.Printf("Error in purgeAllBoards: %s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	s.lastPurgeAll = time.Now()
+	log.Printf("Admin purged all %d boards", deleted)
+	s.events.Publish(ServerEvent{Type: EventPurged, At: s.lastPurgeAll.UTC(), Count: deleted})
+
+	response, err := json.Marshal(struct {
+		Deleted int `json:"deleted"`
+	}{deleted})
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(response)
+}
@@ -0,0 +1,74 @@
+package springboard
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newAdminServer returns a test server whose admin board is a real ed25519
+// key, so requests can prove they're from its owner.
+func newAdminServer(t *testing.T) (*Spring83Server, ed25519.PrivateKey) {
+	t.Helper()
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestServer(t, ServerConfig{AdminBoard: hex.EncodeToString(pubkey)}), privkey
+}
+
+// adminRequest returns a request to path with a Spring-Auth header signed by
+// privkey, for a nonce issued for the server's admin board.
+func adminRequest(t *testing.T, server *Spring83Server, privkey ed25519.PrivateKey, method string, path string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(method, path, nil)
+	nonce, _, err := server.challenges.Issue(server.adminBoard, remoteHost(r), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Spring-Auth", SpringAuth(privkey, nonce))
+	return r
+}
+
+func TestPurgeAllRequiresAdmin(t *testing.T) {
+	server, privkey := newAdminServer(t)
+	for i := 1; i <= 3; i++ {
+		mustPublish(t, server.repo, testBoard(testKey(i), time.Now(), "hello"))
+	}
+
+	_, otherPrivkey, _ := ed25519.GenerateKey(nil)
+	for name, r := range map[string]*http.Request{
+		"without Spring-Auth":   httptest.NewRequest(http.MethodPost, "/admin/purge-all", nil),
+		"signed by another key": adminRequest(t, server, otherPrivkey, http.MethodPost, "/admin/purge-all"),
+	} {
+		if w := serve(server, r); w.Code != http.StatusForbidden {
+			t.Errorf("Purge %s got %d, want 403", name, w.Code)
+		}
+	}
+	if count, _ := server.repo.BoardCount(); count != 3 {
+		t.Fatalf("Rejected purges left %d boards, want 3", count)
+	}
+
+	w := serve(server, adminRequest(t, server, privkey, http.MethodPost, "/admin/purge-all"))
+	if w.Code != http.StatusOK || w.Body.String() != `{"deleted":3}` {
+		t.Errorf("Admin's purge got %d %q, want 200 with 3 deleted", w.Code, w.Body.String())
+	}
+	if count, _ := server.repo.BoardCount(); count != 0 {
+		t.Errorf("Purge left %d boards", count)
+	}
+
+	w = serve(server, adminRequest(t, server, privkey, http.MethodPost, "/admin/purge-all"))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("A second purge straight away got %d, want 429 with Retry-After", w.Code)
+	}
+}
+
+func TestPurgeAllWithoutAdminBoard(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	if w := serve(server, httptest.NewRequest(http.MethodPost, "/admin/purge-all", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("Purge on a server without an admin board got %d, want 404", w.Code)
+	}
+}
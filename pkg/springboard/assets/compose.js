@@ -0,0 +1,96 @@
+// Signs a board with the author's key using WebCrypto and PUTs it to this
+// server. Keys are in the format written by "springboard generate-key": the
+// hex-encoded 32 byte seed followed by the 32 byte public key.
+(function () {
+	"use strict";
+
+	var MAX_BOARD_SIZE = 2217;
+	var TIME_TAG_LENGTH = '<time datetime="YYYY-MM-DDTHH:MM:SSZ"></time>'.length;
+	// Boards are backdated by the CLI's default time buffer (DefaultTimeBuffer
+	// in client.go), so a clock running a little fast doesn't get them
+	// refused as from the future.
+	var TIME_BUFFER_MINUTES = 10;
+	// DER prefix of a PKCS #8 wrapped Ed25519 private key, followed by the seed.
+	var PKCS8_PREFIX = "302e020100300506032b657004220420";
+
+	var form = document.getElementById("composer");
+	var privateKeyInput = document.getElementById("private-key");
+	var boardInput = document.getElementById("board");
+	var sizeOutput = document.getElementById("size");
+	var statusOutput = document.getElementById("status");
+
+	function hexToBytes(hex) {
+		if (!/^([0-9a-f]{2})*$/i.test(hex)) {
+			throw new Error("Key must be hex encoded");
+		}
+		var bytes = new Uint8Array(hex.length / 2);
+		for (var i = 0; i < bytes.length; i++) {
+			bytes[i] = parseInt(hex.substr(i * 2, 2), 16);
+		}
+		return bytes;
+	}
+
+	function bytesToHex(bytes) {
+		return Array.prototype.map.call(new Uint8Array(bytes), function (b) {
+			return b.toString(16).padStart(2, "0");
+		}).join("");
+	}
+
+	function timeTag(date) {
+		var datetime = date.toISOString().replace(/\.\d+Z$/, "Z");
+		return '<time datetime="' + datetime + '"></time>';
+	}
+
+	function updateSize() {
+		var size = new TextEncoder().encode(boardInput.value).length + TIME_TAG_LENGTH;
+		sizeOutput.textContent = size;
+		sizeOutput.style.color = size > MAX_BOARD_SIZE ? "red" : "";
+	}
+
+	async function signAndPost(event) {
+		event.preventDefault();
+		statusOutput.textContent = "Signing...";
+		try {
+			var keyBytes = hexToBytes(privateKeyInput.value.trim());
+			if (keyBytes.length !== 64) {
+				throw new Error("Private key must be 64 bytes (128 hex characters)");
+			}
+			var publicKey = bytesToHex(keyBytes.slice(32));
+			var privateKey = await crypto.subtle.importKey(
+				"pkcs8",
+				hexToBytes(PKCS8_PREFIX + bytesToHex(keyBytes.slice(0, 32))),
+				{ name: "Ed25519" },
+				false,
+				["sign"]
+			);
+
+			var board = new TextEncoder().encode(timeTag(new Date(Date.now() - TIME_BUFFER_MINUTES * 60 * 1000)) + "\n" + boardInput.value);
+			if (board.length > MAX_BOARD_SIZE) {
+				throw new Error("Board is larger than " + MAX_BOARD_SIZE + " bytes");
+			}
+			var signature = await crypto.subtle.sign({ name: "Ed25519" }, privateKey, board);
+
+			statusOutput.textContent = "Posting...";
+			var response = await fetch(publicKey, {
+				method: "PUT",
+				headers: {
+					"Content-Type": "text/html;charset=utf-8",
+					"Spring-Signature": bytesToHex(signature),
+					"Spring-Version": "83"
+				},
+				body: board
+			});
+			if (response.ok) {
+				statusOutput.textContent = "Posted! View your board at /" + publicKey;
+			} else {
+				statusOutput.textContent = response.status + " " + response.statusText + ": " + await response.text();
+			}
+		} catch (err) {
+			statusOutput.textContent = "Could not post board: " + err.message;
+		}
+	}
+
+	boardInput.addEventListener("input", updateSize);
+	form.addEventListener("submit", signAndPost);
+	updateSize();
+})();
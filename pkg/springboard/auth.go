@@ -0,0 +1,220 @@
+package springboard
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// challengeTTL is how long a nonce from GET /<key>/challenge can be used.
+const challengeTTL = 5 * time.Minute
+
+// relayedChallengeTTL is how long after it was issued a federate's nonce is
+// accepted in a relayed deletion: long enough for the relay's retries.
+const relayedChallengeTTL = 2 * time.Hour
+
+// maxOutstandingChallenges bounds how many unexpired nonces are remembered.
+const maxOutstandingChallenges = 10_000
+
+// maxChallengesPerClient bounds how many unexpired nonces one client address
+// may hold, so no single client can use up maxOutstandingChallenges and lock
+// the admin out.
+const maxChallengesPerClient = 10
+
+type challenge struct {
+	key       string
+	client    string
+	expiresAt time.Time
+}
+
+// challengeStore tracks the nonces handed out to prove ownership of a key.
+// Each nonce is bound to one key and can be redeemed once.
+type challengeStore struct {
+	mutex     sync.Mutex
+	issued    map[string]challenge
+	perClient map[string]int
+	// issueOrder lists nonces oldest first, which is also the order they
+	// expire in, so expired ones are found without scanning issued.
+	issueOrder []string
+}
+
+func newChallengeStore() *challengeStore {
+	return &challengeStore{issued: map[string]challenge{}, perClient: map[string]int{}}
+}
+
+// Issue returns a new nonce for key, requested from the client address
+// client, or an error if that client or all clients together have too many
+// outstanding. The nonce starts with the Unix time it was issued at, so that
+// servers it's relayed to know when it was signed.
+func (store *challengeStore) Issue(key string, client string, now time.Time) (nonce string, expiresAt time.Time, err error) {
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return
+	}
+	nonce = fmt.Sprintf("%d.%s", now.Unix(), hex.EncodeToString(random))
+	expiresAt = now.Add(challengeTTL)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.forgetExpired(now)
+	if store.perClient[client] >= maxChallengesPerClient || len(store.issued) >= maxOutstandingChallenges {
+		err = fmt.Errorf("Too many outstanding challenges, try again later")
+		return
+	}
+	store.issued[nonce] = challenge{key: key, client: client, expiresAt: expiresAt}
+	store.perClient[client]++
+	store.issueOrder = append(store.issueOrder, nonce)
+	return
+}
+
+// forgetExpired drops the nonces that have expired, visiting only those.
+func (store *challengeStore) forgetExpired(now time.Time) {
+	expired := 0
+	for _, nonce := range store.issueOrder {
+		issued, ok := store.issued[nonce]
+		if ok && !now.After(issued.expiresAt) {
+			break
+		}
+		// Nonces already redeemed are only left in issueOrder.
+		store.forget(nonce)
+		expired++
+	}
+	store.issueOrder = store.issueOrder[expired:]
+}
+
+// forget removes nonce, if it's still outstanding.
+func (store *challengeStore) forget(nonce string) {
+	issued, ok := store.issued[nonce]
+	if !ok {
+		return
+	}
+	delete(store.issued, nonce)
+	if store.perClient[issued.client]--; store.perClient[issued.client] <= 0 {
+		delete(store.perClient, issued.client)
+	}
+}
+
+// Redeem checks that nonce was issued for key, hasn't expired, and was signed
+// by key, and if so forgets it so it can't be replayed.
+func (store *challengeStore) Redeem(key string, nonce string, signature []byte, now time.Time) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	issued, ok := store.issued[nonce]
+	if !ok || issued.key != key {
+		return false
+	}
+	if now.After(issued.expiresAt) {
+		store.forget(nonce)
+		return false
+	}
+	if verifyBoardSignature(key, []byte(nonce), signature) != nil {
+		return false
+	}
+	store.forget(nonce)
+	return true
+}
+
+// SpringAuth returns the value of a Spring-Auth header proving ownership of
+// privkey's public key, given a nonce from GET /<key>/challenge.
+func SpringAuth(privkey ed25519.PrivateKey, nonce string) string {
+	return fmt.Sprintf("%s %x", nonce, ed25519.Sign(privkey, []byte(nonce)))
+}
+
+// verifyOwner checks a request's Spring-Auth header, "<nonce> <signature>",
+// where signature is the key's hex signature of the nonce.
+func (s *Spring83Server) verifyOwner(r *http.Request, key string) bool {
+	parts := strings.Fields(r.Header.Get("Spring-Auth"))
+	if len(parts) != 2 {
+		return false
+	}
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	return s.challenges.Redeem(key, parts[0], signature, time.Now())
+}
+
+// verifyRelayedOwner checks the Spring-Auth header of a deletion relayed by
+// a federate, whose nonce this server didn't issue and can't redeem. It's
+// accepted if key signed it and it was issued within relayedChallengeTTL.
+// Replaying it can only delete boards modified before it was issued again,
+// so it isn't limited to one use.
+func (s *Spring83Server) verifyRelayedOwner(r *http.Request, key string, now time.Time) bool {
+	parts := strings.Fields(r.Header.Get("Spring-Auth"))
+	if len(parts) != 2 {
+		return false
+	}
+	issuedAt, err := nonceIssuedAt(parts[0])
+	if err != nil || issuedAt.After(now) || now.Sub(issuedAt) > relayedChallengeTTL {
+		return false
+	}
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	return verifyBoardSignature(key, []byte(parts[0]), signature) == nil
+}
+
+// nonceIssuedAt returns the time a nonce from Issue was issued at.
+func nonceIssuedAt(nonce string) (time.Time, error) {
+	seconds, _, found := strings.Cut(nonce, ".")
+	if !found {
+		return time.Time{}, fmt.Errorf("Nonce %q has no issue time", nonce)
+	}
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Nonce %q has no issue time", nonce)
+	}
+	return time.Unix(unix, 0).UTC(), nil
+}
+
+// showChallenge hands out a nonce that the owner of the key at
+// /<key>/challenge can sign to authenticate an action.
+func (s *Spring83Server) showChallenge(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimSuffix(r.URL.Path[1:], "/challenge")
+	now := time.Now()
+	if err := validateKeyWithin(key, now, s.maxExpiryHorizon); err != nil {
+		http.Error(w, err.Error(), validationStatus(err))
+		return
+	}
+	nonce, expiresAt, err := s.challenges.Issue(key, remoteHost(r), now)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	response, err := json.Marshal(struct {
+		Nonce   string    `json:"nonce"`
+		Expires time.Time `json:"expires"`
+	}{nonce, expiresAt})
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(response)
+}
+
+// requireAdmin checks that a request is authenticated with a Spring-Auth
+// header for the admin board's key, responding 403 Forbidden if it isn't, or
+// 404 Not Found if the server has no admin board.
+func (s *Spring83Server) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.adminBoard == "" {
+		http.Error(w, "This server has no admin board", http.StatusNotFound)
+		return false
+	}
+	if !s.verifyOwner(r, s.adminBoard) {
+		http.Error(w, "Missing or invalid Spring-Auth header for the admin board", http.StatusForbidden)
+		return false
+	}
+	return true
+}
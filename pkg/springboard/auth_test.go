@@ -0,0 +1,179 @@
+package springboard
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// signNonce signs a nonce as SpringAuth does.
+func signNonce(privkey ed25519.PrivateKey, nonce string) []byte {
+	return ed25519.Sign(privkey, []byte(nonce))
+}
+
+func TestChallengeNonces(t *testing.T) {
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := hex.EncodeToString(pubkey)
+	store := newChallengeStore()
+	now := time.Now()
+
+	nonce, _, err := store.Issue(key, "192.0.2.1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Redeem(key, nonce, signNonce(privkey, nonce), now.Add(time.Minute)) {
+		t.Errorf("Valid nonce wasn't accepted")
+	}
+	if store.Redeem(key, nonce, signNonce(privkey, nonce), now.Add(time.Minute)) {
+		t.Errorf("Replayed nonce was accepted")
+	}
+
+	expiring, _, _ := store.Issue(key, "192.0.2.1", now)
+	if store.Redeem(key, expiring, signNonce(privkey, expiring), now.Add(challengeTTL+time.Second)) {
+		t.Errorf("Expired nonce was accepted")
+	}
+
+	_, otherPrivkey, _ := ed25519.GenerateKey(nil)
+	forged, _, _ := store.Issue(key, "192.0.2.1", now)
+	if store.Redeem(key, forged, signNonce(otherPrivkey, forged), now) {
+		t.Errorf("Nonce signed by another key was accepted")
+	}
+	if store.Redeem(testKey(1), forged, signNonce(privkey, forged), now) {
+		t.Errorf("Nonce was accepted for a key it wasn't issued for")
+	}
+	if !store.Redeem(key, forged, signNonce(privkey, forged), now) {
+		t.Errorf("Failed attempts used up the nonce")
+	}
+}
+
+func TestChallengesAreLimitedPerClient(t *testing.T) {
+	store := newChallengeStore()
+	now := time.Now()
+	for i := 0; i < maxChallengesPerClient; i++ {
+		if _, _, err := store.Issue(testKey(1), "192.0.2.1", now); err != nil {
+			t.Fatalf("Challenge %d was refused: %s", i+1, err)
+		}
+	}
+	if _, _, err := store.Issue(testKey(1), "192.0.2.1", now); err == nil {
+		t.Errorf("Issued more than %d challenges to one client", maxChallengesPerClient)
+	}
+	if _, _, err := store.Issue(testKey(1), "192.0.2.2", now); err != nil {
+		t.Errorf("One client's challenges locked out another: %s", err)
+	}
+	if _, _, err := store.Issue(testKey(1), "192.0.2.1", now.Add(challengeTTL+time.Second)); err != nil {
+		t.Errorf("Expired challenges still count against the client: %s", err)
+	}
+	if len(store.issued) != 1 || len(store.issueOrder) != 1 {
+		t.Errorf("Store holds %d nonces (%d in order), want only the unexpired one", len(store.issued), len(store.issueOrder))
+	}
+}
+
+// authDeleteRequest returns a DELETE of key authenticated by privkey signing
+// nonce, relayed through via if it's set.
+func authDeleteRequest(key string, privkey ed25519.PrivateKey, nonce string, via string) *http.Request {
+	r := httptest.NewRequest(http.MethodDelete, "/"+key, nil)
+	r.Header.Set("Spring-Auth", SpringAuth(privkey, nonce))
+	if via != "" {
+		r.Header.Set("Via", via)
+	}
+	return r
+}
+
+func TestAuthDeletionIsStoredAndRelayed(t *testing.T) {
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := hex.EncodeToString(pubkey)
+	board := testBoard(key, time.Now().Add(-time.Hour), "<p>hello</p>")
+
+	peer := newTestServer(t, ServerConfig{})
+	peerHTTP := httptest.NewServer(peer.Handler())
+	defer peerHTTP.Close()
+	// Federates only accept a nonce they didn't issue from a relay, which
+	// names itself in the Via header.
+	server := newTestServer(t, ServerConfig{Federates: []string{peerHTTP.URL}, FQDN: "origin.example"})
+	mustPublish(t, server.repo, board)
+	mustPublish(t, peer.repo, board)
+
+	r := authDeleteRequest(key, privkey, "", "")
+	nonce, _, err := server.challenges.Issue(key, remoteHost(r), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Spring-Auth", SpringAuth(privkey, nonce))
+	if w := serve(server, r); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE with Spring-Auth got %d: %s", w.Code, w.Body.String())
+	}
+	if stored, _ := server.repo.GetBoard(key); stored != nil {
+		t.Errorf("Board is still stored after DELETE")
+	}
+	if err := server.repo.PublishBoard(board); !errors.Is(err, ErrStaleBoard) {
+		t.Errorf("Storing the deleted board again got %v, want ErrStaleBoard", err)
+	}
+	waitFor(t, 5*time.Second, "the peer to delete the board", func() bool {
+		stored, err := peer.repo.GetBoard(key)
+		return err == nil && stored == nil
+	})
+	if err := peer.repo.PublishBoard(board); !errors.Is(err, ErrStaleBoard) {
+		t.Errorf("Storing the deleted board on the peer again got %v, want ErrStaleBoard", err)
+	}
+}
+
+func TestRelayedAuthDeletionChecks(t *testing.T) {
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := hex.EncodeToString(pubkey)
+	_, otherPrivkey, _ := ed25519.GenerateKey(nil)
+	now := time.Now()
+	// A nonce another server issued, which this one can't redeem.
+	foreign := func(issuedAt time.Time) string {
+		return fmt.Sprintf("%d.%064x", issuedAt.Unix(), 1)
+	}
+
+	for _, test := range []struct {
+		name    string
+		request *http.Request
+		want    int
+	}{
+		{"without a Via header", authDeleteRequest(key, privkey, foreign(now), ""), http.StatusForbidden},
+		{"signed by another key", authDeleteRequest(key, otherPrivkey, foreign(now), "1.1 peer.example"), http.StatusForbidden},
+		{"issued too long ago", authDeleteRequest(key, privkey, foreign(now.Add(-relayedChallengeTTL-time.Minute)), "1.1 peer.example"), http.StatusForbidden},
+		{"issued in the future", authDeleteRequest(key, privkey, foreign(now.Add(time.Hour)), "1.1 peer.example"), http.StatusForbidden},
+		{"without an issue time", authDeleteRequest(key, privkey, fmt.Sprintf("%064x", 1), "1.1 peer.example"), http.StatusForbidden},
+		{"relayed", authDeleteRequest(key, privkey, foreign(now.Add(-time.Hour)), "1.1 peer.example"), http.StatusNoContent},
+	} {
+		server := newTestServer(t, ServerConfig{})
+		older := testBoard(key, now.Add(-2*time.Hour), "<p>older</p>")
+		newer := testBoard(testKey(2), now, "<p>someone else</p>")
+		mustPublish(t, server.repo, older)
+		mustPublish(t, server.repo, newer)
+
+		if w := serve(server, test.request); w.Code != test.want {
+			t.Errorf("A deletion %s got %d, want %d: %s", test.name, w.Code, test.want, w.Body.String())
+		}
+		stored, _ := server.repo.GetBoard(key)
+		if deleted := stored == nil; deleted != (test.want == http.StatusNoContent) {
+			t.Errorf("A deletion %s left the board stored: %t", test.name, !deleted)
+		}
+	}
+
+	// The nonce's issue time stands in for a tombstone's, so a relayed
+	// deletion leaves a board published since alone.
+	server := newTestServer(t, ServerConfig{})
+	mustPublish(t, server.repo, testBoard(key, now.Add(-time.Minute), "<p>republished</p>"))
+	if w := serve(server, authDeleteRequest(key, privkey, foreign(now.Add(-time.Hour)), "1.1 peer.example")); w.Code != http.StatusConflict {
+		t.Errorf("A relayed deletion older than the board got %d, want 409", w.Code)
+	}
+}
@@ -1,14 +1,186 @@
 package springboard
 
-import "time"
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 type Board struct {
 	Key       string
 	Board     string
 	Modified  time.Time
 	Signature string
+	// ContentType is the Content-Type the board was published with, which
+	// is served and relayed with it. Empty means DefaultContentType.
+	ContentType string
+}
+
+// DefaultContentType is the Content-Type of boards published without one.
+const DefaultContentType = "text/html;charset=utf-8"
+
+// contentTypeOrDefault returns contentType, or DefaultContentType if it's
+// empty.
+func contentTypeOrDefault(contentType string) string {
+	if contentType == "" {
+		return DefaultContentType
+	}
+	return contentType
+}
+
+// MediaType returns the board's Content-Type, or DefaultContentType if it
+// wasn't published with one.
+func (board Board) MediaType() string {
+	return contentTypeOrDefault(board.ContentType)
+}
+
+// BoardMeta is what's stored about a board besides its body, which is all
+// that's needed to answer HEAD and conditional requests.
+type BoardMeta struct {
+	Key         string
+	Modified    time.Time
+	Signature   string
+	ContentType string
+	// ContentHash is the stored body's ContentHash.
+	ContentHash string
 }
 
 func (board Board) ModifiedAtDBFormat() string {
 	return board.Modified.Format(time.RFC3339)
 }
+
+// Bytes returns the board's body, which is what its signature covers.
+func (board Board) Bytes() []byte {
+	return []byte(board.Board)
+}
+
+// ContentHash returns the hex-encoded SHA-256 hash of the board's body. Two
+// boards with the same hash have the same body, so it's stored alongside
+// the board to compare them without loading either.
+func (board Board) ContentHash() string {
+	hash := sha256.Sum256(board.Bytes())
+	return hex.EncodeToString(hash[:])
+}
+
+// Verify checks that Signature is Key's signature of the board's body.
+func (board Board) Verify() error {
+	signature, err := hex.DecodeString(board.Signature)
+	if err != nil {
+		return invalid(ErrInvalidSignature, "Invalid signature")
+	}
+	return verifyBoardSignature(board.Key, board.Bytes(), signature)
+}
+
+// ParsedTime returns the time in the board's <time> tag, which must appear
+// exactly once. Unlike Modified, it comes from the signed body.
+func (board Board) ParsedTime() (time.Time, error) {
+	return parseTimeTag(board.Bytes())
+}
+
+// scanBoards reads boards from rows selecting key, board, modified,
+// signature, and content type.
+func scanBoards(rows *sql.Rows) ([]Board, error) {
+	boards := []Board{}
+	err := iterateRows(rows, func(board Board) error {
+		boards = append(boards, board)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return boards, nil
+}
+
+// iterateRows calls fn with each board read from rows, selecting the same
+// columns as scanBoards, and closes rows. It stops at the first error fn
+// returns and returns it.
+func iterateRows(rows *sql.Rows, fn func(Board) error) error {
+	defer rows.Close()
+	for rows.Next() {
+		var key, board, modified, signature, contentType string
+
+		err := rows.Scan(&key, &board, &modified, &signature, &contentType)
+		if err != nil {
+			return err
+		}
+
+		modifiedTime, err := time.Parse(time.RFC3339, modified)
+		if err != nil {
+			return err
+		}
+
+		err = fn(Board{
+			Key:         key,
+			Board:       board,
+			Modified:    modifiedTime,
+			Signature:   signature,
+			ContentType: contentType,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+var timeTagAndCloseRegExp = regexp.MustCompile(timeTagRegExp.String() + `(\s*<\s*/\s*time\s*>)?`)
+
+// stripTimeTag removes a board's <time> tags (and their closing tags), leaving
+// the content its author wrote.
+func stripTimeTag(body []byte) []byte {
+	return timeTagAndCloseRegExp.ReplaceAll(body, nil)
+}
+
+// PrepareBoard assembles the board that would be published for content: it
+// prepends a <time> tag for modified (truncated to the second, in UTC), checks
+// the result fits in MaxBoardSize, and signs it with privkey. content must not
+// have a <time> tag of its own, since servers reject boards with more than one.
+func PrepareBoard(content []byte, privkey ed25519.PrivateKey, modified time.Time) (board Board, err error) {
+	if timeTagRegExp.Match(content) {
+		err = invalid(ErrInvalidTimeTag, `Board content already has a <time datetime="..."> tag; remove it and springboard will add one`)
+		return
+	}
+	modified = modified.UTC().Truncate(time.Second)
+	body := append(timeTag(modified), content...)
+	if len(body) > MaxBoardSize {
+		err = invalid(ErrTooLarge, "Board is %d bytes with its time tag, more than %d (its content can be at most %d bytes)", len(body), MaxBoardSize, MaxContentSize)
+		return
+	}
+	signature := ed25519.Sign(privkey, body)
+	pubkey := privkey.Public().(ed25519.PublicKey)
+	board = Board{
+		Key:       hex.EncodeToString(pubkey),
+		Board:     string(body),
+		Modified:  modified,
+		Signature: hex.EncodeToString(signature),
+	}
+	return
+}
+
+// PreviewLength is the most characters Preview returns.
+const PreviewLength = 140
+
+var (
+	invisibleElementsRegExp = regexp.MustCompile(`(?is)<(script|style|template)\b.*?</(script|style|template)\s*>|<!--.*?-->`)
+	tagRegExp               = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// Preview returns the start of the board's visible text, without its tags,
+// for readers and clients that can't show the board itself. Boards without
+// any text have an empty preview.
+func (board Board) Preview() string {
+	text := invisibleElementsRegExp.ReplaceAllString(board.Board, " ")
+	text = tagRegExp.ReplaceAllString(text, " ")
+	text = strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+	if utf8.RuneCountInString(text) <= PreviewLength {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:PreviewLength-1])) + "…"
+}
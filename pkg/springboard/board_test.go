@@ -0,0 +1,140 @@
+package springboard
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestPrepareBoard(t *testing.T) {
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2022, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	board, err := PrepareBoard([]byte("<p>hello</p>"), privkey, modified.Add(300*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if board.Key != hex.EncodeToString(pubkey) {
+		t.Errorf("Board's key is %s, want the private key's public key", board.Key)
+	}
+	if err := board.Verify(); err != nil {
+		t.Errorf("Board's signature doesn't verify: %s", err)
+	}
+	if tags := len(timeTagRegExp.FindAllString(board.Board, -1)); tags != 1 {
+		t.Errorf("Board has %d time tags, want exactly one: %q", tags, board.Board)
+	}
+	if want := `<time datetime="2022-06-01T10:00:00Z"></time><p>hello</p>`; board.Board != want {
+		t.Errorf("Board is %q, want %q", board.Board, want)
+	}
+	if !board.Modified.Equal(modified) || board.Modified.Location() != time.UTC {
+		t.Errorf("Board is modified %s, want %s in UTC", board.Modified, modified)
+	}
+
+	if _, err := PrepareBoard([]byte(board.Board), privkey, modified); !errors.Is(err, ErrInvalidTimeTag) {
+		t.Errorf("Content that already has a time tag got %v, want ErrInvalidTimeTag", err)
+	}
+	if atLimit, err := PrepareBoard([]byte(strings.Repeat("a", MaxContentSize)), privkey, modified); err != nil {
+		t.Errorf("Content of MaxContentSize got %v", err)
+	} else if len(atLimit.Board) != MaxBoardSize {
+		t.Errorf("Content of MaxContentSize makes a %d byte board, want MaxBoardSize", len(atLimit.Board))
+	}
+	if _, err := PrepareBoard([]byte(strings.Repeat("a", MaxContentSize+1)), privkey, modified); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Content over MaxContentSize got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestBoardBytes(t *testing.T) {
+	board := Board{Board: `<time datetime="2022-06-01T10:00:00Z"></time>héllo`}
+	if got := string(board.Bytes()); got != board.Board {
+		t.Errorf("Bytes() is %q, want the body %q", got, board.Board)
+	}
+}
+
+func TestBoardVerify(t *testing.T) {
+	_, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board, err := PrepareBoard([]byte("<p>hello</p>"), privkey, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := board.Verify(); err != nil {
+		t.Errorf("Signed board doesn't verify: %s", err)
+	}
+
+	tampered := board
+	tampered.Board += "<p>more</p>"
+	if err := tampered.Verify(); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Board changed after signing got %v, want ErrInvalidSignature", err)
+	}
+
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey := board
+	wrongKey.Key = hex.EncodeToString(otherKey)
+	if err := wrongKey.Verify(); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Board signed by another key got %v, want ErrInvalidSignature", err)
+	}
+
+	notHex := board
+	notHex.Signature = "not a signature"
+	if err := notHex.Verify(); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Board with a non-hex signature got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestBoardParsedTime(t *testing.T) {
+	modified := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	board := testBoard(testKey(1), modified, "<p>hello</p>")
+	parsed, err := board.ParsedTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Equal(modified) {
+		t.Errorf("ParsedTime() is %s, want %s", parsed, modified)
+	}
+
+	if _, err := (Board{Board: "<p>no time</p>"}).ParsedTime(); !errors.Is(err, ErrInvalidTimeTag) {
+		t.Errorf("Board without a time tag got %v, want ErrInvalidTimeTag", err)
+	}
+	twice := Board{Board: string(timeTag(modified)) + string(timeTag(modified))}
+	if _, err := twice.ParsedTime(); !errors.Is(err, ErrInvalidTimeTag) {
+		t.Errorf("Board with two time tags got %v, want ErrInvalidTimeTag", err)
+	}
+}
+
+func TestBoardPreview(t *testing.T) {
+	modified := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		content string
+		want    string
+	}{
+		{
+			"<style>p { color: red; }</style>\n<h1>Hello,\n  world</h1><!-- note --><p>Fish &amp; chips</p><script>alert(1)</script>",
+			"Hello, world Fish & chips",
+		},
+		{"", ""},
+		{"  \n<br><img src=x>\n", ""},
+	} {
+		board := testBoard(testKey(1), modified, test.content)
+		if preview := board.Preview(); preview != test.want {
+			t.Errorf("Preview of %q is %q, want %q", test.content, preview, test.want)
+		}
+	}
+
+	long := testBoard(testKey(1), modified, "<p>"+strings.Repeat("é", PreviewLength+10)+"</p>")
+	preview := long.Preview()
+	if runes := []rune(preview); len(runes) != PreviewLength || runes[len(runes)-1] != '…' {
+		t.Errorf("Long board's preview is %d characters %q, want %d ending in an ellipsis", len(runes), preview, PreviewLength)
+	}
+}
@@ -2,12 +2,16 @@ package springboard
 
 import (
 	"bytes"
+	"compress/gzip"
 	"crypto/ed25519"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -21,35 +25,250 @@ func fileExists(name string) bool {
 	return true
 }
 
+// OutputLevel controls how much a Client prints while posting boards.
+type OutputLevel int
+
+const (
+	// OutputQuiet prints nothing; failures are only reported as errors.
+	OutputQuiet OutputLevel = iota - 1
+	// OutputNormal prints the URL, signature, and server response.
+	OutputNormal
+	// OutputVerbose additionally prints the full request and response headers.
+	OutputVerbose
+)
+
+// DefaultTimeBuffer is how far a Client backdates boards by default, in case
+// our clock is "fast" and the server is picky about times in the future.
+const DefaultTimeBuffer = 10 * time.Minute
+
+// MaxTimeBuffer is the largest TimeBuffer CheckTimeBuffer allows.
+const MaxTimeBuffer = 24 * time.Hour
+
+// CheckTimeBuffer returns an error if buffer isn't a usable TimeBuffer.
+func CheckTimeBuffer(buffer time.Duration) error {
+	if buffer < 0 {
+		return fmt.Errorf("Time buffer must not be negative")
+	}
+	if buffer > MaxTimeBuffer {
+		return fmt.Errorf("Time buffer must be at most %s", MaxTimeBuffer)
+	}
+	return nil
+}
+
 type Client struct {
 	apiUrl string
+	// Output is the level of detail printed to Writer (defaults to OutputNormal).
+	Output OutputLevel
+	// Writer receives the client's output (defaults to os.Stdout).
+	Writer io.Writer
+	// Gzip compresses boards sent to the server with Content-Encoding: gzip.
+	Gzip bool
+	// TimeBuffer is how far boards are backdated (defaults to
+	// DefaultTimeBuffer).
+	TimeBuffer time.Duration
 }
 
 func NewClient(apiUrl string) (client Client) {
 	client.apiUrl = strings.TrimSuffix(apiUrl, "/")
+	client.TimeBuffer = DefaultTimeBuffer
+	return
+}
+
+func (client Client) printf(level OutputLevel, format string, args ...any) {
+	if client.Output < level {
+		return
+	}
+	writer := client.Writer
+	if writer == nil {
+		writer = os.Stdout
+	}
+	fmt.Fprintf(writer, format, args...)
+}
+
+func (client Client) printHeaders(header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			client.printf(OutputVerbose, "  %s: %s\n", name, value)
+		}
+	}
+}
+
+// IndexEntry is a board listed in a server's /index.json.
+type IndexEntry struct {
+	Key    string    `json:"key"`
+	Posted time.Time `json:"posted"`
+}
+
+// Index is the list of boards a server publishes at /index.json. Error is set
+// when the server had to cut the list short.
+type Index struct {
+	AdminBoard IndexEntry   `json:"adminBoard"`
+	Boards     []IndexEntry `json:"boards"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// GetIndex fetches the server's /index.json.
+func (client Client) GetIndex() (index Index, err error) {
+	resp, err := http.Get(fmt.Sprintf("%s/index.json", client.apiUrl))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MaxBoardSize))
+		err = errorFromResponse(resp.StatusCode, responseBody)
+		return
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return
+	}
+	if index.Error != "" {
+		err = fmt.Errorf("The server's index is incomplete: %s", index.Error)
+	}
+	return
+}
+
+// GetBoard fetches a key's board and its signature from the server, or nil if
+// the server doesn't have one. The board is not validated, and its Modified
+// time is left unset.
+func (client Client) GetBoard(key string) (board *Board, err error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", client.apiUrl, key), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/spring-83")
+	req.Header.Set("Spring-Version", "83")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxBoardSize+1))
+	if err != nil {
+		return
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err = errorFromResponse(resp.StatusCode, responseBody); err != nil {
+		return
+	}
+	board = &Board{
+		Key:         key,
+		Board:       string(responseBody),
+		Signature:   resp.Header.Get("Spring-Signature"),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
 	return
 }
 
-func (client Client) PostSignedBoard(board Board, viaFQDN string) (err error) {
+// FetchTimeout is how long FetchBoardContent waits for a URL to respond.
+const FetchTimeout = 10 * time.Second
+
+// FetchBoardContent downloads a board's HTML from url, e.g. to mirror a page
+// or repost a board from a Spring '83 server. Any <time> tags are removed,
+// since posting adds a fresh one. Content larger than MaxBoardSize is
+// rejected without reading the rest of it.
+func FetchBoardContent(url string) (content []byte, err error) {
+	httpClient := http.Client{Timeout: FetchTimeout}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not fetch %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not fetch %s: %s", url, resp.Status)
+	}
+	content, err = ioutil.ReadAll(io.LimitReader(resp.Body, MaxBoardSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not fetch %s", url)
+	}
+	if len(content) > MaxBoardSize {
+		return nil, invalid(ErrTooLarge, "%s is larger than %d bytes", url, MaxBoardSize)
+	}
+	return stripTimeTag(content), nil
+}
+
+// PostSignedBoard sends a signed board. via lists the servers the board has
+// passed through, oldest first, ending with the one sending it; it's empty
+// when an author posts their own board.
+func (client Client) PostSignedBoard(board Board, via []string) (err error) {
+	return client.sendSignedBoard(http.MethodPut, board, via)
+}
+
+// DeleteSignedBoard sends a signed tombstone (see Tombstone), asking the
+// server to delete the key's board.
+func (client Client) DeleteSignedBoard(tombstone Board, via []string) (err error) {
+	return client.sendSignedBoard(http.MethodDelete, tombstone, via)
+}
+
+// DeleteWithAuth asks the server to delete the key's board, proving
+// ownership of the key with a Spring-Auth header (see SpringAuth) instead of
+// a tombstone.
+func (client Client) DeleteWithAuth(key string, springAuth string, via []string) (err error) {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%s", client.apiUrl, key), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Spring-Auth", springAuth)
+	req.Header.Set("Spring-Version", "83")
+	if len(via) > 0 {
+		req.Header.Set("Via", formatViaChain(via))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	responseBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxBoardSize))
+	if err != nil {
+		return
+	}
+	client.printf(OutputNormal, "%s: %s\n", resp.Status, responseBody)
+	return errorFromResponse(resp.StatusCode, responseBody)
+}
+
+func (client Client) sendSignedBoard(method string, board Board, via []string) (err error) {
 	httpClient := &http.Client{}
 	url := fmt.Sprintf("%s/%s", client.apiUrl, board.Key)
-	fmt.Printf("URL: %s\n", url)
-	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBufferString(board.Board))
+	client.printf(OutputNormal, "URL: %s\n", url)
+	body := board.Bytes()
+	if client.Gzip {
+		if body, err = gzipBody(body); err != nil {
+			return
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
 	if err != nil {
 		return
 	}
+	if client.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 
-	fmt.Printf("Spring-Signature: %s\n", board.Signature)
+	client.printf(OutputNormal, "Spring-Signature: %s\n", board.Signature)
 	req.Header.Set("Spring-Signature", board.Signature)
 
-	dtHTTP := board.Modified.Format(time.RFC1123)
+	// http.TimeFormat is RFC 1123 with the GMT that HTTP requires; formatting
+	// in a loaded zone would need tzdata and could write another zone's name.
+	dtHTTP := board.Modified.UTC().Format(http.TimeFormat)
 	req.Header.Set("If-Unmodified-Since", dtHTTP)
 	req.Header.Set("Spring-Version", "83")
-	req.Header.Set("Content-Type", "text/html;charset=utf-8")
-	if viaFQDN != "" {
-		req.Header.Set("Via", fmt.Sprintf("Spring/83 %s", viaFQDN))
+	req.Header.Set("Content-Type", board.MediaType())
+	if len(via) > 0 {
+		req.Header.Set("Via", formatViaChain(via))
 	}
 
+	client.printf(OutputVerbose, "Request: %s %s\n", req.Method, url)
+	client.printHeaders(req.Header)
+	client.printf(OutputVerbose, "%s\n", board.Board)
+
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return
@@ -61,44 +280,132 @@ func (client Client) PostSignedBoard(board Board, viaFQDN string) (err error) {
 		return
 	}
 
-	fmt.Printf("%s: %s\n", resp.Status, responseBody)
+	client.printf(OutputVerbose, "Response: %s\n", resp.Status)
+	client.printHeaders(resp.Header)
+	client.printf(OutputNormal, "%s: %s\n", resp.Status, responseBody)
+	err = errorFromResponse(resp.StatusCode, responseBody)
 	return
 }
 
+func gzipBody(body []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
 func (client Client) SignAndPostBoard(boardText []byte, keyFolder string) (err error) {
-	pubkey, privkey, err := GetKeys(keyFolder)
+	_, privkey, err := GetKeys(keyFolder)
 	if err != nil {
 		return
 	}
 
-	gmt, err := time.LoadLocation("Etc/GMT")
+	return client.signAndPostBoard(boardText, privkey, client.backdate(time.Now()))
+}
+
+// backdate returns the time to date a board posted at now: TimeBuffer
+// earlier, in time.UTC rather than a loaded zone, so that posting works
+// without tzdata, e.g. in minimal containers.
+func (client Client) backdate(now time.Time) time.Time {
+	return now.Add(-client.TimeBuffer).UTC()
+}
+
+// SignAndPostBoardAt is like SignAndPostBoard, but dates the board at
+// modified instead of now, e.g. to republish an archived board. modified
+// can't be in the future.
+func (client Client) SignAndPostBoardAt(boardText []byte, keyFolder string, modified time.Time) (err error) {
+	modified = modified.UTC().Truncate(time.Second)
+	if modified.After(time.Now()) {
+		return fmt.Errorf("Modified time %s is in the future", modified.Format(time.RFC3339))
+	}
+	_, privkey, err := GetKeys(keyFolder)
 	if err != nil {
-		panic(err)
+		return
 	}
-	buffer, _ := time.ParseDuration("10m") // in case our computer is "fast" and the other computer is picky
-	dt := time.Now().Add(-buffer).In(gmt)
-	dtISO8601 := dt.Format("2006-01-02T15:04:05Z")
-	boardText = append([]byte(fmt.Sprintf(`<time datetime="%s"></time>`, dtISO8601)), boardText...)
+	return client.signAndPostBoard(boardText, privkey, modified)
+}
 
-	if len(boardText) == 0 {
-		err = fmt.Errorf("input required")
+// signAndPostBoard prepends a <time> tag for modified to boardText, signs it,
+// and posts it.
+func (client Client) signAndPostBoard(boardText []byte, privkey ed25519.PrivateKey, modified time.Time) (err error) {
+	board, err := PrepareBoard(boardText, privkey, modified)
+	if err == nil {
+		sig, _ := hex.DecodeString(board.Signature)
+		err = ValidateBoard(board.Key, board.Bytes(), sig, time.Now())
+	}
+	if err != nil {
+		err = errors.Wrap(err, "Board is not valid")
+		return
+	}
+	err = client.PostSignedBoard(board, nil)
+	if err != nil {
+		err = errors.Wrap(err, "Could not post board")
+		return
+	}
+	return
+}
+
+// SignAndAppendToBoard is like SignAndPostBoard, but adds boardText to the end
+// of the key's current board on the server instead of replacing it.
+func (client Client) SignAndAppendToBoard(boardText []byte, keyFolder string) (err error) {
+	pubkey, privkey, err := GetKeys(keyFolder)
+	if err != nil {
 		return
 	}
-	if len(boardText) > 2217 {
-		err = fmt.Errorf("input body too long")
+	content, err := client.appendToCurrentBoard(hex.EncodeToString(pubkey), boardText)
+	if err != nil {
 		return
 	}
 
-	sig := ed25519.Sign(privkey, boardText)
-	err = client.PostSignedBoard(Board{
+	return client.signAndPostBoard(content, privkey, client.backdate(time.Now()))
+}
+
+// appendToCurrentBoard fetches key's board from the server, checks its
+// signature, and returns its content without its <time> tag followed by
+// boardText. A key without a board gets boardText alone.
+func (client Client) appendToCurrentBoard(key string, boardText []byte) (content []byte, err error) {
+	current, err := client.GetBoard(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not fetch the current board")
+	}
+	if current == nil {
+		return boardText, nil
+	}
+	if err = current.Verify(); err != nil {
+		return nil, errors.Wrap(err, "The current board doesn't match its signature")
+	}
+	content = append(stripTimeTag(current.Bytes()), boardText...)
+	if len(content) > MaxContentSize {
+		return nil, invalid(ErrTooLarge, "Appending %d bytes to the current board would make its content %d bytes, more than %d", len(boardText), len(content), MaxContentSize)
+	}
+	return content, nil
+}
+
+// SignAndDeleteBoard signs a tombstone with the key pair in keyFolder and
+// sends it, deleting the key's board from the server and its federates.
+func (client Client) SignAndDeleteBoard(keyFolder string) (err error) {
+	pubkey, privkey, err := GetKeys(keyFolder)
+	if err != nil {
+		return
+	}
+
+	dt := client.backdate(time.Now())
+	tombstone := Tombstone(dt)
+
+	sig := ed25519.Sign(privkey, tombstone)
+	err = client.DeleteSignedBoard(Board{
 		Key:       hex.EncodeToString(pubkey),
-		Board:     string(boardText[:]),
+		Board:     string(tombstone),
 		Modified:  dt,
 		Signature: hex.EncodeToString(sig),
-	}, "")
+	}, nil)
 	if err != nil {
-		err = errors.Wrap(err, "Could not post board")
-		return
+		err = errors.Wrap(err, "Could not delete board")
 	}
 	return
 }
@@ -0,0 +1,305 @@
+package springboard
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestClientOutputLevels(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stored"))
+	}))
+	defer stub.Close()
+	board := testBoard(testKey(1), time.Now(), "<p>hi</p>")
+
+	var output bytes.Buffer
+	client := NewClient(stub.URL)
+	client.Writer = &output
+	client.Output = OutputQuiet
+	if err := client.PostSignedBoard(board, nil); err != nil {
+		t.Fatal(err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("Quiet client printed %q", output.String())
+	}
+
+	client.Output = OutputVerbose
+	if err := client.PostSignedBoard(board, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Spring-Signature: " + board.Signature, "Request: PUT", board.Board, "Response: 200 OK"} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("Verbose output doesn't include %q:\n%s", want, output.String())
+		}
+	}
+}
+
+func TestClientBackdatesByTimeBuffer(t *testing.T) {
+	_, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	for _, buffer := range []time.Duration{0, DefaultTimeBuffer, 2 * time.Hour} {
+		client := NewClient("http://localhost")
+		client.TimeBuffer = buffer
+		board, err := PrepareBoard([]byte("<p>hi</p>"), privkey, client.backdate(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := now.Add(-buffer)
+		if !strings.HasPrefix(board.Board, string(timeTag(want))) || !board.Modified.Equal(want) {
+			t.Errorf("With a %s buffer, the board is %q, want it dated %s", buffer, board.Board, want.Format(time.RFC3339))
+		}
+	}
+
+	for _, buffer := range []time.Duration{-time.Second, MaxTimeBuffer + time.Second} {
+		if err := CheckTimeBuffer(buffer); err == nil {
+			t.Errorf("Allowed a time buffer of %s", buffer)
+		}
+	}
+	if err := CheckTimeBuffer(MaxTimeBuffer); err != nil {
+		t.Errorf("Rejected the maximum time buffer: %s", err)
+	}
+}
+
+// capturedPut is a board a client PUT to a stub server.
+type capturedPut struct {
+	body              string
+	ifUnmodifiedSince string
+	via               string
+	contentType       string
+}
+
+// newCapturingServer is a stub server that accepts every PUT and sends it on
+// the returned channel.
+func newCapturingServer(t *testing.T) (*httptest.Server, <-chan capturedPut) {
+	puts := make(chan capturedPut, 10)
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		puts <- capturedPut{readAll(t, r.Body), r.Header.Get("If-Unmodified-Since"), r.Header.Get("Via"), r.Header.Get("Content-Type")}
+	}))
+	t.Cleanup(stub.Close)
+	return stub, puts
+}
+
+func TestPostingAtExplicitModifiedTime(t *testing.T) {
+	stub, puts := newCapturingServer(t)
+	client := NewClient(stub.URL)
+	client.Output = OutputQuiet
+
+	// SignAndPostBoardAt checks the key's 83eMMYY suffix before posting, so
+	// this posts what it prepares with a key that doesn't have one.
+	_, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	board, err := PrepareBoard([]byte("<p>archived</p>"), privkey, modified.Add(500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PostSignedBoard(board, nil); err != nil {
+		t.Fatal(err)
+	}
+	posted := <-puts
+	if want := `<time datetime="2022-06-01T12:00:00Z"></time><p>archived</p>`; posted.body != want {
+		t.Errorf("Posted %q, want %q", posted.body, want)
+	}
+	if posted.ifUnmodifiedSince != "Wed, 01 Jun 2022 12:00:00 GMT" {
+		t.Errorf("Posted with If-Unmodified-Since %q, want the modified time", posted.ifUnmodifiedSince)
+	}
+	if err := board.Verify(); err != nil {
+		t.Errorf("Signature over the dated body doesn't verify: %s", err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	if err := client.SignAndPostBoardAt([]byte("<p>later</p>"), t.TempDir(), future); err == nil || !strings.Contains(err.Error(), "in the future") {
+		t.Errorf("Posting at a future time got %v", err)
+	}
+	select {
+	case put := <-puts:
+		t.Errorf("Posted a board dated in the future: %q", put.body)
+	default:
+	}
+}
+
+func TestFetchBoardContentFromURL(t *testing.T) {
+	pages := map[string]string{
+		"/board.html":    `<time datetime="2022-06-01T12:00:00Z"></time><p>mirrored</p>`,
+		"/too-long.html": strings.Repeat("a", MaxBoardSize+1),
+	}
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, found := pages[r.URL.Path]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer source.Close()
+
+	content, err := FetchBoardContent(source.URL + "/board.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "<p>mirrored</p>" {
+		t.Errorf("Fetched %q, want the page without its time tag", content)
+	}
+	_, privkey, _ := ed25519.GenerateKey(nil)
+	board, err := PrepareBoard(content, privkey, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(board.Board, "<p>mirrored</p>") || board.Verify() != nil {
+		t.Errorf("Signed board %q isn't the fetched content", board.Board)
+	}
+
+	if _, err := FetchBoardContent(source.URL + "/too-long.html"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Fetching an oversized page got %v, want ErrTooLarge", err)
+	}
+	if _, err := FetchBoardContent(source.URL + "/missing.html"); err == nil {
+		t.Errorf("Fetching a missing page succeeded")
+	}
+}
+
+func TestTimeTagIsUTCInAnyZone(t *testing.T) {
+	_, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fixed zones never touch the zone database, so this is what a host
+	// without tzdata sees. Both cross the date line from UTC.
+	instant := time.Date(2022, 6, 1, 1, 30, 0, 0, time.UTC)
+	for _, zone := range []*time.Location{time.FixedZone("LINT", 14*60*60), time.FixedZone("SST", -11*60*60)} {
+		local := instant.In(zone)
+		board, err := PrepareBoard([]byte("<p>hi</p>"), privkey, local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `<time datetime="2022-06-01T01:30:00Z"></time><p>hi</p>`; board.Board != want {
+			t.Errorf("Prepared at %s got %q, want %q", local, board.Board, want)
+		}
+		if tombstone, want := string(Tombstone(local)), `<time datetime="2022-06-01T01:30:00Z"></time>`; tombstone != want {
+			t.Errorf("Tombstone at %s is %q, want %q", local, tombstone, want)
+		}
+	}
+}
+
+func TestPostedHeaderAndTimeTagAreUTC(t *testing.T) {
+	stub, puts := newCapturingServer(t)
+	client := NewClient(stub.URL)
+	client.Output = OutputQuiet
+
+	_, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2022, 6, 1, 5, 0, 0, 0, time.FixedZone("IST", 5*60*60+30*60))
+	board, err := PrepareBoard([]byte("<p>hi</p>"), privkey, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PostSignedBoard(board, nil); err != nil {
+		t.Fatal(err)
+	}
+	posted := <-puts
+	if want := "Tue, 31 May 2022 23:30:00 GMT"; posted.ifUnmodifiedSince != want {
+		t.Errorf("Posted with If-Unmodified-Since %q, want %q", posted.ifUnmodifiedSince, want)
+	}
+	if want := `<time datetime="2022-05-31T23:30:00Z"></time>`; !strings.HasPrefix(posted.body, want) {
+		t.Errorf("Posted %q, want it to start with %q", posted.body, want)
+	}
+}
+
+// newBoardServer returns a server answering GETs with board, as a springboard
+// server would.
+func newBoardServer(t *testing.T, board Board) *httptest.Server {
+	t.Helper()
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Board server got a %s", r.Method)
+		}
+		if r.URL.Path != "/"+board.Key {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Spring-Signature", board.Signature)
+		w.Write([]byte(board.Board))
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func TestAppendingToCurrentBoard(t *testing.T) {
+	_, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	current, err := PrepareBoard([]byte("<p>hello</p>"), privkey, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(newBoardServer(t, current).URL)
+
+	content, err := client.appendToCurrentBoard(current.Key, []byte("<p>more</p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "<p>hello</p><p>more</p>" {
+		t.Errorf("Appended content is %q, want the current content without its time tag, then the new text", content)
+	}
+	appended, err := PrepareBoard(content, privkey, modified.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Appended content can't be posted: %s", err)
+	}
+	if want := `<time datetime="2022-06-01T12:01:00Z"></time><p>hello</p><p>more</p>`; appended.Board != want {
+		t.Errorf("Appended board is %q, want %q", appended.Board, want)
+	}
+
+	otherKey := strings.Repeat("0", 64)
+	if content, err := client.appendToCurrentBoard(otherKey, []byte("<p>first</p>")); err != nil || string(content) != "<p>first</p>" {
+		t.Errorf("Appending for a key without a board got %q (%v), want the new text alone", content, err)
+	}
+
+	tampered := current
+	tampered.Board = strings.Replace(current.Board, "hello", "jello", 1)
+	client = NewClient(newBoardServer(t, tampered).URL)
+	if _, err := client.appendToCurrentBoard(tampered.Key, []byte("<p>more</p>")); err == nil || !strings.Contains(err.Error(), "doesn't match its signature") {
+		t.Errorf("Appending to a board that doesn't verify got %v", err)
+	}
+}
+
+func TestAppendingBeyondSizeLimit(t *testing.T) {
+	keyFolder := t.TempDir()
+	for name, key := range map[string]string{"key.pub": suffixedKeyPub, "key.priv": suffixedKeyPriv} {
+		if err := os.WriteFile(filepath.Join(keyFolder, name), []byte(key), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	privkey, _ := hex.DecodeString(suffixedKeyPriv)
+	current, err := PrepareBoard([]byte(strings.Repeat("a", MaxContentSize-10)), privkey, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(newBoardServer(t, current).URL)
+	client.Output = OutputQuiet
+
+	if content, err := client.appendToCurrentBoard(current.Key, []byte(strings.Repeat("b", 10))); err != nil || len(content) != MaxContentSize {
+		t.Errorf("Appending up to the limit got %d bytes (%v), want %d", len(content), err, MaxContentSize)
+	}
+	// The board server fails the test if anything is posted to it.
+	if err := client.SignAndAppendToBoard([]byte(strings.Repeat("b", 11)), keyFolder); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Appending past the limit got %v, want ErrTooLarge", err)
+	}
+}
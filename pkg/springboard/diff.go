@@ -0,0 +1,60 @@
+package springboard
+
+import (
+	"sort"
+	"time"
+)
+
+// IndexDiff is how the boards listed by two servers' indexes differ. Admin
+// boards aren't compared, since each server has its own.
+type IndexDiff struct {
+	OnlyInA []string
+	OnlyInB []string
+	// Modified lists keys both servers have but with different modified
+	// times.
+	Modified []ModifiedDiff
+}
+
+// ModifiedDiff is a key whose board has a different modified time on each
+// server.
+type ModifiedDiff struct {
+	Key string
+	A   time.Time
+	B   time.Time
+}
+
+// DiffIndexes compares the boards in two indexes. Keys in each list are
+// sorted.
+func DiffIndexes(a Index, b Index) (diff IndexDiff) {
+	postedOnB := map[string]time.Time{}
+	for _, entry := range b.Boards {
+		postedOnB[entry.Key] = entry.Posted
+	}
+	onA := map[string]bool{}
+	for _, entry := range a.Boards {
+		onA[entry.Key] = true
+		postedB, found := postedOnB[entry.Key]
+		if !found {
+			diff.OnlyInA = append(diff.OnlyInA, entry.Key)
+		} else if !entry.Posted.Equal(postedB) {
+			diff.Modified = append(diff.Modified, ModifiedDiff{Key: entry.Key, A: entry.Posted, B: postedB})
+		}
+	}
+	for _, entry := range b.Boards {
+		if !onA[entry.Key] {
+			diff.OnlyInB = append(diff.OnlyInB, entry.Key)
+		}
+	}
+
+	sort.Strings(diff.OnlyInA)
+	sort.Strings(diff.OnlyInB)
+	sort.Slice(diff.Modified, func(i, j int) bool {
+		return diff.Modified[i].Key < diff.Modified[j].Key
+	})
+	return
+}
+
+// Diverged reports whether the two servers have different boards.
+func (diff IndexDiff) Diverged() bool {
+	return len(diff.OnlyInA) > 0 || len(diff.OnlyInB) > 0 || len(diff.Modified) > 0
+}
@@ -0,0 +1,51 @@
+package springboard
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fetchIndex gets a server's index as the diff command does.
+func fetchIndex(t *testing.T, url string) Index {
+	t.Helper()
+	index, err := NewClient(url).GetIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestDiffIndexes(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	shared := testBoard(testKey(1), now, "on both")
+	onlyA := testBoard(testKey(2), now, "only on A")
+	onlyB := testBoard(testKey(3), now, "only on B")
+	changedOnA := testBoard(testKey(4), now.Add(-time.Hour), "older")
+	changedOnB := testBoard(testKey(4), now, "newer")
+
+	a := newStubPeer(t, []Board{shared, onlyA, changedOnA})
+	b := newStubPeer(t, []Board{changedOnB, onlyB, shared})
+	diff := DiffIndexes(fetchIndex(t, a.URL), fetchIndex(t, b.URL))
+	if !reflect.DeepEqual(diff.OnlyInA, []string{onlyA.Key}) || !reflect.DeepEqual(diff.OnlyInB, []string{onlyB.Key}) {
+		t.Errorf("Overlapping servers diffed as only %v on A and %v on B", diff.OnlyInA, diff.OnlyInB)
+	}
+	if len(diff.Modified) != 1 || diff.Modified[0].Key != changedOnA.Key ||
+		!diff.Modified[0].A.Equal(changedOnA.Modified) || !diff.Modified[0].B.Equal(changedOnB.Modified) {
+		t.Errorf("Overlapping servers diffed as modified %+v, want %s changed", diff.Modified, changedOnA.Key)
+	}
+	if !diff.Diverged() {
+		t.Errorf("Overlapping servers didn't diverge")
+	}
+
+	disjoint := newStubPeer(t, []Board{onlyB})
+	diff = DiffIndexes(fetchIndex(t, newStubPeer(t, []Board{shared, onlyA}).URL), fetchIndex(t, disjoint.URL))
+	if !reflect.DeepEqual(diff.OnlyInA, []string{shared.Key, onlyA.Key}) || !reflect.DeepEqual(diff.OnlyInB, []string{onlyB.Key}) || len(diff.Modified) != 0 {
+		t.Errorf("Disjoint servers diffed as %+v", diff)
+	}
+
+	same := newStubPeer(t, []Board{shared, onlyA})
+	if diff := DiffIndexes(fetchIndex(t, same.URL), fetchIndex(t, same.URL)); diff.Diverged() {
+		t.Errorf("A server diverged from itself: %+v", diff)
+	}
+}
@@ -0,0 +1,77 @@
+package springboard
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Errors returned by Client when a server rejects a board. Callers can branch
+// on them with errors.Is; the returned error also carries the server's status
+// and response body.
+var (
+	ErrOldContent       = errors.New("old content")
+	ErrKeyExpired       = errors.New("key has expired")
+	ErrInvalidKey       = errors.New("invalid key")
+	ErrTooLarge         = errors.New("board too large")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrInvalidTimeTag   = errors.New("missing or invalid time tag")
+	ErrKeyDenied        = errors.New("key denied")
+	ErrDifficulty       = errors.New("key greater than difficulty threshold")
+	ErrForbidden        = errors.New("forbidden")
+	ErrBadRequest       = errors.New("bad request")
+	// ErrUnsupportedMediaType is a board sent with a Content-Type other
+	// than text/html.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrServerError          = errors.New("server error")
+	ErrUnexpectedStatus     = errors.New("unexpected response status")
+)
+
+// errorFromResponse maps a server's response to one of the typed errors above,
+// or nil if the response indicates success.
+func errorFromResponse(statusCode int, body []byte) error {
+	if statusCode >= 200 && statusCode < 300 {
+		return nil
+	}
+
+	message := strings.TrimSpace(string(body))
+	lowerMessage := strings.ToLower(message)
+
+	var kind error
+	switch {
+	case statusCode == http.StatusConflict:
+		kind = ErrOldContent
+	case statusCode == http.StatusRequestEntityTooLarge:
+		kind = ErrTooLarge
+	case statusCode == http.StatusUnsupportedMediaType:
+		kind = ErrUnsupportedMediaType
+	case statusCode == http.StatusUnauthorized:
+		kind = ErrKeyDenied
+	case statusCode == http.StatusForbidden && strings.Contains(lowerMessage, "threshold"):
+		kind = ErrDifficulty
+	case statusCode == http.StatusForbidden:
+		kind = ErrForbidden
+	case statusCode == http.StatusBadRequest && strings.Contains(lowerMessage, "expired"):
+		kind = ErrKeyExpired
+	case statusCode == http.StatusBadRequest && strings.Contains(lowerMessage, "signature"):
+		if strings.Contains(message, "83eMMYY") {
+			kind = ErrInvalidKey
+		} else {
+			kind = ErrInvalidSignature
+		}
+	case statusCode == http.StatusBadRequest && (strings.Contains(lowerMessage, "<time") || strings.Contains(lowerMessage, "date")):
+		kind = ErrInvalidTimeTag
+	case statusCode == http.StatusBadRequest && strings.Contains(lowerMessage, "key"):
+		kind = ErrInvalidKey
+	case statusCode == http.StatusBadRequest:
+		kind = ErrBadRequest
+	case statusCode >= 500:
+		kind = ErrServerError
+	default:
+		kind = ErrUnexpectedStatus
+	}
+
+	return errors.Wrap(kind, fmt.Sprintf("%d %s: %s", statusCode, http.StatusText(statusCode), message))
+}
@@ -0,0 +1,53 @@
+package springboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestClientMapsResponsesToTypedErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusConflict, "Old content", ErrOldContent},
+		{http.StatusRequestEntityTooLarge, "Board is larger than 2217 bytes", ErrTooLarge},
+		{http.StatusUnsupportedMediaType, "Unsupported Content-Type", ErrUnsupportedMediaType},
+		{http.StatusUnauthorized, "The test key can't publish boards", ErrKeyDenied},
+		{http.StatusForbidden, "Key greater than threshold", ErrDifficulty},
+		{http.StatusForbidden, "Board contains content this server doesn't accept", ErrForbidden},
+		{http.StatusBadRequest, "Key has expired", ErrKeyExpired},
+		{http.StatusBadRequest, "Signature must end with 83eMMYY", ErrInvalidKey},
+		{http.StatusBadRequest, "Invalid signature", ErrInvalidSignature},
+		{http.StatusBadRequest, "Missing <time> tag", ErrInvalidTimeTag},
+		{http.StatusBadRequest, "Invalid key", ErrInvalidKey},
+		{http.StatusBadRequest, "Empty board", ErrBadRequest},
+		{http.StatusInternalServerError, "internal error", ErrServerError},
+		{http.StatusTeapot, "", ErrUnexpectedStatus},
+	}
+	for _, test := range tests {
+		stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, test.body, test.status)
+		}))
+		client := NewClient(stub.URL)
+		client.Output = OutputQuiet
+		err := client.PostSignedBoard(testBoard(testKey(1), time.Now(), "hi"), nil)
+		stub.Close()
+		if !errors.Is(err, test.want) {
+			t.Errorf("%d %q: got %v, want %v", test.status, test.body, err, test.want)
+		}
+	}
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer stub.Close()
+	client := NewClient(stub.URL)
+	client.Output = OutputQuiet
+	if err := client.PostSignedBoard(testBoard(testKey(1), time.Now(), "hi"), nil); err != nil {
+		t.Errorf("200 OK: got %v, want no error", err)
+	}
+}
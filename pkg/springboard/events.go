@@ -0,0 +1,215 @@
+package springboard
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType is what happened in a ServerEvent.
+type EventType string
+
+const (
+	// EventPublished means a board was published on the server.
+	EventPublished EventType = "published"
+	// EventPropagated means a federate accepted a board relayed to it.
+	EventPropagated EventType = "propagated"
+	// EventDeleted means a board was deleted by its owner.
+	EventDeleted EventType = "deleted"
+	// EventPurged means boards were purged, by TTL, key expiry, or
+	// POST /admin/purge-all.
+	EventPurged EventType = "purged"
+)
+
+// ServerEvent is something that happened on the server, as streamed by
+// GET /events.
+type ServerEvent struct {
+	Type EventType `json:"type"`
+	At   time.Time `json:"at"`
+	// Key is the board's key, unless several boards were purged at once.
+	Key      string     `json:"key,omitempty"`
+	Modified *time.Time `json:"modified,omitempty"`
+	// Destination is the federate a propagated board was relayed to.
+	Destination string `json:"destination,omitempty"`
+	// Count is how many boards were purged at once.
+	Count int `json:"count,omitempty"`
+}
+
+// eventSubscriberBuffer is how many events may wait for a slow subscriber.
+// Events beyond it are dropped for that subscriber rather than holding up
+// the server.
+const eventSubscriberBuffer = 64
+
+// eventKeepAlive is how often an idle event stream gets a comment, so
+// proxies don't close it.
+const eventKeepAlive = 30 * time.Second
+
+// eventBroker hands events to every subscribed event stream.
+type eventBroker struct {
+	mutex       sync.Mutex
+	subscribers map[chan ServerEvent]bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: map[chan ServerEvent]bool{}}
+}
+
+// Subscribe returns a channel receiving events from now on, and a function
+// to call when done with it.
+func (broker *eventBroker) Subscribe() (events <-chan ServerEvent, unsubscribe func()) {
+	channel := make(chan ServerEvent, eventSubscriberBuffer)
+	broker.mutex.Lock()
+	broker.subscribers[channel] = true
+	broker.mutex.Unlock()
+	return channel, func() {
+		broker.mutex.Lock()
+		delete(broker.subscribers, channel)
+		broker.mutex.Unlock()
+	}
+}
+
+// Publish sends event to each subscriber that has room for it.
+func (broker *eventBroker) Publish(event ServerEvent) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	for subscriber := range broker.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// boardEvent returns an event about board.
+func boardEvent(eventType EventType, board Board) ServerEvent {
+	event := ServerEvent{Type: eventType, At: time.Now().UTC(), Key: board.Key}
+	if !board.Modified.IsZero() {
+		modified := board.Modified
+		event.Modified = &modified
+	}
+	return event
+}
+
+// streamEvents streams server events to the owner of the admin board as
+// server-sent events, until the client disconnects.
+func (s *Spring83Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Could not encode event: %s", err)
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// getChallenge fetches a nonce for key from the server's /<key>/challenge.
+func (client Client) getChallenge(key string) (nonce string, err error) {
+	resp, err := http.Get(fmt.Sprintf("%s/%s/challenge", client.apiUrl, key))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MaxBoardSize))
+		err = errorFromResponse(resp.StatusCode, responseBody)
+		return
+	}
+	var challenge struct {
+		Nonce string `json:"nonce"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&challenge)
+	return challenge.Nonce, err
+}
+
+// StreamEvents authenticates as the admin board's owner with the key pair in
+// keyFolder and calls fn with each event the server streams from /events,
+// until the stream ends or fn returns an error.
+func (client Client) StreamEvents(keyFolder string, fn func(ServerEvent) error) (err error) {
+	pubkey, privkey, err := GetKeys(keyFolder)
+	if err != nil {
+		return
+	}
+	return client.streamEvents(hex.EncodeToString(pubkey), privkey, fn)
+}
+
+func (client Client) streamEvents(key string, privkey ed25519.PrivateKey, fn func(ServerEvent) error) (err error) {
+	nonce, err := client.getChallenge(key)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/events", client.apiUrl), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Spring-Auth", SpringAuth(privkey, nonce))
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MaxBoardSize))
+		return errorFromResponse(resp.StatusCode, responseBody)
+	}
+
+	// Each event is a block of lines ending with a blank one. Only the data
+	// lines matter; the event line repeats the type in the data.
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data := strings.TrimPrefix(scanner.Text(), "data: ")
+		if data == scanner.Text() {
+			continue
+		}
+		var event ServerEvent
+		if err = json.Unmarshal([]byte(data), &event); err != nil {
+			return
+		}
+		if err = fn(event); err != nil {
+			return
+		}
+	}
+	return scanner.Err()
+}
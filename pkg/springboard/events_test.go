@@ -0,0 +1,70 @@
+package springboard
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// subscriberCount returns how many event streams the broker is feeding.
+func (broker *eventBroker) subscriberCount() int {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	return len(broker.subscribers)
+}
+
+func TestStreamEventsReceivesPublish(t *testing.T) {
+	// The admin key only becomes valid in 2053, so the horizon is relaxed
+	// for the challenge to accept it.
+	server := newTestServer(t, ServerConfig{AdminBoard: suffixedKeyPub, MaxExpiryHorizon: 40 * 365 * 24 * time.Hour})
+	stub := httptest.NewServer(server.Handler())
+	t.Cleanup(stub.Close)
+	privkey, err := hex.DecodeString(suffixedKeyPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errStop := errors.New("stop")
+	received := make(chan ServerEvent, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewClient(stub.URL).streamEvents(suffixedKeyPub, privkey, func(event ServerEvent) error {
+			received <- event
+			if event.Type == EventPublished {
+				return errStop
+			}
+			return nil
+		})
+	}()
+	waitFor(t, 5*time.Second, "the event stream", func() bool { return server.events.subscriberCount() == 1 })
+
+	board := testBoard(testKey(1), time.Now().Truncate(time.Second), "<p>hello</p>")
+	if w := put(server, board); w.Code != http.StatusOK {
+		t.Fatalf("PUT got %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, errStop) {
+			t.Fatalf("Streaming events got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No publish event arrived")
+	}
+	event := <-received
+	if event.Type != EventPublished || event.Key != board.Key || event.Modified == nil || !event.Modified.Equal(board.Modified) {
+		t.Errorf("Got event %+v, want the board's publication", event)
+	}
+
+	// Closing the stream ends the handler and its subscription.
+	waitFor(t, 5*time.Second, "the subscription to end", func() bool { return server.events.subscriberCount() == 0 })
+}
+
+func TestStreamEventsRequiresAdmin(t *testing.T) {
+	server, _ := newAdminServer(t)
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "/events", nil)); w.Code != http.StatusForbidden {
+		t.Errorf("GET /events without Spring-Auth got %d, want 403", w.Code)
+	}
+}
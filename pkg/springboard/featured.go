@@ -0,0 +1,102 @@
+package springboard
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// MaxFeaturedBoards is the most boards the admin may feature.
+const MaxFeaturedBoards = 100
+
+// featuredBoards is the body of GET and POST /admin/featured.
+type featuredBoards struct {
+	Keys []string `json:"keys"`
+}
+
+// scanKeys reads keys from rows selecting a single key column.
+func scanKeys(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// featured serves /admin/featured to the owner of the admin board. GET
+// returns the featured boards' keys in order. POST replaces them with the
+// keys in its body, e.g. {"keys": ["<key>", ...]}, and an empty list clears
+// them.
+func (s *Spring83Server) featured(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		if !s.setFeatured(w, r) {
+			return
+		}
+	}
+
+	keys, err := s.repo.GetFeaturedKeys()
+	if err != nil {
+		log.Printf("Error in featured: %s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	response, err := json.Marshal(featuredBoards{keys})
+	if err != nil {
+		log.Printf("Error in featured: %s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(response)
+}
+
+// setFeatured stores the featured boards' keys from a POST body, responding
+// with an error and returning false if they aren't valid.
+func (s *Spring83Server) setFeatured(w http.ResponseWriter, r *http.Request) bool {
+	var request featuredBoards
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFormSize)).Decode(&request); err != nil {
+		http.Error(w, "Expecting a JSON body like {\"keys\": [...]}", http.StatusBadRequest)
+		return false
+	}
+	if len(request.Keys) > MaxFeaturedBoards {
+		http.Error(w, fmt.Sprintf("At most %d boards may be featured", MaxFeaturedBoards), http.StatusBadRequest)
+		return false
+	}
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, key := range request.Keys {
+		key = strings.ToLower(key)
+		if !isKeyPath("/" + key) {
+			http.Error(w, fmt.Sprintf("Invalid key %q", key), http.StatusBadRequest)
+			return false
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	err := s.repo.WithTx(func(repo BoardRepo) error {
+		return repo.SetFeaturedKeys(keys)
+	})
+	if err != nil {
+		log.Printf("Error in setFeatured: %s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return false
+	}
+	log.Printf("Admin featured %d boards", len(keys))
+	return true
+}
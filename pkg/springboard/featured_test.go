@@ -0,0 +1,49 @@
+package springboard
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// setFeaturedRequest returns the admin's POST /admin/featured of keys.
+func setFeaturedRequest(t *testing.T, server *Spring83Server, privkey ed25519.PrivateKey, keys ...string) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(featuredBoards{append([]string{}, keys...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := adminRequest(t, server, privkey, http.MethodPost, "/admin/featured")
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return r
+}
+
+func TestFeaturedBoardsRenderFirst(t *testing.T) {
+	server, privkey := newAdminServer(t)
+	now := time.Now()
+	for i := 1; i <= 4; i++ {
+		mustPublish(t, server.repo, testBoard(testKey(i), now.Add(time.Duration(i-10)*time.Minute), fmt.Sprintf("board %d", i)))
+	}
+
+	w := serve(server, setFeaturedRequest(t, server, privkey, testKey(2), testKey(3)))
+	if want := fmt.Sprintf(`{"keys":["%s","%s"]}`, testKey(2), testKey(3)); w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("Featuring got %d %q, want %s", w.Code, w.Body.String(), want)
+	}
+	want := []string{testKey(2), testKey(3), testKey(4), testKey(1)}
+	if got := renderedKeys(t, server, "/"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Index shows %v, want the featured boards first: %v", got, want)
+	}
+
+	if w := serve(server, setFeaturedRequest(t, server, privkey)); w.Code != http.StatusOK {
+		t.Fatalf("Clearing the featured boards got %d", w.Code)
+	}
+	want = []string{testKey(4), testKey(3), testKey(2), testKey(1)}
+	if got := renderedKeys(t, server, "/"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Index without featured boards shows %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package springboard
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+)
+
+// PublishGate decides whether a client may publish (or delete) a board. It's
+// consulted before any other checks, and a denied request gets 403 Forbidden
+// with the gate's reason.
+type PublishGate interface {
+	Allow(ip net.IP, key string) (allowed bool, reason string)
+}
+
+// AllowAllGate lets anyone publish.
+type AllowAllGate struct{}
+
+func (AllowAllGate) Allow(ip net.IP, key string) (bool, string) {
+	return true, ""
+}
+
+// CIDRAllowlist only lets clients publish from addresses in its networks.
+type CIDRAllowlist struct {
+	networks []*net.IPNet
+}
+
+// NewCIDRAllowlist parses an allowlist of networks in CIDR notation, e.g.
+// "192.0.2.0/24" or "2001:db8::/32".
+func NewCIDRAllowlist(cidrs []string) (*CIDRAllowlist, error) {
+	allowlist := &CIDRAllowlist{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CIDR %q in publish allowlist: %s", cidr, err)
+		}
+		allowlist.networks = append(allowlist.networks, network)
+	}
+	return allowlist, nil
+}
+
+func (allowlist *CIDRAllowlist) Allow(ip net.IP, key string) (bool, string) {
+	if ip != nil {
+		for _, network := range allowlist.networks {
+			if network.Contains(ip) {
+				return true, ""
+			}
+		}
+	}
+	return false, "Publishing is not allowed from your address"
+}
+
+// compileDenyPatterns compiles the regular expressions of a content
+// denylist.
+func compileDenyPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid content deny pattern %q: %s", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// deniedContent returns the first content deny pattern a board's body
+// matches, or nil if it matches none.
+func (s *Spring83Server) deniedContent(body []byte) *regexp.Regexp {
+	for _, pattern := range s.settings().contentDenyPatterns {
+		if pattern.Match(body) {
+			return pattern
+		}
+	}
+	return nil
+}
+
+// remoteHost returns the address a request came from, without its port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// allowPublish consults the server's publish gate, responding 403 Forbidden
+// and returning false if the request is denied.
+func (s *Spring83Server) allowPublish(w http.ResponseWriter, r *http.Request, key string) bool {
+	allowed, reason := s.settings().publishGate.Allow(net.ParseIP(remoteHost(r)), key)
+	if !allowed {
+		http.Error(w, reason, http.StatusForbidden)
+	}
+	return allowed
+}
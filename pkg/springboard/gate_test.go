@@ -0,0 +1,69 @@
+package springboard
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCIDRAllowlistGatesPublishing(t *testing.T) {
+	allowlist, err := NewCIDRAllowlist([]string{"192.0.2.0/24", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, ServerConfig{PublishGate: allowlist})
+
+	tests := []struct {
+		remoteAddr string
+		code       int
+	}{
+		{"192.0.2.7:51000", http.StatusOK},
+		{"[2001:db8::1]:51000", http.StatusOK},
+		{"198.51.100.7:51000", http.StatusForbidden},
+		{"[2001:db9::1]:51000", http.StatusForbidden},
+	}
+	for i, test := range tests {
+		r := putRequest(testBoard(testKey(i+1), time.Now(), "hello"))
+		r.RemoteAddr = test.remoteAddr
+		w := serve(server, r)
+		if w.Code != test.code {
+			t.Errorf("PUT from %s got %d, want %d", test.remoteAddr, w.Code, test.code)
+		}
+		if test.code == http.StatusForbidden && !strings.Contains(w.Body.String(), "not allowed from your address") {
+			t.Errorf("PUT from %s was denied without the gate's reason: %q", test.remoteAddr, w.Body.String())
+		}
+	}
+
+	if _, err := NewCIDRAllowlist([]string{"192.0.2.0"}); err == nil {
+		t.Errorf("Parsed an allowlist entry without a prefix length")
+	}
+}
+
+func TestContentDenyPatterns(t *testing.T) {
+	server := newTestServer(t, ServerConfig{ContentDenyPatterns: []string{`(?i)cheap pills`, `spam\.example`}})
+	now := time.Now()
+
+	for i, content := range []string{
+		`<p>CHEAP PILLS here</p>`,
+		`<a href="https://spam.example/">click</a>`,
+	} {
+		board := testBoard(testKey(i+1), now, content)
+		w := put(server, board)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "content this server doesn't accept") {
+			t.Errorf("Board %q got %d %q, want 403 with a reason", content, w.Code, w.Body.String())
+		}
+		if stored, _ := server.repo.GetBoard(board.Key); stored != nil {
+			t.Errorf("Board %q was stored", content)
+		}
+	}
+
+	clean := testBoard(testKey(3), now, `<p>pills are mentioned, spamexample isn't a match</p>`)
+	if w := put(server, clean); w.Code != http.StatusOK {
+		t.Errorf("Clean board got %d: %s", w.Code, w.Body.String())
+	}
+
+	if _, err := newReloadableSettings(ServerConfig{ContentDenyPatterns: []string{`(unclosed`}}); err == nil {
+		t.Errorf("An invalid pattern was accepted")
+	}
+}
@@ -0,0 +1,216 @@
+package springboard
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Servers in tests verify signatures with testVerifier rather than ed25519,
+// since grinding a real key with a valid 83eMMYY suffix takes hours. Tests
+// that need real signatures use ed25519 keys without the suffix, with
+// functions that don't check it.
+
+// suffixedKeyPub and suffixedKeyPriv are a real key pair whose public key ends
+// in 83e1055, found ahead of time. It's only accepted now by servers whose
+// MaxExpiryHorizon reaches October 2055.
+const (
+	suffixedKeyPub  = "73854adb3590c0f132e3a71c429fac7482efc69077e78c9af706b2d2583e1055"
+	suffixedKeyPriv = "51536b5219877bc7d33f07b45996419ea9cf72b37952c97988402a7b859c5dd1" + suffixedKeyPub
+)
+
+// testKey returns the nth fake key, valid for another year. Its leading
+// zeros keep it under any difficulty threshold.
+func testKey(n int) string {
+	return testKeyExpiring(n, time.Now().AddDate(1, 0, 0))
+}
+
+// testKeyExpiring returns the nth fake key, expiring in expiresAt's month.
+func testKeyExpiring(n int, expiresAt time.Time) string {
+	return fmt.Sprintf("%057x83e%s", n, expiresAt.Format("0106"))
+}
+
+// testVerifier accepts the signatures testSignature makes.
+type testVerifier struct{}
+
+func (testVerifier) Verify(key string, body []byte, signature []byte) error {
+	if !bytes.Equal(signature, testSignature(key, body)) {
+		return invalid(ErrInvalidSignature, "Invalid signature")
+	}
+	return nil
+}
+
+// testSignature is a fake signature of body by key, as long as an ed25519
+// one.
+func testSignature(key string, body []byte) []byte {
+	sum := sha512.Sum512(append([]byte(key), body...))
+	return sum[:]
+}
+
+// testBoard returns a board for key with content, dated modified and signed
+// for testVerifier.
+func testBoard(key string, modified time.Time, content string) Board {
+	modified = modified.UTC().Truncate(time.Second)
+	body := string(timeTag(modified)) + content
+	return Board{
+		Key:       key,
+		Board:     body,
+		Modified:  modified,
+		Signature: hex.EncodeToString(testSignature(key, []byte(body))),
+	}
+}
+
+// newTestSqliteRepo returns an empty sqlite repo in a temporary folder.
+func newTestSqliteRepo(t *testing.T) *SqliteRepo {
+	t.Helper()
+	repo := newSqliteRepo(filepath.Join(t.TempDir(), "springboard.db"))
+	t.Cleanup(func() { repo.conn.Close() })
+	return repo
+}
+
+// forEachRepo runs test against an empty sqlite repo, and against an empty
+// postgres repo when SB_TEST_POSTGRES_URL is set to a database the tests may
+// wipe.
+func forEachRepo(t *testing.T, test func(t *testing.T, repo BoardRepo)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestSqliteRepo(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		connectionString := os.Getenv("SB_TEST_POSTGRES_URL")
+		if connectionString == "" {
+			t.Skip("SB_TEST_POSTGRES_URL is not set")
+		}
+		repo := newPostgresRepo(connectionString)
+		t.Cleanup(func() { repo.conn.Close() })
+		if _, err := repo.conn.Exec(`TRUNCATE boards, board_views, propagation_log, featured_boards`); err != nil {
+			t.Fatal(err)
+		}
+		test(t, repo)
+	})
+}
+
+// newTestServer returns a server with an empty sqlite repo that verifies
+// signatures with testVerifier.
+func newTestServer(t *testing.T, config ServerConfig) *Spring83Server {
+	t.Helper()
+	return newTestServerWithRepo(newTestSqliteRepo(t), config)
+}
+
+// newTestServerWithRepo returns a server using repo that verifies signatures
+// with testVerifier.
+func newTestServerWithRepo(repo BoardRepo, config ServerConfig) *Spring83Server {
+	server := newSpring83Server(repo, config)
+	server.verifier = testVerifier{}
+	return server
+}
+
+// serve handles a request with the server's full handler.
+func serve(server *Spring83Server, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, r)
+	return w
+}
+
+// putRequest returns a PUT of board, as a client would send it.
+func putRequest(board Board) *http.Request {
+	r := httptest.NewRequest(http.MethodPut, "/"+board.Key, strings.NewReader(board.Board))
+	r.Header.Set("Spring-Signature", board.Signature)
+	r.Header.Set("Spring-Version", "83")
+	r.Header.Set("If-Unmodified-Since", board.Modified.UTC().Format(http.TimeFormat))
+	return r
+}
+
+// put PUTs board to the server and returns the response.
+func put(server *Spring83Server, board Board) *httptest.ResponseRecorder {
+	return serve(server, putRequest(board))
+}
+
+// mustPublish stores board in the server's repo, failing the test if it
+// can't.
+func mustPublish(t *testing.T, repo BoardRepo, board Board) {
+	t.Helper()
+	if err := repo.PublishBoard(board); err != nil {
+		t.Fatalf("Could not publish board for %s: %s", board.Key, err)
+	}
+}
+
+// readAll reads a response body, failing the test if it can't.
+func readAll(t *testing.T, r io.Reader) string {
+	t.Helper()
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// waitFor polls condition until it's true, failing the test if it isn't
+// within timeout.
+func waitFor(t *testing.T, timeout time.Duration, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// deleteRequest returns a DELETE of key with a tombstone dated modified.
+func deleteRequest(key string, modified time.Time) *http.Request {
+	tombstone := Tombstone(modified)
+	r := httptest.NewRequest(http.MethodDelete, "/"+key, bytes.NewReader(tombstone))
+	r.Header.Set("Spring-Signature", hex.EncodeToString(testSignature(key, tombstone)))
+	r.Header.Set("Spring-Version", "83")
+	return r
+}
+
+// newTestKeyPair generates an ed25519 key pair (without the 83eMMYY suffix)
+// and saves it in a temporary key folder, as GetKeys reads it.
+func newTestKeyPair(t *testing.T) (keyPath string, pubkey ed25519.PublicKey, privkey ed25519.PrivateKey) {
+	t.Helper()
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath = t.TempDir()
+	if err = os.WriteFile(filepath.Join(keyPath, "key.pub"), []byte(hex.EncodeToString(pubkey)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(keyPath, "key.priv"), []byte(hex.EncodeToString(privkey)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// runTestServer runs a full server, as RunServer would, on a free local port
+// with an sqlite repo in a temporary folder, and returns its URL. It's
+// stopped when the test ends.
+func runTestServer(t *testing.T, config ServerConfig) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.SQLDriver = "sqlite"
+	config.SQLConnectionString = filepath.Join(t.TempDir(), "springboard.db")
+	stopped := make(chan error, 1)
+	go func() { stopped <- RunServerWithListener(listener, config) }()
+	t.Cleanup(func() {
+		listener.Close()
+		<-stopped
+	})
+	return "http://" + listener.Addr().String()
+}
@@ -4,13 +4,17 @@ import (
 	"crypto/ed25519"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -66,57 +70,250 @@ func GetKeys(keyPath string) (pubkey ed25519.PublicKey, privkey ed25519.PrivateK
 	return
 }
 
-func GenerateValidKeys(keyPath string) (err error) {
-	var foundPrivateKey ed25519.PrivateKey
-	var foundPublicKey ed25519.PublicKey
+// SignMessage returns the hex ed25519 signature of message by the private key
+// in keyPath (or the default key folder), e.g. to prove ownership of a board's
+// key elsewhere.
+func SignMessage(message []byte, keyPath string) (signature string, err error) {
+	_, privkey, err := GetKeys(keyPath)
+	if err != nil {
+		return
+	}
+	return hex.EncodeToString(ed25519.Sign(privkey, message)), nil
+}
 
-	fmt.Printf("I am fishing in the sea of all possible keys for a valid spring83 key. This may take a bit...\n")
+// VerifyMessage checks that signature is key's signature of message, both
+// hex encoded.
+func VerifyMessage(key string, message []byte, signature string) error {
+	decoded, err := hex.DecodeString(signature)
+	if err != nil {
+		return invalid(ErrInvalidSignature, "Signature must be hex encoded")
+	}
+	return verifyBoardSignature(key, message, decoded)
+}
+
+// KeyInfo describes a key pair on disk. It never includes the private key
+// itself.
+type KeyInfo struct {
+	PublicKey      string `json:"public_key"`
+	PrivateKeyPath string `json:"private_key_path"`
+	PublicKeyPath  string `json:"public_key_path"`
+	// Expiry is when the key stops being valid, or nil if it doesn't end
+	// in 83eMMYY.
+	Expiry *time.Time `json:"expiry"`
+}
 
+// newKeyInfo describes the key pair in folder whose public key is pubkey.
+func newKeyInfo(folder string, pubkey string) (info KeyInfo, err error) {
+	if folder, err = filepath.Abs(folder); err != nil {
+		return
+	}
+	info.PublicKey = pubkey
+	info.PublicKeyPath, info.PrivateKeyPath = getKeyPaths(folder)
+	if expiresAt, err := parseKeyExpiry(pubkey); err == nil {
+		info.Expiry = &expiresAt
+	}
+	return
+}
+
+// GetKeyInfo describes the key pair in keyPath (or the default key folder),
+// reading only its public key.
+func GetKeyInfo(keyPath string) (info KeyInfo, err error) {
 	pubfile, privfile := getKeyPaths(keyPath)
-	actualKeyPath := filepath.Dir(privfile)
+	if !fileExists(pubfile) || !fileExists(privfile) {
+		err = fmt.Errorf(`Could not load public and private keys at %s. You may need to run "springboard generate-key" first`, filepath.Dir(pubfile))
+		return
+	}
+	encodedPubKey, err := ioutil.ReadFile(pubfile)
+	if err != nil {
+		return
+	}
+	return newKeyInfo(filepath.Dir(pubfile), strings.TrimSpace(string(encodedPubKey)))
+}
 
-	if err = os.MkdirAll(actualKeyPath, os.ModePerm); err != nil {
-		panic(err)
+func GenerateValidKeys(keyPath string) (err error) {
+	_, err = GenerateValidKeyBatch(keyPath, 1, os.Stderr)
+	return
+}
+
+// GenerateValidKeyBatch finds count distinct valid key pairs and returns their
+// hex public keys. A single key pair is written to keyPath; a batch is written
+// to numbered folders inside it (keyPath/1, keyPath/2, ...). Progress is
+// written to progress, so the caller's standard output can be kept for the
+// keys.
+func GenerateValidKeyBatch(keyPath string, count int, progress io.Writer) (pubkeys []string, err error) {
+	keys, err := GenerateVanityKeyBatch(keyPath, "", count, progress)
+	for _, key := range keys {
+		pubkeys = append(pubkeys, key.PublicKey)
+	}
+	return
+}
+
+// MaxVanityLength is the longest vanity prefix GenerateVanityKeyBatch
+// accepts. Each character makes the search 16 times longer.
+const MaxVanityLength = 4
+
+// GenerateVanityKeyBatch is GenerateValidKeyBatch for keys that also start
+// with vanity, a short hex prefix (case insensitive). It describes each key
+// pair it writes.
+func GenerateVanityKeyBatch(keyPath string, vanity string, count int, progress io.Writer) (keys []KeyInfo, err error) {
+	if count < 1 {
+		return nil, fmt.Errorf("The number of keys must be at least 1")
+	}
+	vanity = strings.ToLower(vanity)
+	if len(vanity) > MaxVanityLength {
+		return nil, fmt.Errorf("The vanity prefix can be at most %d characters", MaxVanityLength)
+	}
+	if strings.Trim(vanity, "0123456789abcdef") != "" {
+		return nil, fmt.Errorf("The vanity prefix must be hexadecimal (0-9 and a-f)")
+	}
+	fmt.Fprintf(progress, "I am fishing in the sea of all possible keys for a valid spring83 key. This may take a bit...\n")
+
+	_, privfile := getKeyPaths(keyPath)
+	actualKeyPath := filepath.Dir(privfile)
+	folders := []string{actualKeyPath}
+	if count > 1 {
+		folders = nil
+		for i := 1; i <= count; i++ {
+			folders = append(folders, filepath.Join(actualKeyPath, strconv.Itoa(i)))
+		}
+	}
+	for _, folder := range folders {
+		if err = os.MkdirAll(folder, os.ModePerm); err != nil {
+			return
+		}
 	}
 
 	expiryYear := strconv.Itoa(time.Now().Year() + 1)
 	expiryYearSuffix := expiryYear[len(expiryYear)-2:]
 	expiryMonth := time.Now().Month()
 	keyEnd := fmt.Sprintf("83e%02d%s", expiryMonth, expiryYearSuffix)
-	nRoutines := runtime.NumCPU() - 1
-	var waitGroup sync.WaitGroup
-	var once sync.Once
+	nRoutines := KeyWorkers()
+
+	fmt.Fprintln(progress, " - looking for a key that ends in", keyEnd)
+	if vanity != "" {
+		fmt.Fprintf(progress, " - and starts with %s, which takes about %.0f times as long\n", vanity, math.Pow(16, float64(len(vanity))))
+	}
+	fmt.Fprintln(progress, " - using", nRoutines, "cores")
+	if count > 1 {
+		fmt.Fprintf(progress, " - writing %d keys to numbered folders in %s\n", count, actualKeyPath)
+	} else {
+		fmt.Fprintln(progress, " - writing keys to", actualKeyPath)
+	}
 
-	fmt.Println(" - looking for a key that ends in", keyEnd)
-	fmt.Println(" - using", nRoutines, "cores")
-	fmt.Println(" - writing keys to", actualKeyPath)
+	for i, pair := range findKeys(vanity, keyEnd, count, nRoutines, progress) {
+		pubfile, privfile := getKeyPaths(folders[i])
+		if err = os.WriteFile(pubfile, []byte(hex.EncodeToString(pair.pub)), 0644); err != nil {
+			return
+		}
+		if err = os.WriteFile(privfile, []byte(hex.EncodeToString(pair.priv)), 0600); err != nil {
+			return
+		}
+		info, err := newKeyInfo(folders[i], hex.EncodeToString(pair.pub))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, info)
+	}
+	return
+}
+
+type keyPair struct {
+	pub  ed25519.PublicKey
+	priv ed25519.PrivateKey
+}
+
+// findKeys searches for count distinct key pairs whose public keys start with
+// keyStart and end in keyEnd. The same workers goroutines keep searching until
+// the whole batch is found, printing each public key to progress as it's
+// found.
+func findKeys(keyStart string, keyEnd string, count int, workers int, progress io.Writer) []keyPair {
+	var mutex sync.Mutex
+	var done int32
+	var waitGroup sync.WaitGroup
+	found := make([]keyPair, 0, count)
+	seen := map[string]bool{}
 
-	waitGroup.Add(nRoutines)
-	for i := 0; i < nRoutines; i++ {
-		go func(num int) {
-			for foundPublicKey == nil {
+	waitGroup.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for atomic.LoadInt32(&done) == 0 {
 				pub, priv, err := ed25519.GenerateKey(nil)
 				if err != nil {
 					panic(err)
 				}
 
 				pubStr := hex.EncodeToString(pub)
-				pubSuffix := pubStr[len(pubStr)-len(keyEnd):]
-
-				if pubSuffix == keyEnd {
-					once.Do(func() {
-						fmt.Printf("%s\n", fmt.Sprintf("%x", pub))
-						foundPublicKey = pub
-						foundPrivateKey = priv
-					})
+				if !strings.HasSuffix(pubStr, keyEnd) || !strings.HasPrefix(pubStr, keyStart) {
+					continue
 				}
+				mutex.Lock()
+				if len(found) < count && !seen[pubStr] {
+					fmt.Fprintf(progress, " - found %s\n", pubStr)
+					seen[pubStr] = true
+					found = append(found, keyPair{pub, priv})
+					if len(found) == count {
+						atomic.StoreInt32(&done, 1)
+					}
+				}
+				mutex.Unlock()
+			}
+			waitGroup.Done()
+		}()
+	}
+	waitGroup.Wait()
+	return found
+}
+
+// KeyWorkers is how many goroutines search for keys: all but one of the CPUs,
+// so the machine stays responsive, but at least one.
+func KeyWorkers() int {
+	if workers := runtime.NumCPU() - 1; workers > 0 {
+		return workers
+	}
+	return 1
+}
+
+// keySuffixLength is the number of hex characters in the 83eMMYY suffix
+// every key must end with.
+const keySuffixLength = len("83eMMYY")
+
+// MeasureKeyRate generates key pairs on workers goroutines for duration, the
+// same way GenerateValidKeys does, and returns how many it generated per
+// second.
+func MeasureKeyRate(duration time.Duration, workers int) float64 {
+	var generated int64
+	var waitGroup sync.WaitGroup
+	deadline := time.Now().Add(duration)
+
+	waitGroup.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			var count int64
+			for time.Now().Before(deadline) {
+				pub, _, err := ed25519.GenerateKey(nil)
+				if err != nil {
+					panic(err)
+				}
+				_ = hex.EncodeToString(pub)
+				count++
 			}
+			atomic.AddInt64(&generated, count)
 			waitGroup.Done()
-		}(i)
+		}()
 	}
 	waitGroup.Wait()
 
-	os.WriteFile(pubfile, []byte(hex.EncodeToString(foundPublicKey)), 0644)
-	os.WriteFile(privfile, []byte(hex.EncodeToString(foundPrivateKey)), 0600)
+	return float64(generated) / duration.Seconds()
+}
+
+// EstimateKeySearch returns how long, on average and in 90% of searches, it
+// takes to find a key with the required suffix when generating rate keys per
+// second. Each key has a 1 in 16^7 chance of ending with a given 83eMMYY.
+func EstimateKeySearch(rate float64) (average time.Duration, ninetiethPercentile time.Duration) {
+	probability := math.Pow(16, -float64(keySuffixLength))
+	averageAttempts := 1 / probability
+	ninetiethAttempts := math.Log(0.1) / math.Log1p(-probability)
+	average = time.Duration(averageAttempts / rate * float64(time.Second))
+	ninetiethPercentile = time.Duration(ninetiethAttempts / rate * float64(time.Second))
 	return
 }
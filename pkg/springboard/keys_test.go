@@ -0,0 +1,113 @@
+package springboard
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestEstimateKeySearch(t *testing.T) {
+	// At 16^7 keys a second, one key in the whole suffix space per second.
+	average, ninetieth := EstimateKeySearch(math.Pow(16, 7))
+	if average != time.Second {
+		t.Errorf("Average search took %s, want 1s", average)
+	}
+	// 90% of searches end within ln(10) times the average.
+	if want := math.Ln10; math.Abs(ninetieth.Seconds()-want) > 0.001 {
+		t.Errorf("90th percentile search took %s, want %.3fs", ninetieth, want)
+	}
+
+	// Halving the rate doubles the estimates.
+	slowAverage, slowNinetieth := EstimateKeySearch(math.Pow(16, 7) / 2)
+	if slowAverage != 2*average || math.Abs(slowNinetieth.Seconds()-2*ninetieth.Seconds()) > 0.001 {
+		t.Errorf("Half the rate estimated %s and %s, want %s and %s", slowAverage, slowNinetieth, 2*average, 2*ninetieth)
+	}
+}
+
+func TestFindKeysFindsDistinctKeys(t *testing.T) {
+	// A one-character suffix takes about 16 tries, instead of 16^7.
+	pairs := findKeys("", "8", 2, 2, io.Discard)
+	if len(pairs) != 2 {
+		t.Fatalf("Found %d keys, want 2", len(pairs))
+	}
+	seen := map[string]bool{}
+	for _, pair := range pairs {
+		key := hex.EncodeToString(pair.pub)
+		if !strings.HasSuffix(key, "8") {
+			t.Errorf("Key %s doesn't end in the suffix", key)
+		}
+		if !bytes.Equal(pair.priv.Public().(ed25519.PublicKey), pair.pub) {
+			t.Errorf("Key %s doesn't match its private key", key)
+		}
+		if seen[key] {
+			t.Errorf("Found %s twice", key)
+		}
+		seen[key] = true
+	}
+
+	vanity := findKeys("a", "8", 1, 1, io.Discard)
+	if key := hex.EncodeToString(vanity[0].pub); !strings.HasPrefix(key, "a") || !strings.HasSuffix(key, "8") {
+		t.Errorf("Key %s doesn't start with the vanity prefix", key)
+	}
+}
+
+func TestSignAndVerifyMessage(t *testing.T) {
+	keyPath, pubkey, _ := newTestKeyPair(t)
+	key := hex.EncodeToString(pubkey)
+	message := []byte("I own this board.\n")
+
+	signature, err := SignMessage(message, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyMessage(key, message, signature); err != nil {
+		t.Errorf("Signature doesn't verify: %s", err)
+	}
+
+	otherPath, otherKey, _ := newTestKeyPair(t)
+	otherSignature, err := SignMessage(message, otherPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, check := range map[string]error{
+		"changed message":   VerifyMessage(key, []byte("I own this board!\n"), signature),
+		"another signature": VerifyMessage(key, message, otherSignature),
+		"another key":       VerifyMessage(hex.EncodeToString(otherKey), message, signature),
+		"non-hex signature": VerifyMessage(key, message, "not hex"),
+	} {
+		if !errors.Is(check, ErrInvalidSignature) {
+			t.Errorf("%s got %v, want ErrInvalidSignature", name, check)
+		}
+	}
+
+	if _, err := SignMessage(message, t.TempDir()); err == nil {
+		t.Errorf("Signing without a key pair succeeded")
+	}
+}
+
+func TestVanityPrefix(t *testing.T) {
+	// With no suffix to find, a one-character prefix takes about 16 tries.
+	for _, pair := range findKeys("c", "", 3, 1, io.Discard) {
+		if key := hex.EncodeToString(pair.pub); !strings.HasPrefix(key, "c") {
+			t.Errorf("Key %s doesn't start with the vanity prefix c", key)
+		}
+	}
+
+	// Invalid prefixes are refused before any search starts.
+	for _, vanity := range []string{"xyz", "12345", "ab-c"} {
+		var progress bytes.Buffer
+		if _, err := GenerateVanityKeyBatch(t.TempDir(), vanity, 1, &progress); err == nil {
+			t.Errorf("Vanity prefix %q was accepted", vanity)
+		}
+		if progress.Len() != 0 {
+			t.Errorf("Vanity prefix %q started a search: %q", vanity, progress.String())
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package springboard
+
+import (
+	"net/http"
+)
+
+// requestLimiter caps how many reads (GET, HEAD, and OPTIONS) and writes
+// (everything else) are handled at once, so that a flood of requests, each
+// doing crypto and database work, can't exhaust the server. A nil slots
+// channel means no limit.
+type requestLimiter struct {
+	readSlots  chan struct{}
+	writeSlots chan struct{}
+}
+
+func newRequestLimiter(maxReads int, maxWrites int) *requestLimiter {
+	limiter := &requestLimiter{}
+	if maxReads > 0 {
+		limiter.readSlots = make(chan struct{}, maxReads)
+	}
+	if maxWrites > 0 {
+		limiter.writeSlots = make(chan struct{}, maxWrites)
+	}
+	return limiter
+}
+
+// hasLimits reports whether limiter allows maxReads and maxWrites requests
+// at once, as newRequestLimiter would make it.
+func (limiter *requestLimiter) hasLimits(maxReads int, maxWrites int) bool {
+	return cap(limiter.readSlots) == slotLimit(maxReads) && cap(limiter.writeSlots) == slotLimit(maxWrites)
+}
+
+// slotLimit is the capacity of the slots channel for a configured limit.
+func slotLimit(max int) int {
+	if max > 0 {
+		return max
+	}
+	return 0
+}
+
+// Serve passes a request to next if there's a free slot for it, and responds
+// 503 Service Unavailable with Retry-After otherwise, rather than waiting for
+// one. Paths that hold their connection open on purpose are exempt.
+func (limiter *requestLimiter) Serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	slots := limiter.writeSlots
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		slots = limiter.readSlots
+	}
+	if slots == nil || heldOpenPaths[r.URL.Path] {
+		next.ServeHTTP(w, r)
+		return
+	}
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+		next.ServeHTTP(w, r)
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Server busy, try again shortly", http.StatusServiceUnavailable)
+	}
+}
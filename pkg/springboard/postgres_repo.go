@@ -2,7 +2,9 @@ package springboard
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -10,7 +12,20 @@ import (
 )
 
 type PostgresRepo struct {
-	db *sql.DB
+	db dbtx
+	// conn is the connection pool, or nil if the repo is already running
+	// in a transaction.
+	conn *sql.DB
+}
+
+// WithTx implements BoardRepo
+func (repo *PostgresRepo) WithTx(fn func(BoardRepo) error) error {
+	if repo.conn == nil {
+		return fn(repo)
+	}
+	return inTx(repo.conn, func(tx *sql.Tx) error {
+		return fn(&PostgresRepo{db: tx})
+	})
 }
 
 // BoardCount implements BoardRepo
@@ -35,7 +50,7 @@ func (repo *PostgresRepo) BoardCount() (int, error) {
 }
 
 // DeleteBoardsBefore implements BoardRepo
-func (repo *PostgresRepo) DeleteBoardsBefore(expiry string) error {
+func (repo *PostgresRepo) DeleteBoardsBefore(expiry string) (int, error) {
 	query := `
 		  SELECT COUNT(*)
 		  FROM boards
@@ -45,16 +60,265 @@ func (repo *PostgresRepo) DeleteBoardsBefore(expiry string) error {
 	var count string
 	err := row.Scan(&count)
 	if err != nil {
-		return errors.Wrap(err, "Error determining how many boards to delete")
+		return 0, errors.Wrap(err, "Error determining how many boards to delete")
 	}
 	log.Printf("  %s boards to delete", count)
 	query = `
 		  DELETE FROM boards
 		  WHERE modified < $1
 		`
-	_, err = repo.db.Exec(query, expiry)
+	var deleted int
+	err = atomically(repo.conn, repo.db, func(db dbtx) error {
+		result, err := db.Exec(query, expiry)
+		if err != nil {
+			return errors.Wrap(err, "Error running deletion query")
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "Could not determine how many boards were deleted")
+		}
+		deleted = int(affected)
+		return deleteViews(db, `
+			DELETE FROM board_views
+			WHERE key NOT IN (SELECT key FROM boards)
+			`)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// DeleteBoard implements BoardRepo
+func (repo *PostgresRepo) DeleteBoard(key string) error {
+	return atomically(repo.conn, repo.db, func(db dbtx) error {
+		_, err := db.Exec(`
+			DELETE FROM boards
+			WHERE key = $1
+			`, key)
+		if err != nil {
+			return errors.Wrap(err, "Could not delete board")
+		}
+		return deleteViews(db, `
+			DELETE FROM board_views
+			WHERE key = $1
+			`, key)
+	})
+}
+
+// DeleteAllBoards implements BoardRepo
+func (repo *PostgresRepo) DeleteAllBoards() (deleted int, err error) {
+	err = atomically(repo.conn, repo.db, func(db dbtx) error {
+		result, err := db.Exec(`DELETE FROM boards`)
+		if err != nil {
+			return errors.Wrap(err, "Could not delete boards")
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "Could not determine how many boards were deleted")
+		}
+		deleted = int(affected)
+		return deleteViews(db, `DELETE FROM board_views`)
+	})
+	return
+}
+
+// DeleteBoardOlderThan implements BoardRepo
+func (repo *PostgresRepo) DeleteBoardOlderThan(key string, modified time.Time) error {
+	return atomically(repo.conn, repo.db, func(db dbtx) error {
+		result, err := db.Exec(`
+			DELETE FROM boards
+			WHERE key = $1 AND modified < $2
+			`, key, modified.Format(time.RFC3339))
+		if err != nil {
+			return errors.Wrap(err, "Could not delete board")
+		}
+		if err = staleUnlessAffected(result); err == ErrStaleBoard {
+			var count int
+			err = db.QueryRow(`
+				SELECT count(*)
+				FROM boards
+				WHERE key = $1
+				`, key).Scan(&count)
+			if err != nil {
+				return errors.Wrap(err, "Could not check for board")
+			}
+			if count > 0 {
+				return ErrStaleBoard
+			}
+		} else if err != nil {
+			return err
+		}
+		_, err = db.Exec(`
+			INSERT INTO tombstones (key, modified)
+			            values($1, $2)
+			ON CONFLICT(key) DO UPDATE SET
+				    modified=EXCLUDED.modified
+			WHERE tombstones.modified < EXCLUDED.modified
+			`, key, modified.UTC().Format(time.RFC3339))
+		if err != nil {
+			return errors.Wrap(err, "Could not record tombstone")
+		}
+		return deleteViews(db, `
+			DELETE FROM board_views
+			WHERE key = $1
+			`, key)
+	})
+}
+
+// DeleteTombstonesBefore implements BoardRepo
+func (repo *PostgresRepo) DeleteTombstonesBefore(before time.Time) error {
+	_, err := repo.db.Exec(`
+		DELETE FROM tombstones
+		WHERE modified < $1
+		`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return errors.Wrap(err, "Could not purge tombstones")
+	}
+	return nil
+}
+
+// IncrementViews implements BoardRepo
+func (repo *PostgresRepo) IncrementViews(key string) error {
+	_, err := repo.db.Exec(`
+		INSERT INTO board_views (key, views)
+		            values($1, 1)
+		ON CONFLICT(key) DO UPDATE SET
+			    views=board_views.views + 1
+		`, key)
+	if err != nil {
+		return errors.Wrap(err, "Could not count view")
+	}
+	return nil
+}
+
+// GetViewCounts implements BoardRepo
+func (repo *PostgresRepo) GetViewCounts() (map[string]int, error) {
+	rows, err := repo.db.Query(`
+		SELECT key, views
+		FROM board_views
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var key string
+		var views int
+		if err = rows.Scan(&key, &views); err != nil {
+			return nil, err
+		}
+		counts[key] = views
+	}
+	return counts, rows.Err()
+}
+
+// LogPropagation implements BoardRepo
+func (repo *PostgresRepo) LogPropagation(entry PropagationLogEntry) error {
+	_, err := repo.db.Exec(`
+		INSERT INTO propagation_log (key, destination, outcome, attempts, logged_at)
+		            values($1, $2, $3, $4, $5)
+		`, entry.Key, entry.Destination, string(entry.Outcome), entry.Attempts, entry.LoggedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return errors.Wrap(err, "Could not log propagation")
+	}
+	return nil
+}
+
+// GetPropagationLog implements BoardRepo
+func (repo *PostgresRepo) GetPropagationLog(limit int) ([]PropagationLogEntry, error) {
+	rows, err := repo.db.Query(`
+		SELECT key, destination, outcome, attempts, logged_at
+		FROM propagation_log
+		ORDER BY logged_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanPropagationLog(rows)
+}
+
+// DeletePropagationLogBefore implements BoardRepo
+func (repo *PostgresRepo) DeletePropagationLogBefore(before time.Time) error {
+	_, err := repo.db.Exec(`
+		DELETE FROM propagation_log
+		WHERE logged_at < $1
+		`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return errors.Wrap(err, "Could not purge the propagation log")
+	}
+	return nil
+}
+
+// GetBoardsToVerify implements BoardRepo
+func (repo *PostgresRepo) GetBoardsToVerify(limit int) ([]Board, error) {
+	rows, err := repo.db.Query(`
+		SELECT key, board, modified, signature, COALESCE(content_type, '')
+		FROM boards
+		WHERE NOT quarantined AND signature != ''
+		ORDER BY last_verified ASC NULLS FIRST
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanBoards(rows)
+}
+
+// RecordVerification implements BoardRepo
+func (repo *PostgresRepo) RecordVerification(board Board, at time.Time, valid bool) error {
+	_, err := repo.db.Exec(`
+		UPDATE boards
+		SET last_verified = $1, quarantined = $2
+		WHERE key = $3 AND signature = $4
+	`, at.UTC().Format(time.RFC3339), !valid, board.Key, board.Signature)
+	if err != nil {
+		return errors.Wrap(err, "Could not record verification")
+	}
+	return nil
+}
+
+// GetVerificationCounts implements BoardRepo
+func (repo *PostgresRepo) GetVerificationCounts() (verified int, quarantined int, err error) {
+	row := repo.db.QueryRow(`
+		SELECT
+			COUNT(CASE WHEN last_verified IS NOT NULL AND NOT quarantined THEN 1 END),
+			COUNT(CASE WHEN quarantined THEN 1 END)
+		FROM boards
+	`)
+	err = row.Scan(&verified, &quarantined)
+	return
+}
+
+// GetFeaturedKeys implements BoardRepo
+func (repo *PostgresRepo) GetFeaturedKeys() ([]string, error) {
+	rows, err := repo.db.Query(`
+		SELECT key
+		FROM featured_boards
+		ORDER BY position
+	`)
 	if err != nil {
-		return errors.Wrap(err, "Error running deletion query")
+		return nil, err
+	}
+	return scanKeys(rows)
+}
+
+// SetFeaturedKeys implements BoardRepo
+func (repo *PostgresRepo) SetFeaturedKeys(keys []string) error {
+	if _, err := repo.db.Exec(`DELETE FROM featured_boards`); err != nil {
+		return err
+	}
+	for position, key := range keys {
+		_, err := repo.db.Exec(`
+			INSERT INTO featured_boards (key, position)
+			            values($1, $2)
+		`, key, position)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -62,50 +326,107 @@ func (repo *PostgresRepo) DeleteBoardsBefore(expiry string) error {
 // GetAllBoards implements BoardRepo
 func (repo *PostgresRepo) GetAllBoards() ([]Board, error) {
 	query := `
-	  SELECT key, board, modified
+	  SELECT key, board, modified, signature, COALESCE(content_type, '')
 	  FROM boards
+	  WHERE NOT quarantined
 	  ORDER BY modified DESC
 	`
 	rows, err := repo.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
+	return scanBoards(rows)
+}
 
-	boards := []Board{}
-	for rows.Next() {
-		var key, board, modified string
+// IterateBoards implements BoardRepo
+func (repo *PostgresRepo) IterateBoards(fn func(Board) error) error {
+	query := `
+	  SELECT key, board, modified, signature, COALESCE(content_type, '')
+	  FROM boards
+	  WHERE NOT quarantined
+	  ORDER BY modified DESC
+	`
+	rows, err := repo.db.Query(query)
+	if err != nil {
+		return err
+	}
+	return iterateRows(rows, fn)
+}
 
-		err = rows.Scan(&key, &board, &modified)
-		if err != nil {
-			return nil, err
-		}
+// GetBoard implements BoardRepo
+func (repo *PostgresRepo) GetBoard(key string) (*Board, error) {
+	query := `
+		SELECT key, board, modified, signature, COALESCE(content_type, '')
+		FROM boards
+		WHERE key = $1 AND NOT quarantined
+	`
+	row := repo.db.QueryRow(query, key)
 
-		modifiedTime, err := time.Parse(time.RFC3339, modified)
-		if err != nil {
+	var dbkey, board, modified, signature, contentType string
+	err := row.Scan(&dbkey, &board, &modified, &signature, &contentType)
+	if err != nil {
+		if err != sql.ErrNoRows {
 			return nil, err
 		}
+		return nil, nil
+	}
 
-		boards = append(boards, Board{
-			Key:      key,
-			Board:    board,
-			Modified: modifiedTime,
-		})
+	modifiedTime, err := time.Parse(time.RFC3339, modified)
+	if err != nil {
+		return nil, err
 	}
 
+	return &Board{
+		Key:         key,
+		Board:       board,
+		Modified:    modifiedTime,
+		Signature:   signature,
+		ContentType: contentType,
+	}, nil
+}
+
+// GetBoards implements BoardRepo
+func (repo *PostgresRepo) GetBoards(keys []string) (map[string]Board, error) {
+	boards := map[string]Board{}
+	if len(keys) == 0 {
+		return boards, nil
+	}
+	placeholders := make([]string, len(keys))
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = key
+	}
+	query := fmt.Sprintf(`
+		SELECT key, board, modified, signature, COALESCE(content_type, '')
+		FROM boards
+		WHERE key IN (%s) AND NOT quarantined
+	`, strings.Join(placeholders, ", "))
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	found, err := scanBoards(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, board := range found {
+		boards[board.Key] = board
+	}
 	return boards, nil
 }
 
-// GetBoard implements BoardRepo
-func (repo *PostgresRepo) GetBoard(key string) (*Board, error) {
+// GetBoardMeta implements BoardRepo
+func (repo *PostgresRepo) GetBoardMeta(key string) (*BoardMeta, error) {
 	query := `
-		SELECT key, board, modified, signature
+		SELECT modified, signature, COALESCE(content_type, ''), COALESCE(content_hash, '')
 		FROM boards
-		WHERE key = $1
+		WHERE key = $1 AND NOT quarantined
 	`
 	row := repo.db.QueryRow(query, key)
 
-	var dbkey, board, modified, signature string
-	err := row.Scan(&dbkey, &board, &modified, &signature)
+	var modified, signature, contentType, contentHash string
+	err := row.Scan(&modified, &signature, &contentType, &contentHash)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return nil, err
@@ -118,29 +439,39 @@ func (repo *PostgresRepo) GetBoard(key string) (*Board, error) {
 		return nil, err
 	}
 
-	return &Board{
-		Key:       key,
-		Board:     board,
-		Modified:  modifiedTime,
-		Signature: signature,
+	return &BoardMeta{
+		Key:         key,
+		Modified:    modifiedTime,
+		Signature:   signature,
+		ContentType: contentType,
+		ContentHash: contentHash,
 	}, nil
 }
 
 // PublishBoard implements BoardRepo
 func (repo *PostgresRepo) PublishBoard(newBoard Board) error {
-	_, err := repo.db.Exec(`
-		INSERT INTO boards (key, board, modified, signature)
-		            values($1, $2, $3, $4)
+	result, err := repo.db.Exec(`
+		INSERT INTO boards (key, board, modified, signature, content_type, content_hash)
+		SELECT $1, $2, $3::timestamp, $4, $5, $6
+		WHERE NOT EXISTS (
+			SELECT 1
+			FROM tombstones
+			WHERE key = $1 AND modified >= $3::timestamp
+		)
 		ON CONFLICT(key) DO UPDATE SET
 			    board=$2,
-			    modified=$3,
-			    signature=$4
-		`, newBoard.Key, newBoard.Board, newBoard.ModifiedAtDBFormat(), newBoard.Signature)
+			    modified=$3::timestamp,
+			    signature=$4,
+			    content_type=$5,
+			    content_hash=$6,
+			    last_verified=NULL,
+			    quarantined=FALSE
+		WHERE boards.modified < EXCLUDED.modified
+		`, newBoard.Key, newBoard.Board, newBoard.ModifiedAtDBFormat(), newBoard.Signature, newBoard.ContentType, newBoard.ContentHash())
 	if err != nil {
 		return errors.Wrap(err, "Could not save board")
-	} else {
-		return nil
 	}
+	return staleUnlessAffected(result)
 }
 
 func newPostgresRepo(dbName string) *PostgresRepo {
@@ -159,6 +490,33 @@ func newPostgresRepo(dbName string) *PostgresRepo {
 		signature VARCHAR(128)
 	);
 	CREATE INDEX IF NOT EXISTS boards_modified ON boards(modified);
+	ALTER TABLE boards ADD COLUMN IF NOT EXISTS content_type VARCHAR(255);
+	ALTER TABLE boards ADD COLUMN IF NOT EXISTS content_hash CHAR(64);
+	ALTER TABLE boards ADD COLUMN IF NOT EXISTS last_verified TIMESTAMP;
+	ALTER TABLE boards ADD COLUMN IF NOT EXISTS quarantined BOOLEAN NOT NULL DEFAULT FALSE;
+	UPDATE boards SET content_hash = encode(sha256(convert_to(board, 'UTF8')), 'hex')
+	WHERE content_hash IS NULL AND board IS NOT NULL;
+	CREATE TABLE IF NOT EXISTS board_views (
+		key VARCHAR(64) NOT NULL PRIMARY KEY,
+		views INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS propagation_log (
+		id SERIAL PRIMARY KEY,
+		key VARCHAR(64) NOT NULL,
+		destination TEXT NOT NULL,
+		outcome VARCHAR(32) NOT NULL,
+		attempts INTEGER NOT NULL,
+		logged_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS propagation_log_logged_at ON propagation_log(logged_at);
+	CREATE TABLE IF NOT EXISTS featured_boards (
+		key VARCHAR(64) NOT NULL PRIMARY KEY,
+		position INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS tombstones (
+		key VARCHAR(64) NOT NULL PRIMARY KEY,
+		modified TIMESTAMP NOT NULL
+	);
 	`
 
 	_, err = db.Exec(initSQL)
@@ -166,5 +524,6 @@ func newPostgresRepo(dbName string) *PostgresRepo {
 		log.Fatalf("%q: %s\n", err, initSQL)
 	}
 	repo.db = db
+	repo.conn = db
 	return &repo
 }
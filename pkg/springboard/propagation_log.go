@@ -0,0 +1,112 @@
+package springboard
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PropagationOutcome is what happened when a board was relayed to a federate.
+type PropagationOutcome string
+
+const (
+	// PropagationSucceeded means the federate accepted the board.
+	PropagationSucceeded PropagationOutcome = "succeeded"
+	// PropagationAlreadyCurrent means the federate already had the board or
+	// a newer one.
+	PropagationAlreadyCurrent PropagationOutcome = "already-current"
+	// PropagationRetrying means the relay failed and will be tried again.
+	PropagationRetrying PropagationOutcome = "retrying"
+	// PropagationGaveUp means the relay failed too many times and was
+	// dropped.
+	PropagationGaveUp PropagationOutcome = "gave-up"
+)
+
+// DefaultPropagationLogRetention is how long propagation log entries are kept
+// when no retention is configured.
+const DefaultPropagationLogRetention = 7 * 24 * time.Hour
+
+// PropagationLogEntry records one attempt to relay a board to a federate.
+type PropagationLogEntry struct {
+	Key         string             `json:"key"`
+	Destination string             `json:"destination"`
+	Outcome     PropagationOutcome `json:"outcome"`
+	Attempts    int                `json:"attempts"`
+	LoggedAt    time.Time          `json:"loggedAt"`
+}
+
+// scanPropagationLog reads entries from rows selecting key, destination,
+// outcome, attempts, and logged_at.
+func scanPropagationLog(rows *sql.Rows) ([]PropagationLogEntry, error) {
+	defer rows.Close()
+	entries := []PropagationLogEntry{}
+	for rows.Next() {
+		var entry PropagationLogEntry
+		var outcome, loggedAt string
+		err := rows.Scan(&entry.Key, &entry.Destination, &outcome, &entry.Attempts, &loggedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.Outcome = PropagationOutcome(outcome)
+		entry.LoggedAt, err = time.Parse(time.RFC3339, loggedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// purgePropagationLog deletes log entries older than the retention period.
+func (s *Spring83Server) purgePropagationLog(now time.Time) {
+	if !s.logPropagation {
+		return
+	}
+	if err := s.repo.DeletePropagationLogBefore(now.Add(-s.propagationLogRetention)); err != nil {
+		log.Printf("Could not purge the propagation log: %s", err)
+	}
+}
+
+// showPropagationLog lists the most recent propagation log entries, newest
+// first, to the owner of the admin board. ?limit=N picks how many (default
+// 100, at most 1000).
+func (s *Spring83Server) showPropagationLog(w http.ResponseWriter, r *http.Request) {
+	if !s.logPropagation {
+		http.Error(w, "Propagation logging is disabled", http.StatusNotFound)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	limit := 100
+	if param := r.URL.Query().Get("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	entries, err := s.repo.GetPropagationLog(limit)
+	if err != nil {
+		log.Printf("Error in showPropagationLog: %s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	response, err := json.Marshal(entries)
+	if err != nil {
+		log.Printf("Error in showPropagationLog: %s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(response)
+}
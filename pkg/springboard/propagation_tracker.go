@@ -2,6 +2,7 @@ package springboard
 
 import (
 	"container/heap"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -19,12 +20,22 @@ func (ksp keyServerPair) Shorthand() string {
 }
 
 type relayInformation struct {
-	board       Board
+	board     Board
+	tombstone bool
+	// springAuth is the Spring-Auth header of a deletion authenticated
+	// with a challenge rather than a tombstone. board only has its key.
+	springAuth  string
 	destination string
-	queuedAt    time.Time
-	nextAttempt time.Time
-	attempts    int
-	index       int
+	// via is the Via chain the board arrived with, which this server is
+	// appended to when relaying it.
+	via      []string
+	queuedAt time.Time
+	// firstQueuedAt is when the relay was first queued. Unlike queuedAt, it
+	// isn't reset when a newer board replaces the pending one.
+	firstQueuedAt time.Time
+	nextAttempt   time.Time
+	attempts      int
+	index         int
 }
 
 func (ri relayInformation) lookupKey() keyServerPair {
@@ -98,40 +109,97 @@ func (rq relayQueue) NextAttempt() time.Time {
 	}
 }
 
+// maxCoalesceWaits bounds how long rapid re-publishes of a board can delay its
+// relay: at most this many propagateWaits after it was first queued.
+const maxCoalesceWaits = 2
+
 type propagationTracker struct {
 	queue           *relayQueue
 	mutex           *sync.Mutex
 	bgThreadRunning bool
 	fqdn            string
-	propagateWait time.Duration
+	propagateWait   time.Duration
+	// propagationLog records the outcome of each relay attempt, if set.
+	propagationLog BoardRepo
+	// slots has room for as many relays as may run at once.
+	slots chan struct{}
+	// inFlight holds the relays taken off the queue that haven't finished,
+	// whether running or waiting for a slot.
+	inFlight map[*relayInformation]bool
+	// onPropagated, if set, is called when a federate accepts a board.
+	onPropagated func(board Board, destination string)
 }
 
-func newPropagationTracker(fqdn string, propagateWait time.Duration) *propagationTracker {
+// DefaultMaxConcurrentPropagations is how many relays run at once when no
+// limit is configured.
+const DefaultMaxConcurrentPropagations = 1
+
+func newPropagationTracker(fqdn string, propagateWait time.Duration, maxConcurrent int) *propagationTracker {
+	if maxConcurrent < 1 {
+		maxConcurrent = DefaultMaxConcurrentPropagations
+	}
 	return &propagationTracker{
-		queue: newRelayQueue(),
-		mutex: &sync.Mutex{},
-		fqdn:  fqdn,
+		queue:         newRelayQueue(),
+		mutex:         &sync.Mutex{},
+		fqdn:          fqdn,
 		propagateWait: propagateWait,
+		slots:         make(chan struct{}, maxConcurrent),
+		inFlight:      map[*relayInformation]bool{},
 	}
 }
 
-func (tracker *propagationTracker) Schedule(board Board, server string) {
+// Schedule relays a board to server. via is the Via chain the board arrived
+// with, if any.
+func (tracker *propagationTracker) Schedule(board Board, server string, via []string) {
+	tracker.schedule(board, server, false, "", via)
+}
+
+// ScheduleDeletion relays a signed tombstone to server. It replaces any
+// pending relay of the key's board to that server.
+func (tracker *propagationTracker) ScheduleDeletion(tombstone Board, server string, via []string) {
+	tracker.schedule(tombstone, server, true, "", via)
+}
+
+// ScheduleAuthDeletion relays a deletion of key's board authenticated with
+// the Spring-Auth header springAuth to server, like ScheduleDeletion.
+func (tracker *propagationTracker) ScheduleAuthDeletion(key string, springAuth string, server string, via []string) {
+	tracker.schedule(Board{Key: key}, server, true, springAuth, via)
+}
+
+func (tracker *propagationTracker) schedule(board Board, server string, tombstone bool, springAuth string, via []string) {
 	go func() {
 		tracker.mutex.Lock()
 		queuedItem, alreadyQueued := tracker.queue.LookUp(board.Key, server)
-		if alreadyQueued {
+		if alreadyQueued && queuedItem.tombstone == tombstone && queuedItem.springAuth == springAuth && queuedItem.board.ContentHash() == board.ContentHash() {
+			// The same board, e.g. relayed to us by several federates,
+			// doesn't need to wait any longer.
+			log.Printf("%s already queued with the same board", queuedItem.lookupKey().Shorthand())
+		} else if alreadyQueued {
+			// Coalesce into the pending relay, which now carries the latest
+			// board, but don't let a stream of updates starve it.
 			queuedItem.attempts = 0
 			queuedItem.board = board
+			queuedItem.tombstone = tombstone
+			queuedItem.springAuth = springAuth
+			queuedItem.via = via
 			queuedItem.queuedAt = time.Now()
 			queuedItem.nextAttempt = time.Now().Add(tracker.propagateWait)
+			deadline := queuedItem.firstQueuedAt.Add(maxCoalesceWaits * tracker.propagateWait)
+			if queuedItem.nextAttempt.After(deadline) {
+				queuedItem.nextAttempt = deadline
+			}
 			heap.Fix(tracker.queue, queuedItem.index)
 			log.Printf("%s already queued, resetting the time to %s", queuedItem.lookupKey().Shorthand(), queuedItem.nextAttempt.Format(time.RFC3339))
 		} else {
 			newItem := &relayInformation{
-				board:       board,
-				destination: server,
-				queuedAt:    time.Now(),
-				nextAttempt: time.Now().Add(tracker.propagateWait),
+				board:         board,
+				tombstone:     tombstone,
+				springAuth:    springAuth,
+				destination:   server,
+				via:           via,
+				queuedAt:      time.Now(),
+				firstQueuedAt: time.Now(),
+				nextAttempt:   time.Now().Add(tracker.propagateWait),
 			}
 			heap.Push(tracker.queue, newItem)
 			log.Printf("%s queuing for propagation in %s (%s)", newItem.lookupKey().Shorthand(), tracker.propagateWait.String(), newItem.nextAttempt.Format(time.RFC3339))
@@ -143,6 +211,25 @@ func (tracker *propagationTracker) Schedule(board Board, server string) {
 	}()
 }
 
+// Backlog reports how many relays are queued or in flight, and when the one
+// that has waited longest was first queued (zero if there are none). A relay
+// stuck on an unresponsive federate counts until it finishes.
+func (tracker *propagationTracker) Backlog() (depth int, oldest time.Time) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	for _, item := range tracker.queue.queue {
+		if oldest.IsZero() || item.firstQueuedAt.Before(oldest) {
+			oldest = item.firstQueuedAt
+		}
+	}
+	for item := range tracker.inFlight {
+		if oldest.IsZero() || item.firstQueuedAt.Before(oldest) {
+			oldest = item.firstQueuedAt
+		}
+	}
+	return len(tracker.queue.queue) + len(tracker.inFlight), oldest
+}
+
 func (tracker *propagationTracker) processQueue() {
 	tracker.mutex.Lock()
 	if tracker.bgThreadRunning {
@@ -164,32 +251,107 @@ func (tracker *propagationTracker) processQueue() {
 		}
 		if time.Now().After(tracker.queue.NextAttempt()) {
 			nextUp := heap.Pop(tracker.queue).(*relayInformation)
-			client := NewClient(nextUp.destination)
-			logTag := nextUp.lookupKey().Shorthand()
-			err := client.PostSignedBoard(nextUp.board, tracker.fqdn)
-			if err == nil {
-				log.Printf("%s successfully propagated", logTag)
-			} else {
-				log.Printf("%s error posting board: %s", logTag, err.Error())
-				nextUp.attempts++
-				jitteredWait := rand.Intn(pow2(nextUp.attempts))
-				if jitteredWait < 2 {
-					jitteredWait = 2
-				}
-				nextUp.nextAttempt = time.Now().Add(time.Duration(jitteredWait) * time.Minute)
-				if nextUp.nextAttempt.After(nextUp.queuedAt.Add(time.Hour)) {
-					log.Printf("%s too many attempts, giving up", logTag)
-				} else {
-					log.Printf("%s will try again in %d minutes (%s)", logTag, jitteredWait, nextUp.nextAttempt.Format(time.RFC3339))
-					heap.Push(tracker.queue, nextUp)
-				}
-			}
+			tracker.inFlight[nextUp] = true
+			tracker.mutex.Unlock()
+			// Wait for a free slot, so at most cap(slots) relays run at
+			// once; the rest stay queued.
+			tracker.slots <- struct{}{}
+			go tracker.relay(nextUp)
+			continue
 		}
 		tracker.mutex.Unlock()
 		time.Sleep(time.Second)
 	}
 }
 
+// relay sends a board (or tombstone) to its destination, and requeues it with
+// a backoff if that fails. It frees its slot when done.
+func (tracker *propagationTracker) relay(nextUp *relayInformation) {
+	defer func() { <-tracker.slots }()
+	client := NewClient(nextUp.destination)
+	logTag := nextUp.lookupKey().Shorthand()
+	var via []string
+	via = append(via, nextUp.via...)
+	if tracker.fqdn != "" {
+		via = append(via, tracker.fqdn)
+	}
+	var err error
+	if nextUp.springAuth != "" {
+		err = client.DeleteWithAuth(nextUp.board.Key, nextUp.springAuth, via)
+	} else if nextUp.tombstone {
+		err = client.DeleteSignedBoard(nextUp.board, via)
+	} else {
+		err = client.PostSignedBoard(nextUp.board, via)
+	}
+
+	// Only the queue is updated under the lock. Logging the outcome writes
+	// to the database and onPropagated may take a while, so they wait until
+	// it's released, working from a copy of the relay, which may be queued
+	// again and changed by then.
+	var outcome PropagationOutcome
+	attempts := nextUp.attempts + 1
+	propagated := false
+	tracker.mutex.Lock()
+	delete(tracker.inFlight, nextUp)
+	if err == nil {
+		log.Printf("%s successfully propagated", logTag)
+		outcome = PropagationSucceeded
+		propagated = tracker.onPropagated != nil && !nextUp.tombstone
+	} else if errors.Is(err, ErrOldContent) {
+		log.Printf("%s already has this board or a newer one", logTag)
+		outcome = PropagationAlreadyCurrent
+	} else {
+		log.Printf("%s error posting board: %s", logTag, err.Error())
+		nextUp.attempts++
+		attempts = nextUp.attempts
+		jitteredWait := rand.Intn(pow2(nextUp.attempts))
+		if jitteredWait < 2 {
+			jitteredWait = 2
+		}
+		nextUp.nextAttempt = time.Now().Add(time.Duration(jitteredWait) * time.Minute)
+		if nextUp.nextAttempt.After(nextUp.queuedAt.Add(time.Hour)) {
+			log.Printf("%s too many attempts, giving up", logTag)
+			outcome = PropagationGaveUp
+		} else if _, superseded := tracker.queue.LookUp(nextUp.board.Key, nextUp.destination); superseded {
+			// A newer board was queued while this one was in flight.
+			log.Printf("%s a newer board is queued, dropping this one", logTag)
+		} else {
+			log.Printf("%s will try again in %d minutes (%s)", logTag, jitteredWait, nextUp.nextAttempt.Format(time.RFC3339))
+			outcome = PropagationRetrying
+			heap.Push(tracker.queue, nextUp)
+			if !tracker.bgThreadRunning {
+				go tracker.processQueue()
+			}
+		}
+	}
+	done := *nextUp
+	tracker.mutex.Unlock()
+
+	if outcome != "" {
+		tracker.record(&done, outcome, attempts)
+	}
+	if propagated {
+		tracker.onPropagated(done.board, done.destination)
+	}
+}
+
+// record writes a relay attempt to the propagation log, if there is one.
+func (tracker *propagationTracker) record(relay *relayInformation, outcome PropagationOutcome, attempts int) {
+	if tracker.propagationLog == nil {
+		return
+	}
+	err := tracker.propagationLog.LogPropagation(PropagationLogEntry{
+		Key:         relay.board.Key,
+		Destination: relay.destination,
+		Outcome:     outcome,
+		Attempts:    attempts,
+		LoggedAt:    time.Now().UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		log.Printf("%s could not log propagation: %s", relay.lookupKey().Shorthand(), err)
+	}
+}
+
 func pow2(y int) (val int) {
 	val = 1
 	for i := 0; i < y; i++ {
@@ -0,0 +1,185 @@
+package springboard
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRapidRepublishesCoalesceIntoOneRelay(t *testing.T) {
+	var mutex sync.Mutex
+	var relayed []string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		relayed = append(relayed, readAll(t, r.Body))
+	}))
+	defer peer.Close()
+
+	wait := time.Second
+	server := newTestServer(t, ServerConfig{Federates: []string{peer.URL}, PropagateWait: wait})
+	key := testKey(1)
+	start := time.Now()
+	var last Board
+	for i := 0; i < 5; i++ {
+		last = testBoard(key, start.Add(time.Duration(i-5)*time.Second), fmt.Sprintf("<p>draft %d</p>", i))
+		if w := put(server, last); w.Code != http.StatusOK {
+			t.Fatalf("PUT %d got %d: %s", i, w.Code, w.Body.String())
+		}
+		time.Sleep(wait * 2 / 5)
+	}
+
+	// Each publish pushes the relay back, but no further than
+	// maxCoalesceWaits after the first, plus a tick of the queue processor.
+	bound := maxCoalesceWaits*wait + 2*time.Second
+	waitFor(t, bound-time.Since(start), "the coalesced relay", func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(relayed) > 0
+	})
+	time.Sleep(wait)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(relayed) != 1 || relayed[0] != last.Board {
+		t.Errorf("Peer got %q, want one relay of the final board %q", relayed, last.Board)
+	}
+}
+
+func TestRelayOutcomesAreLogged(t *testing.T) {
+	accepting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer accepting.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	repo := newTestSqliteRepo(t)
+	tracker := newPropagationTracker("", 0, 1)
+	tracker.propagationLog = repo
+	board := testBoard(testKey(1), time.Now(), "hello")
+	relay := func(destination string, queuedAt time.Time) {
+		tracker.slots <- struct{}{}
+		tracker.relay(&relayInformation{board: board, destination: destination, queuedAt: queuedAt, attempts: 5})
+	}
+
+	relay(accepting.URL, time.Now())
+	// After an hour of retries, the next failure gives up.
+	relay(failing.URL, time.Now().Add(-2*time.Hour))
+
+	logged, err := repo.GetPropagationLog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outcomes := map[string]PropagationLogEntry{}
+	for _, entry := range logged {
+		outcomes[entry.Destination] = entry
+	}
+	if entry := outcomes[accepting.URL]; entry.Outcome != PropagationSucceeded || entry.Key != board.Key || entry.Attempts != 6 {
+		t.Errorf("Successful relay was logged as %+v", entry)
+	}
+	if entry := outcomes[failing.URL]; entry.Outcome != PropagationGaveUp || entry.Key != board.Key || entry.Attempts != 6 {
+		t.Errorf("Abandoned relay was logged as %+v", entry)
+	}
+	if tracker.queue.AnyQueued() {
+		t.Errorf("Abandoned relay was queued again")
+	}
+}
+
+func TestRelaysRespectConcurrencyLimit(t *testing.T) {
+	var mutex sync.Mutex
+	running, maxRunning, received := 0, 0, 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		mutex.Lock()
+		running--
+		received++
+		mutex.Unlock()
+	})
+	var peers []string
+	for i := 0; i < 6; i++ {
+		peer := httptest.NewServer(handler)
+		defer peer.Close()
+		peers = append(peers, peer.URL)
+	}
+
+	limit := 2
+	tracker := newPropagationTracker("", 0, limit)
+	board := testBoard(testKey(1), time.Now(), "hello")
+	for _, peer := range peers {
+		tracker.Schedule(board, peer, nil)
+	}
+	waitFor(t, 10*time.Second, "every peer to get the board", func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return received == len(peers)
+	})
+	if maxRunning > limit {
+		t.Errorf("%d relays ran at once, more than the limit of %d", maxRunning, limit)
+	}
+	if maxRunning < limit {
+		t.Errorf("At most %d relays ran at once, want the limit of %d to be used", maxRunning, limit)
+	}
+}
+
+func TestRelayCallbacksRunWithoutTheLock(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer peer.Close()
+
+	tracker := newPropagationTracker("", 0, 1)
+	tracker.propagationLog = newTestSqliteRepo(t)
+	entered, release := make(chan struct{}), make(chan struct{})
+	tracker.onPropagated = func(board Board, destination string) {
+		close(entered)
+		<-release
+	}
+	board := testBoard(testKey(1), time.Now(), "hello")
+	tracker.slots <- struct{}{}
+	go tracker.relay(&relayInformation{board: board, destination: peer.URL, queuedAt: time.Now()})
+	<-entered
+
+	// The queue is usable while the callback runs.
+	locked := make(chan struct{})
+	go func() {
+		tracker.Backlog()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Errorf("The tracker's lock was held while onPropagated ran")
+	}
+	close(release)
+}
+
+func TestBacklogCountsRelaysInFlight(t *testing.T) {
+	release := make(chan struct{})
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer peer.Close()
+	defer close(release)
+
+	tracker := newPropagationTracker("", 0, 1)
+	before := time.Now()
+	tracker.Schedule(testBoard(testKey(1), time.Now(), "hello"), peer.URL, nil)
+	tracker.Schedule(testBoard(testKey(2), time.Now(), "hello"), peer.URL, nil)
+	// One relay hangs on the peer and the other waits for its slot, so
+	// neither is queued any more.
+	waitFor(t, 5*time.Second, "both relays to leave the queue", func() bool {
+		tracker.mutex.Lock()
+		defer tracker.mutex.Unlock()
+		return len(tracker.queue.queue) == 0 && len(tracker.inFlight) == 2
+	})
+	if depth, oldest := tracker.Backlog(); depth != 2 || oldest.Before(before) || oldest.After(time.Now()) {
+		t.Errorf("Backlog with two relays in flight = %d, %s, want 2 and when they were queued", depth, oldest)
+	}
+}
@@ -0,0 +1,118 @@
+package springboard
+
+import (
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// periodicallyPullFromFederates fills in boards we missed, e.g. because we
+// were offline when a peer propagated them.
+func (s *Spring83Server) periodicallyPullFromFederates(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		s.pullFromFederates(time.Now())
+	}
+}
+
+func (s *Spring83Server) pullFromFederates(now time.Time) {
+	for _, federate := range s.settings().federates {
+		log.Printf("Pulling boards from %s", federate)
+		pulled, err := s.pullFrom(federate, now)
+		if err != nil {
+			log.Printf("Could not pull boards from %s: %s", federate, err)
+		}
+		log.Printf("  %d boards pulled from %s", pulled, federate)
+	}
+}
+
+// pullFrom compares a federate's index with our boards, and fetches, validates,
+// and stores each board it has that we don't, or that is newer than ours.
+func (s *Spring83Server) pullFrom(federate string, now time.Time) (pulled int, err error) {
+	client := NewClient(federate)
+	client.Output = OutputQuiet
+	index, err := client.GetIndex()
+	if err != nil {
+		return
+	}
+
+	localModified := map[string]time.Time{}
+	err = s.repo.IterateBoards(func(board Board) error {
+		localModified[board.Key] = board.Modified
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	entries := index.Boards
+	if index.AdminBoard.Key != "" {
+		entries = append(entries, index.AdminBoard)
+	}
+	for _, entry := range entries {
+		if modified, ok := localModified[entry.Key]; ok && !modified.Before(entry.Posted) {
+			continue
+		}
+		if keyExpired(entry.Key, now) {
+			continue
+		}
+		// Purges aren't relayed, so a federate may still list a board we
+		// purged. The next purge would only delete it again.
+		if s.purgePolicy != PurgeKeyExpiry && entry.Posted.Before(now.Add(-s.boardTTL)) {
+			continue
+		}
+		stored, err := s.pullBoard(client, entry.Key, now)
+		if err != nil {
+			log.Printf("Could not pull %s from %s: %s", entry.Key, federate, err)
+			continue
+		}
+		if stored {
+			pulled++
+		}
+	}
+	return
+}
+
+// pullBoard fetches a key's board and stores it if it's newer than ours and
+// passes the same checks as a board PUT to the server.
+func (s *Spring83Server) pullBoard(client Client, key string, now time.Time) (stored bool, err error) {
+	if err = s.validateIncomingKey(key, now); err != nil {
+		return
+	}
+	board, err := client.GetBoard(key)
+	if err != nil || board == nil {
+		return
+	}
+	// The federate's index may list a board we already have under another
+	// modified time, e.g. one published with a lenient time tag. There's no
+	// need to verify it again.
+	meta, err := s.repo.GetBoardMeta(key)
+	if err != nil || (meta != nil && meta.ContentHash == board.ContentHash()) {
+		return
+	}
+	if meta == nil {
+		if _, err = s.checkDifficulty(key); err != nil {
+			return
+		}
+	}
+	signature, err := hex.DecodeString(board.Signature)
+	if err != nil {
+		return false, errors.Wrap(ErrInvalidSignature, "Could not decode signature")
+	}
+	if board.Modified, err = s.validateIncomingBody(key, board.Bytes(), now, nil); err != nil {
+		return
+	}
+	if board.ContentType, err = validateContentType(board.ContentType); err != nil {
+		return
+	}
+	if err = s.verifier.Verify(key, board.Bytes(), signature); err != nil {
+		return
+	}
+	err = s.repo.PublishBoard(*board)
+	if errors.Is(err, ErrStaleBoard) {
+		return false, nil
+	}
+	return err == nil, err
+}
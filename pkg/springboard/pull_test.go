@@ -0,0 +1,106 @@
+package springboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStubPeer serves boards as a federate would, listing them in its index
+// and serving them raw, without checking them.
+func newStubPeer(t *testing.T, boards []Board) *httptest.Server {
+	byKey := map[string]Board{}
+	index := Index{}
+	for _, board := range boards {
+		byKey[board.Key] = board
+		index.Boards = append(index.Boards, IndexEntry{Key: board.Key, Posted: board.Modified})
+	}
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.json" {
+			json.NewEncoder(w).Encode(index)
+			return
+		}
+		board, found := byKey[strings.TrimPrefix(r.URL.Path, "/")]
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html;charset=utf-8")
+		w.Header().Set("Spring-Signature", board.Signature)
+		w.Write([]byte(board.Board))
+	}))
+	t.Cleanup(peer.Close)
+	return peer
+}
+
+func TestPullAppliesPublishChecks(t *testing.T) {
+	now := time.Now()
+	good := testBoard(testKey(1), now, "<p>good</p>")
+	forged := testBoard(testKey(2), now, "<p>forged</p>")
+	forged.Signature = good.Signature
+	farFuture := testBoard(testKeyExpiring(3, now.AddDate(5, 0, 0)), now, "<p>too far ahead</p>")
+	tagOnly := testBoard(testKey(4), now, "")
+	empty := Board{Key: testKey(5), Modified: now, Signature: testBoard(testKey(5), now, "").Signature}
+	hard := testBoard("ffffffffffffffff"+testKey(6)[16:], now, "<p>too hard</p>")
+	denied := testBoard(testKey(7), now, "<p>buy pills</p>")
+
+	peer := newStubPeer(t, []Board{good, forged, farFuture, tagOnly, empty, hard, denied})
+	server := newTestServer(t, ServerConfig{
+		RejectTagOnlyBoards: true,
+		ContentDenyPatterns: []string{"pills"},
+	})
+	pulled, err := server.pullFrom(peer.URL, now)
+	if err != nil {
+		t.Fatalf("Pull failed: %s", err)
+	}
+	if pulled != 1 {
+		t.Errorf("Pulled %d boards, want only the valid one", pulled)
+	}
+	if stored, _ := server.repo.GetBoard(good.Key); stored == nil || stored.Board != good.Board {
+		t.Errorf("Valid board wasn't pulled")
+	}
+	for name, board := range map[string]Board{
+		"forged signature":        forged,
+		"key beyond the horizon":  farFuture,
+		"tag-only board":          tagOnly,
+		"empty board":             empty,
+		"key over the difficulty": hard,
+		"denied content":          denied,
+	} {
+		if stored, _ := server.repo.GetBoard(board.Key); stored != nil {
+			t.Errorf("Pulled a board with a %s", name)
+		}
+	}
+
+	// A key already stored isn't held to the difficulty threshold.
+	older := testBoard(hard.Key, now.Add(-time.Hour), "<p>older</p>")
+	mustPublish(t, server.repo, older)
+	if pulled, _ := server.pullFrom(peer.URL, now); pulled != 1 {
+		t.Errorf("Pulled %d boards, want the newer board for the stored hard key", pulled)
+	}
+}
+
+func TestPullSkipsBoardsPastTheTTL(t *testing.T) {
+	now := time.Now()
+	ttl := 24 * time.Hour
+	recent := testBoard(testKey(1), now.Add(-time.Hour), "<p>recent</p>")
+	purged := testBoard(testKey(2), now.Add(-2*ttl), "<p>purged here</p>")
+	peer := newStubPeer(t, []Board{recent, purged})
+
+	server := newTestServer(t, ServerConfig{BoardTTL: ttl})
+	if pulled, err := server.pullFrom(peer.URL, now); err != nil || pulled != 1 {
+		t.Errorf("Pulled %d boards (%v), want only the one within the TTL", pulled, err)
+	}
+	if stored, _ := server.repo.GetBoard(purged.Key); stored != nil {
+		t.Errorf("Pulled a board our purge would delete")
+	}
+
+	// Boards are only purged by key expiry under that policy.
+	server = newTestServer(t, ServerConfig{BoardTTL: ttl, PurgePolicy: PurgeKeyExpiry})
+	if pulled, err := server.pullFrom(peer.URL, now); err != nil || pulled != 2 {
+		t.Errorf("Pulled %d boards (%v) under the key expiry policy, want 2", pulled, err)
+	}
+}
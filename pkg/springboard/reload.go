@@ -0,0 +1,154 @@
+package springboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// reloadableSettings are the settings POST /admin/reload can change while the
+// server runs. They're replaced as a whole, so each request sees either the
+// old settings or the new ones.
+type reloadableSettings struct {
+	notice              string
+	federates           []string
+	propagateTo         []string
+	publishGate         PublishGate
+	contentDenyPatterns []*regexp.Regexp
+	requestLimiter      *requestLimiter
+	webhooks            []string
+}
+
+// reloadableFields are the ServerConfig fields reloadableSettings come from.
+var reloadableFields = map[string]bool{
+	"Notice":              true,
+	"Federates":           true,
+	"PropagateTo":         true,
+	"PublishGate":         true,
+	"ContentDenyPatterns": true,
+	"MaxConcurrentReads":  true,
+	"MaxConcurrentWrites": true,
+	"Webhooks":            true,
+}
+
+// newReloadableSettings validates config's reloadable settings and fills in
+// their defaults.
+func newReloadableSettings(config ServerConfig) (*reloadableSettings, error) {
+	maxFederates := config.MaxFederates
+	if maxFederates == 0 {
+		maxFederates = DefaultMaxFederates
+	}
+	if err := validateFederates("federates", config.Federates, maxFederates); err != nil {
+		return nil, err
+	}
+	if err := validateFederates("propagate_to", config.PropagateTo, maxFederates); err != nil {
+		return nil, err
+	}
+	if err := validateWebhooks(config.Webhooks); err != nil {
+		return nil, err
+	}
+	contentDenyPatterns, err := compileDenyPatterns(config.ContentDenyPatterns)
+	if err != nil {
+		return nil, err
+	}
+	settings := &reloadableSettings{
+		notice:              config.Notice,
+		federates:           config.Federates,
+		propagateTo:         config.PropagateTo,
+		publishGate:         config.PublishGate,
+		contentDenyPatterns: contentDenyPatterns,
+		requestLimiter:      newRequestLimiter(config.MaxConcurrentReads, config.MaxConcurrentWrites),
+		webhooks:            config.Webhooks,
+	}
+	if settings.propagateTo == nil {
+		settings.propagateTo = settings.federates
+	}
+	if settings.publishGate == nil {
+		settings.publishGate = AllowAllGate{}
+	}
+	return settings, nil
+}
+
+// settings returns the server's current reloadable settings.
+func (s *Spring83Server) settings() *reloadableSettings {
+	return s.reloadable.Load().(*reloadableSettings)
+}
+
+// restartRequired lists the settings in config, other than reloadable ones,
+// that differ from those the server started with. Functions and interfaces,
+// like BoardTransformer, can't be compared and are left out.
+func (s *Spring83Server) restartRequired(config ServerConfig) []string {
+	changed := []string{}
+	running := reflect.ValueOf(s.config)
+	reloaded := reflect.ValueOf(config)
+	for i := 0; i < running.NumField(); i++ {
+		field := running.Type().Field(i)
+		if reloadableFields[field.Name] {
+			continue
+		}
+		if kind := field.Type.Kind(); kind == reflect.Func || kind == reflect.Interface {
+			continue
+		}
+		if !reflect.DeepEqual(running.Field(i).Interface(), reloaded.Field(i).Interface()) {
+			changed = append(changed, field.Name)
+		}
+	}
+	return changed
+}
+
+// reloadConfig re-reads the server's configuration when the admin board's
+// owner asks with POST /admin/reload, and swaps in its reloadable settings:
+// the notice, federates, publish allowlist, content deny patterns, and
+// request limits. Other settings that changed are listed as requiring a
+// restart; they're left as they were.
+func (s *Spring83Server) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	if s.config.ReloadConfig == nil {
+		http.Error(w, "Reloading is disabled", http.StatusNotFound)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	config, err := s.config.ReloadConfig()
+	if err != nil {
+		log.Printf("Could not reload the configuration: %s", err)
+		http.Error(w, fmt.Sprintf("Could not reload the configuration: %s", err), http.StatusBadRequest)
+		return
+	}
+	settings, err := newReloadableSettings(config)
+	if err != nil {
+		log.Printf("Could not reload the configuration: %s", err)
+		http.Error(w, fmt.Sprintf("Could not reload the configuration: %s", err), http.StatusBadRequest)
+		return
+	}
+	// Requests in flight hold slots in the running limiter, so it's kept
+	// unless the limits changed. A new one starts out empty and can let
+	// through more requests than its limits until those finish.
+	if running := s.settings().requestLimiter; running.hasLimits(config.MaxConcurrentReads, config.MaxConcurrentWrites) {
+		settings.requestLimiter = running
+	}
+	s.reloadable.Store(settings)
+	restartRequired := s.restartRequired(config)
+	log.Printf("Reloaded the configuration")
+	if len(restartRequired) > 0 {
+		log.Printf("  changes to %s take effect after a restart", strings.Join(restartRequired, ", "))
+	}
+
+	response, err := json.Marshal(struct {
+		RestartRequired []string `json:"restartRequired"`
+	}{restartRequired})
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(response)
+}
@@ -0,0 +1,90 @@
+package springboard
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReloadSwapsDenylist(t *testing.T) {
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServerConfig{AdminBoard: hex.EncodeToString(pubkey)}
+	onDisk := config
+	config.ReloadConfig = func() (ServerConfig, error) { return onDisk, nil }
+	server := newTestServer(t, config)
+	now := time.Now()
+
+	if w := put(server, testBoard(testKey(1), now, "<p>cheap pills</p>")); w.Code != http.StatusOK {
+		t.Fatalf("Board before the reload got %d: %s", w.Code, w.Body.String())
+	}
+
+	onDisk.ContentDenyPatterns = []string{`cheap pills`}
+	onDisk.IndexPageSize = 10
+	if w := serve(server, httptest.NewRequest(http.MethodPost, "/admin/reload", nil)); w.Code != http.StatusForbidden {
+		t.Errorf("Reload without Spring-Auth got %d, want 403", w.Code)
+	}
+	if w := put(server, testBoard(testKey(2), now, "<p>cheap pills</p>")); w.Code != http.StatusOK {
+		t.Errorf("A rejected reload changed the denylist: got %d", w.Code)
+	}
+
+	w := serve(server, adminRequest(t, server, privkey, http.MethodPost, "/admin/reload"))
+	if w.Code != http.StatusOK || w.Body.String() != `{"restartRequired":["IndexPageSize"]}` {
+		t.Errorf("Reload got %d %q, want 200 with IndexPageSize requiring a restart", w.Code, w.Body.String())
+	}
+	if w := put(server, testBoard(testKey(3), now, "<p>cheap pills</p>")); w.Code != http.StatusForbidden {
+		t.Errorf("Board after the reload got %d, want 403", w.Code)
+	}
+	if w := put(server, testBoard(testKey(4), now, "<p>hello</p>")); w.Code != http.StatusOK {
+		t.Errorf("Clean board after the reload got %d: %s", w.Code, w.Body.String())
+	}
+
+	onDisk.ContentDenyPatterns = []string{`(unclosed`}
+	if w := serve(server, adminRequest(t, server, privkey, http.MethodPost, "/admin/reload")); w.Code != http.StatusBadRequest {
+		t.Errorf("Reloading an invalid pattern got %d, want 400", w.Code)
+	}
+	if w := put(server, testBoard(testKey(5), now, "<p>cheap pills</p>")); w.Code != http.StatusForbidden {
+		t.Errorf("A failed reload dropped the denylist: got %d", w.Code)
+	}
+}
+
+func TestReloadKeepsRequestLimiter(t *testing.T) {
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServerConfig{AdminBoard: hex.EncodeToString(pubkey), MaxConcurrentReads: 2}
+	onDisk := config
+	config.ReloadConfig = func() (ServerConfig, error) { return onDisk, nil }
+	server := newTestServer(t, config)
+	limiter := server.settings().requestLimiter
+	// A read in flight across the reload.
+	limiter.readSlots <- struct{}{}
+
+	onDisk.Notice = "hello"
+	if w := serve(server, adminRequest(t, server, privkey, http.MethodPost, "/admin/reload")); w.Code != http.StatusOK {
+		t.Fatalf("Reload got %d: %s", w.Code, w.Body.String())
+	}
+	if server.settings().requestLimiter != limiter {
+		t.Fatalf("Reloading with the same limits replaced the request limiter")
+	}
+	limiter.readSlots <- struct{}{}
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "/", nil)); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("A read past the limit after reloading got %d, want 503", w.Code)
+	}
+	<-limiter.readSlots
+	<-limiter.readSlots
+
+	onDisk.MaxConcurrentReads = 3
+	if w := serve(server, adminRequest(t, server, privkey, http.MethodPost, "/admin/reload")); w.Code != http.StatusOK {
+		t.Fatalf("Reload got %d: %s", w.Code, w.Body.String())
+	}
+	if resized := server.settings().requestLimiter; resized == limiter || cap(resized.readSlots) != 3 {
+		t.Errorf("Reloading new limits didn't apply them")
+	}
+}
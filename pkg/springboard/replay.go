@@ -0,0 +1,47 @@
+package springboard
+
+import (
+	"log"
+	"time"
+)
+
+// replayInterval is how long the startup replay waits between boards, so a
+// server with many boards doesn't flood its federates when it restarts.
+const replayInterval = 250 * time.Millisecond
+
+// replayRecentBoards relays every board modified within the board TTL to
+// federates again, waiting interval between boards. Boards received while a
+// federate was down never reached it, and it may not pull them itself.
+// Relays go through the propagation tracker like any other, so a board that's
+// already queued for a federate isn't queued twice.
+func (s *Spring83Server) replayRecentBoards(now time.Time, interval time.Duration) (replayed int, err error) {
+	// Only keys are collected, so the boards aren't all held in memory while
+	// the replay is spread out.
+	keys := []string{}
+	err = s.repo.IterateBoards(func(board Board) error {
+		// Boards migrated without a signature would be rejected anyway.
+		if board.Modified.After(now.Add(-s.boardTTL)) && !keyExpired(board.Key, now) && board.Signature != "" {
+			keys = append(keys, board.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	log.Printf("Replaying %d recent boards to federates", len(keys))
+	for i, key := range keys {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		board, err := s.repo.GetBoard(key)
+		if err != nil {
+			return replayed, err
+		}
+		if board == nil {
+			continue // deleted since the replay started
+		}
+		s.propagateBoard(*board, nil)
+		replayed++
+	}
+	return
+}
@@ -0,0 +1,493 @@
+package springboard
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestPublishBoardOnlyReplacesOlderBoards(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		key := testKey(1)
+		modified := time.Now().Add(-time.Hour)
+		current := testBoard(key, modified, "current")
+		mustPublish(t, repo, current)
+
+		for _, stale := range []Board{
+			testBoard(key, modified, "same time"),
+			testBoard(key, modified.Add(-time.Minute), "older"),
+		} {
+			if err := repo.PublishBoard(stale); !errors.Is(err, ErrStaleBoard) {
+				t.Errorf("Publishing %q got %v, want ErrStaleBoard", stale.Board, err)
+			}
+			if stored, _ := repo.GetBoard(key); stored == nil || stored.Board != current.Board {
+				t.Errorf("Publishing %q replaced the current board with %+v", stale.Board, stored)
+			}
+		}
+
+		newer := testBoard(key, modified.Add(time.Minute), "newer")
+		if err := repo.PublishBoard(newer); err != nil {
+			t.Fatalf("Publishing a newer board got %v", err)
+		}
+		stored, err := repo.GetBoard(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored == nil || stored.Board != newer.Board || stored.Signature != newer.Signature || !stored.Modified.Equal(newer.Modified) {
+			t.Errorf("Stored %+v, want %+v", stored, newer)
+		}
+	})
+}
+
+func TestGetAllBoardsIncludesSignatures(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		published := map[string]Board{}
+		for i := 1; i <= 3; i++ {
+			board := testBoard(testKey(i), time.Now().Add(-time.Duration(i)*time.Minute), fmt.Sprintf("board %d", i))
+			mustPublish(t, repo, board)
+			published[board.Key] = board
+		}
+
+		boards, err := repo.GetAllBoards()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(boards) != len(published) {
+			t.Fatalf("Got %d boards, want %d", len(boards), len(published))
+		}
+		for _, board := range boards {
+			want := published[board.Key]
+			if board.Signature != want.Signature || board.Board != want.Board || !board.Modified.Equal(want.Modified) {
+				t.Errorf("Got %+v, want %+v", board, want)
+			}
+		}
+	})
+}
+
+func TestWithTxRollsBackOnFailure(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		kept := testBoard(testKey(1), time.Now().Add(-time.Hour), "kept")
+		mustPublish(t, repo, kept)
+		deleted := testBoard(testKey(3), time.Now().Add(-time.Hour), "deleted")
+		mustPublish(t, repo, deleted)
+
+		failure := errors.New("failed midway")
+		err := repo.WithTx(func(tx BoardRepo) error {
+			if err := tx.PublishBoard(testBoard(testKey(1), time.Now(), "replaced")); err != nil {
+				return err
+			}
+			if err := tx.PublishBoard(testBoard(testKey(2), time.Now(), "added")); err != nil {
+				return err
+			}
+			if err := tx.DeleteBoard(testKey(3)); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("WithTx returned %v, want the function's error", err)
+		}
+		if stored, _ := repo.GetBoard(kept.Key); stored == nil || stored.Board != kept.Board {
+			t.Errorf("Rolled back transaction replaced a board with %+v", stored)
+		}
+		if stored, _ := repo.GetBoard(testKey(2)); stored != nil {
+			t.Errorf("Rolled back transaction added a board")
+		}
+		if stored, _ := repo.GetBoard(deleted.Key); stored == nil {
+			t.Errorf("Rolled back transaction deleted a board")
+		}
+
+		err = repo.WithTx(func(tx BoardRepo) error {
+			return tx.PublishBoard(testBoard(testKey(2), time.Now(), "added"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored, _ := repo.GetBoard(testKey(2)); stored == nil {
+			t.Errorf("Committed transaction didn't add its board")
+		}
+	})
+}
+
+func TestPropagationLog(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		loggedAt := time.Now().UTC().Truncate(time.Second)
+		entries := []PropagationLogEntry{
+			{Key: testKey(1), Destination: "https://old.example", Outcome: PropagationSucceeded, Attempts: 1, LoggedAt: loggedAt.Add(-2 * time.Hour)},
+			{Key: testKey(1), Destination: "https://a.example", Outcome: PropagationSucceeded, Attempts: 1, LoggedAt: loggedAt.Add(-time.Minute)},
+			{Key: testKey(2), Destination: "https://b.example", Outcome: PropagationGaveUp, Attempts: 6, LoggedAt: loggedAt},
+		}
+		for _, entry := range entries {
+			if err := repo.LogPropagation(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		logged, err := repo.GetPropagationLog(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logged) != 2 || logged[0] != entries[2] || logged[1] != entries[1] {
+			t.Errorf("Got %+v, want the two newest entries, newest first", logged)
+		}
+
+		if err := repo.DeletePropagationLogBefore(loggedAt.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if logged, _ := repo.GetPropagationLog(10); len(logged) != 2 {
+			t.Errorf("Got %d entries after purging, want 2", len(logged))
+		}
+	})
+}
+
+func TestGetBoardMeta(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		board := testBoard(testKey(1), time.Now(), "<p>hello</p>")
+		mustPublish(t, repo, board)
+
+		meta, err := repo.GetBoardMeta(board.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta == nil || meta.Key != board.Key || !meta.Modified.Equal(board.Modified) || meta.Signature != board.Signature || meta.ContentHash != board.ContentHash() {
+			t.Errorf("Metadata is %+v, want that of %+v", meta, board)
+		}
+
+		if meta, err := repo.GetBoardMeta(testKey(2)); err != nil || meta != nil {
+			t.Errorf("Metadata for a key without a board is %+v (%v), want nil", meta, err)
+		}
+	})
+}
+
+func TestDeleteAllBoards(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		if deleted, err := repo.DeleteAllBoards(); err != nil || deleted != 0 {
+			t.Errorf("Deleting from an empty repo got %d (%v), want 0", deleted, err)
+		}
+		for i := 1; i <= 3; i++ {
+			mustPublish(t, repo, testBoard(testKey(i), time.Now(), "hello"))
+		}
+		deleted, err := repo.DeleteAllBoards()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != 3 {
+			t.Errorf("Deleted %d boards, want 3", deleted)
+		}
+		if count, _ := repo.BoardCount(); count != 0 {
+			t.Errorf("%d boards are left", count)
+		}
+		if board, _ := repo.GetBoard(testKey(1)); board != nil {
+			t.Errorf("Board is still stored: %+v", board)
+		}
+	})
+}
+
+func TestDeletingBoardsDeletesTheirViews(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		now := time.Now().UTC().Truncate(time.Second)
+		for i := 1; i <= 5; i++ {
+			modified := now
+			if i == 4 {
+				modified = now.AddDate(0, 0, -40)
+			}
+			mustPublish(t, repo, testBoard(testKey(i), modified, "hello"))
+			if err := repo.IncrementViews(testKey(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := repo.DeleteBoard(testKey(1)); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.DeleteBoardOlderThan(testKey(2), now.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.DeleteBoardsBefore(now.AddDate(0, 0, -30).Format(time.RFC3339)); err != nil {
+			t.Fatal(err)
+		}
+		views, err := repo.GetViewCounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(views) != 2 || views[testKey(3)] != 1 || views[testKey(5)] != 1 {
+			t.Errorf("Views after deleting boards = %v, want only %s and %s", views, testKey(3), testKey(5))
+		}
+
+		if _, err := repo.DeleteAllBoards(); err != nil {
+			t.Fatal(err)
+		}
+		if views, err = repo.GetViewCounts(); err != nil || len(views) != 0 {
+			t.Errorf("Views after deleting all boards = %v (%v), want none", views, err)
+		}
+	})
+}
+
+func TestTombstonesRefuseOlderBoards(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		now := time.Now().UTC().Truncate(time.Second)
+		key := testKey(1)
+		mustPublish(t, repo, testBoard(key, now.Add(-time.Hour), "deleted"))
+		if err := repo.DeleteBoardOlderThan(key, now.Add(-30*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		// An older tombstone doesn't move the newer one back.
+		if err := repo.DeleteBoardOlderThan(key, now.Add(-50*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		for _, modified := range []time.Time{now.Add(-time.Hour), now.Add(-40 * time.Minute), now.Add(-30 * time.Minute)} {
+			if err := repo.PublishBoard(testBoard(key, modified, "resurrected")); !errors.Is(err, ErrStaleBoard) {
+				t.Errorf("Publishing a board from %s before the tombstone got %v, want ErrStaleBoard", now.Add(-30*time.Minute).Sub(modified), err)
+			}
+		}
+		if stored, _ := repo.GetBoard(key); stored != nil {
+			t.Errorf("A board older than its tombstone was stored: %+v", stored)
+		}
+		if err := repo.PublishBoard(testBoard(key, now.Add(-time.Minute), "newer")); err != nil {
+			t.Errorf("Publishing a board newer than the tombstone got %v", err)
+		}
+
+		// A tombstone is recorded without a board to delete too, and
+		// forgotten once it's old enough.
+		other := testKey(2)
+		if err := repo.DeleteBoardOlderThan(other, now.Add(-30*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.PublishBoard(testBoard(other, now.Add(-time.Hour), "older")); !errors.Is(err, ErrStaleBoard) {
+			t.Errorf("Publishing a board older than a tombstone without a board got %v, want ErrStaleBoard", err)
+		}
+		if err := repo.DeleteTombstonesBefore(now.Add(-20 * time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.PublishBoard(testBoard(other, now.Add(-time.Hour), "older")); err != nil {
+			t.Errorf("Publishing after the tombstone was forgotten got %v", err)
+		}
+	})
+}
+
+func TestGetBoards(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		first := testBoard(testKey(1), time.Now(), "first")
+		second := testBoard(testKey(2), time.Now(), "second")
+		mustPublish(t, repo, first)
+		mustPublish(t, repo, second)
+
+		boards, err := repo.GetBoards([]string{first.Key, testKey(3), second.Key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(boards) != 2 {
+			t.Errorf("Got %d boards, want the 2 that exist", len(boards))
+		}
+		for _, want := range []Board{first, second} {
+			if got, found := boards[want.Key]; !found || got.Board != want.Board || got.Signature != want.Signature {
+				t.Errorf("Got %+v for %s, want %+v", got, want.Key, want)
+			}
+		}
+		if _, found := boards[testKey(3)]; found {
+			t.Errorf("Got a board for a key that has none")
+		}
+
+		if boards, err := repo.GetBoards(nil); err != nil || len(boards) != 0 {
+			t.Errorf("Getting no keys got %v (%v), want no boards", boards, err)
+		}
+	})
+}
+
+func TestIterateBoardsStopsEarly(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		for i := 1; i <= 5; i++ {
+			mustPublish(t, repo, testBoard(testKey(i), time.Now().Add(-time.Duration(i)*time.Minute), "hello"))
+		}
+
+		visited := []string{}
+		err := repo.IterateBoards(func(board Board) error {
+			visited = append(visited, board.Key)
+			return nil
+		})
+		if err != nil || len(visited) != 5 || visited[0] != testKey(1) || visited[4] != testKey(5) {
+			t.Fatalf("Iterating visited %v (%v), want all 5 boards newest first", visited, err)
+		}
+
+		stop := errors.New("stop")
+		visited = nil
+		err = repo.IterateBoards(func(board Board) error {
+			visited = append(visited, board.Key)
+			if len(visited) == 2 {
+				return stop
+			}
+			return nil
+		})
+		if !errors.Is(err, stop) {
+			t.Errorf("Iterating returned %v, want fn's error", err)
+		}
+		if len(visited) != 2 {
+			t.Errorf("Iterating visited %d boards after fn failed on the second", len(visited))
+		}
+
+		// The rows were closed, so their connection went back to the pool.
+		var conn *sql.DB
+		switch repo := repo.(type) {
+		case *SqliteRepo:
+			conn = repo.conn
+		case *PostgresRepo:
+			conn = repo.conn
+		}
+		if inUse := conn.Stats().InUse; inUse != 0 {
+			t.Errorf("%d connections are still in use after stopping early", inUse)
+		}
+		mustPublish(t, repo, testBoard(testKey(6), time.Now(), "after"))
+	})
+}
+
+// storedContentHash reads the content_hash column of key's board.
+func storedContentHash(t *testing.T, repo BoardRepo, key string) string {
+	t.Helper()
+	var row *sql.Row
+	switch repo := repo.(type) {
+	case *SqliteRepo:
+		row = repo.db.QueryRow(`SELECT content_hash FROM boards WHERE key=?`, key)
+	case *PostgresRepo:
+		row = repo.db.QueryRow(`SELECT content_hash FROM boards WHERE key=$1`, key)
+	default:
+		t.Fatalf("Can't read the content hash from a %T", repo)
+	}
+	var hash sql.NullString
+	if err := row.Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	return hash.String
+}
+
+func TestContentHashIsStored(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		board := testBoard(testKey(1), time.Now().Add(-time.Minute), "<p>hello</p>")
+		mustPublish(t, repo, board)
+		sum := sha256.Sum256([]byte(board.Board))
+		if hash := storedContentHash(t, repo, board.Key); hash != hex.EncodeToString(sum[:]) || hash != board.ContentHash() {
+			t.Errorf("Stored content hash is %q, want %x", hash, sum)
+		}
+
+		newer := testBoard(testKey(1), time.Now(), "<p>changed</p>")
+		mustPublish(t, repo, newer)
+		sum = sha256.Sum256([]byte(newer.Board))
+		if hash := storedContentHash(t, repo, newer.Key); hash != hex.EncodeToString(sum[:]) {
+			t.Errorf("Stored content hash after a newer board is %q, want %x", hash, sum)
+		}
+	})
+}
+
+func TestSqliteBackfillsContentHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "springboard.db")
+	repo := newSqliteRepo(path)
+	board := testBoard(testKey(1), time.Now(), "<p>hello</p>")
+	mustPublish(t, repo, board)
+	if _, err := repo.conn.Exec(`UPDATE boards SET content_hash=NULL`); err != nil {
+		t.Fatal(err)
+	}
+	repo.conn.Close()
+
+	repo = newSqliteRepo(path)
+	defer repo.conn.Close()
+	if hash := storedContentHash(t, repo, board.Key); hash != board.ContentHash() {
+		t.Errorf("Backfilled content hash is %q, want %q", hash, board.ContentHash())
+	}
+}
+
+func TestFeaturedKeys(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		if keys, err := repo.GetFeaturedKeys(); err != nil || len(keys) != 0 {
+			t.Errorf("Featured keys before any were set are %v (%v), want none", keys, err)
+		}
+
+		for _, want := range [][]string{
+			{testKey(3), testKey(1), testKey(2)},
+			{testKey(2)},
+			{},
+		} {
+			if err := repo.SetFeaturedKeys(want); err != nil {
+				t.Fatal(err)
+			}
+			keys, err := repo.GetFeaturedKeys()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(want) {
+				t.Errorf("Featured keys are %v, want %v", keys, want)
+			}
+		}
+	})
+}
+
+func TestRecordVerification(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		now := time.Now()
+		good := testBoard(testKey(1), now.Add(-3*time.Minute), "<p>good</p>")
+		corrupted := testBoard(testKey(2), now.Add(-2*time.Minute), "<p>corrupted</p>")
+		unchecked := testBoard(testKey(3), now.Add(-time.Minute), "<p>unchecked</p>")
+		for _, board := range []Board{good, corrupted, unchecked} {
+			mustPublish(t, repo, board)
+		}
+
+		if err := repo.RecordVerification(good, now, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.RecordVerification(corrupted, now, false); err != nil {
+			t.Fatal(err)
+		}
+		if verified, quarantined, err := repo.GetVerificationCounts(); err != nil || verified != 1 || quarantined != 1 {
+			t.Errorf("Counts are %d verified and %d quarantined (%v), want 1 and 1", verified, quarantined, err)
+		}
+
+		toVerify, err := repo.GetBoardsToVerify(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys := boardKeys(toVerify); fmt.Sprint(keys) != fmt.Sprint([]string{unchecked.Key, good.Key}) {
+			t.Errorf("Boards to verify are %v, want the unchecked one, then the verified one", keys)
+		}
+		if board, err := repo.GetBoard(corrupted.Key); err != nil || board != nil {
+			t.Errorf("Quarantined board was read: %+v (%v)", board, err)
+		}
+		if meta, err := repo.GetBoardMeta(corrupted.Key); err != nil || meta != nil {
+			t.Errorf("Quarantined board's metadata was read: %+v (%v)", meta, err)
+		}
+		all, err := repo.GetAllBoards()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys := boardKeys(all); fmt.Sprint(keys) != fmt.Sprint([]string{unchecked.Key, good.Key}) {
+			t.Errorf("All boards are %v, want the quarantined one left out", keys)
+		}
+
+		// Verifying a board that has since been replaced leaves the new one
+		// alone, and a new board clears the quarantine.
+		replacement := testBoard(testKey(1), now, "<p>replaced</p>")
+		mustPublish(t, repo, replacement)
+		if err := repo.RecordVerification(good, now, false); err != nil {
+			t.Fatal(err)
+		}
+		if board, _ := repo.GetBoard(good.Key); board == nil || board.Board != replacement.Board {
+			t.Errorf("Quarantining a replaced board hid its replacement: %+v", board)
+		}
+		fixed := testBoard(testKey(2), now, "<p>fixed</p>")
+		mustPublish(t, repo, fixed)
+		if board, _ := repo.GetBoard(fixed.Key); board == nil || board.Board != fixed.Board {
+			t.Errorf("A new board for a quarantined key isn't served: %+v", board)
+		}
+	})
+}
+
+// boardKeys returns the keys of boards, in order.
+func boardKeys(boards []Board) []string {
+	keys := []string{}
+	for _, board := range boards {
+		keys = append(keys, board.Key)
+	}
+	return keys
+}
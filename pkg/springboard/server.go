@@ -1,47 +1,364 @@
 package springboard
 
 import (
-	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/ed25519"
+	"database/sql"
 	_ "embed"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
 	"math/rand"
+	"net"
 	"net/http"
-	"regexp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
+	"github.com/pkg/errors"
 )
 
-const max_sig = (1 << 256) - 1
+// ServerConfig holds the settings RunServer needs to start a server.
+type ServerConfig struct {
+	Port                uint
+	Federates           []string // peers advertised in /federation.txt
+	PropagateTo         []string // peers boards are pushed to (defaults to Federates)
+	AdminBoard          string
+	FQDN                string
+	PropagateWait       time.Duration
+	SQLDriver           string
+	SQLConnectionString string
+	// Notice is shown in a banner at the top of the index page when set.
+	Notice string
+	// AllowFormPosts enables publishing boards with a multipart POST to /.
+	// This isn't part of the spec's transport, so it's off by default.
+	AllowFormPosts bool
+	// BoardTTL is how long boards are kept (defaults to DefaultBoardTTL).
+	BoardTTL time.Duration
+	// PurgePolicy decides whether boards are purged by TTL, key expiry, or
+	// whichever comes first (defaults to PurgeFixedTTL).
+	PurgePolicy PurgePolicy
+	// CountViews counts GETs of each board, ignoring repeat views from the
+	// same address, and shows the counts on the index.
+	CountViews bool
+	// StaticDir, if set, is served under /static/. A favicon.svg in it
+	// replaces the index page's default favicon.
+	StaticDir string
+	// ServeExpiredBoards keeps serving boards whose keys have expired but
+	// haven't been purged yet, instead of responding 410 Gone. Such boards are
+	// left out of the index either way.
+	ServeExpiredBoards bool
+	// BootstrapBoard is the path to a board, signed with the admin board's
+	// key, that's published as the admin board on startup if the admin key
+	// doesn't have a board yet. BootstrapSignature is its hex signature.
+	BootstrapBoard     string
+	BootstrapSignature string
+	// AdminKeyPath is a folder with the admin board's key pair. When set, the
+	// server re-signs the admin board with a fresh <time> tag every
+	// AdminRefreshInterval (defaults to DefaultAdminRefreshInterval) so it
+	// never ages out.
+	AdminKeyPath         string
+	AdminRefreshInterval time.Duration
+	// PublishGate decides who may publish boards (defaults to AllowAllGate).
+	PublishGate PublishGate
+	// PullInterval is how often to pull boards we're missing from each
+	// federate's /index.json (0 disables pulling).
+	PullInterval time.Duration
+	// NoDifficulty accepts new keys regardless of the difficulty factor, so
+	// client developers can test with easily generated keys. Not for
+	// production.
+	NoDifficulty bool
+	// BoardTransformer rewrites boards shown in a browser (defaults to
+	// PassthroughTransformer).
+	BoardTransformer BoardTransformer
+	// IndexPageSize is how many boards the index page shows at a time
+	// (defaults to DefaultIndexPageSize).
+	IndexPageSize int
+	// WrapBoardPages shows boards opened directly in a browser tab inside a
+	// page with the board's key, times, and a link back to the index.
+	WrapBoardPages bool
+	// EnableComposer serves a page at /compose for writing, signing, and
+	// posting a board from the browser.
+	EnableComposer bool
+	// LenientTimeTags accepts boards without a <time> tag when they're PUT
+	// with an If-Unmodified-Since header, using the header's time instead.
+	// It's deprecated and only meant for clients that predate the tag.
+	LenientTimeTags bool
+	// LogPropagation records the outcome of every relay to a federate in the
+	// propagation_log table, readable by the admin at /admin/propagation-log.
+	LogPropagation bool
+	// PropagationLogRetention is how long propagation log entries are kept
+	// (defaults to DefaultPropagationLogRetention).
+	PropagationLogRetention time.Duration
+	// MaxConcurrentPropagations is how many relays to federates may run at
+	// once (defaults to DefaultMaxConcurrentPropagations).
+	MaxConcurrentPropagations int
+	// MaxFederates is the most servers Federates and PropagateTo may each
+	// list (defaults to DefaultMaxFederates).
+	MaxFederates int
+	// RequestTimeout is how long a request may take before the server gives
+	// up with 503 Service Unavailable (defaults to DefaultRequestTimeout).
+	RequestTimeout time.Duration
+	// PinnedBoards are shown first on the index, in this order, when
+	// IndexOrder is IndexOrderPinned.
+	PinnedBoards []string
+	// IndexOrder is how boards are ordered on the index (defaults to
+	// IndexOrderModified).
+	IndexOrder IndexOrder
+	// RejectTagOnlyBoards rejects PUTs of boards with nothing but a <time>
+	// tag, instead of storing them as blank boards.
+	RejectTagOnlyBoards bool
+	// LogViaChain logs every server a relayed board or tombstone passed
+	// through, to help find relay loops between federates.
+	LogViaChain bool
+	// SignatureScheme is how board signatures are verified (defaults to
+	// DefaultSignatureScheme, currently the only one).
+	SignatureScheme SignatureScheme
+	// AllowBoardConnections lets boards' scripts make requests to any
+	// origin (connect-src *). By default they can't connect anywhere.
+	AllowBoardConnections bool
+	// MaxHeaderBytes is the most bytes of request headers the server reads
+	// (defaults to DefaultMaxHeaderBytes).
+	MaxHeaderBytes int
+	// ContentDenyPatterns are regular expressions; boards whose HTML
+	// matches any of them are rejected.
+	ContentDenyPatterns []string
+	// PropagationBacklogDepth is how many relays may be queued before
+	// /readyz reports the server as degraded (defaults to
+	// DefaultPropagationBacklogDepth).
+	PropagationBacklogDepth int
+	// PropagationBacklogAge is how long a relay may wait in the queue
+	// before /readyz reports the server as degraded (defaults to
+	// DefaultPropagationBacklogAge).
+	PropagationBacklogAge time.Duration
+	// PathPrefix is the path the server is mounted under, e.g. "/spring",
+	// when it shares its domain with other content. It's stripped from
+	// requests before routing, and added to the links in the pages the server
+	// renders. Empty serves from the root.
+	PathPrefix string
+	// MinifyBoards minifies boards' HTML when they're displayed in a
+	// browser. Raw boards and the stored, signed bytes are left as they are.
+	MinifyBoards bool
+	// ReplayOnStartup relays every board modified within the board TTL to
+	// federates again when the server starts, so that boards it received while
+	// a federate was down reach it.
+	ReplayOnStartup bool
+	// ReloadConfig returns the server's configuration as it is now, e.g.
+	// re-read from its config file, for POST /admin/reload. Reloading is
+	// disabled when it's nil.
+	ReloadConfig func() (ServerConfig, error)
+	// MaxConcurrentReads caps how many GET, HEAD, and OPTIONS requests the
+	// server handles at once. Requests beyond it get 503 Service Unavailable.
+	// Zero is unlimited.
+	MaxConcurrentReads int
+	// MaxConcurrentWrites caps how many other requests, e.g. PUTs, the
+	// server handles at once. Requests beyond it get 503 Service Unavailable.
+	// Zero is unlimited.
+	MaxConcurrentWrites int
+	// MaxExpiryHorizon is how far in the future a published key may expire
+	// (defaults to DefaultMaxExpiryHorizon, the spec's two years). Allowing
+	// more diverges from the spec; other servers will reject those keys.
+	MaxExpiryHorizon time.Duration
+	// Webhooks are URLs POSTed a WebhookPayload when a board is published,
+	// and when a federate accepts a board relayed to it.
+	Webhooks []string
+	// ReverifyInterval, if set, is how often a batch of stored boards has
+	// its signatures checked again. Boards that no longer verify, e.g. because
+	// they were corrupted in storage, are quarantined and no longer served.
+	ReverifyInterval time.Duration
+	// ReverifyBatchSize is how many boards are checked each ReverifyInterval
+	// (defaults to DefaultReverifyBatchSize).
+	ReverifyBatchSize int
+}
 
-func RunServer(port uint, federates []string, adminBoard string, fqdn string, propagateWait time.Duration, driver string, connectionString string) (err error) {
-	repo := initDB(driver, connectionString)
-	server := newSpring83Server(repo, federates, adminBoard, fqdn, propagateWait)
-	go server.periodicallyPurgeOldBoards()
-	http.HandleFunc("/", server.RootHandler)
-	listenAddress := fmt.Sprintf(":%d", port)
-	log.Printf("Listening on port %d", port)
-	err = http.ListenAndServe(listenAddress, nil)
+// DefaultAdminRefreshInterval is how often the admin board is re-signed when
+// the server has its private key.
+const DefaultAdminRefreshInterval = 24 * time.Hour
+
+// DefaultMaxHeaderBytes is the most bytes of request headers the server
+// reads when no limit is configured. Spring '83 requests only need a few
+// short headers.
+const DefaultMaxHeaderBytes = 16 << 10
+
+// DefaultMaxFederates is the most federates a server may relay boards to
+// when no limit is configured.
+const DefaultMaxFederates = 100
+
+// RunServer listens on config.Port and serves until the server fails.
+func RunServer(config ServerConfig) (err error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
 	if err != nil {
 		return err
 	}
-	return
+	return RunServerWithListener(listener, config)
+}
+
+// RunServerWithListener is RunServer on a listener that's already bound, so
+// the caller knows the server is accepting connections, and at which address
+// (e.g. when listening on port 0), before it starts. config.Port is ignored.
+// The listener is closed when the server stops.
+func RunServerWithListener(listener net.Listener, config ServerConfig) (err error) {
+	defer listener.Close()
+	if _, err = newReloadableSettings(config); err != nil {
+		return err
+	}
+	if _, err = VerifierFor(config.SignatureScheme); err != nil {
+		return err
+	}
+	if config.MaxExpiryHorizon < 0 {
+		return fmt.Errorf("MaxExpiryHorizon must be positive, not %s", config.MaxExpiryHorizon)
+	}
+	repo := initDB(config.SQLDriver, config.SQLConnectionString)
+	server := newSpring83Server(repo, config)
+	if config.BootstrapBoard != "" {
+		if err = server.bootstrapAdminBoard(config.BootstrapBoard, config.BootstrapSignature); err != nil {
+			return err
+		}
+	}
+	if config.AdminKeyPath != "" {
+		privkey, err := server.loadAdminKey(config.AdminKeyPath)
+		if err != nil {
+			return err
+		}
+		interval := config.AdminRefreshInterval
+		if interval == 0 {
+			interval = DefaultAdminRefreshInterval
+		}
+		go server.periodicallyRefreshAdminBoard(privkey, interval)
+	}
+	go server.periodicallyPurgeOldBoards()
+	if config.ReplayOnStartup {
+		go func() {
+			replayed, err := server.replayRecentBoards(time.Now(), replayInterval)
+			if err != nil {
+				log.Printf("Could not replay recent boards: %s", err)
+			}
+			log.Printf("Replayed %d recent boards to federates", replayed)
+		}()
+	}
+	if config.PullInterval > 0 {
+		go server.periodicallyPullFromFederates(config.PullInterval)
+	}
+	if config.ReverifyInterval > 0 {
+		go server.periodicallyReverifyBoards(config.ReverifyInterval)
+	}
+	maxHeaderBytes := config.MaxHeaderBytes
+	if maxHeaderBytes <= 0 {
+		maxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	httpServer := &http.Server{
+		Handler:        server.Handler(),
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+	log.Printf("Listening on %s", listener.Addr())
+	return httpServer.Serve(listener)
+}
+
+// validateFederates checks that there are at most max federates and that each
+// is an absolute http or https URL, since they're used to build the URLs
+// boards are relayed to.
+func validateFederates(setting string, federates []string, max int) error {
+	if len(federates) > max {
+		return fmt.Errorf("%s lists %d servers, more than the limit of %d", setting, len(federates), max)
+	}
+	for _, federate := range federates {
+		parsed, err := url.Parse(federate)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s entry %q must be an absolute http:// or https:// URL", setting, federate)
+		}
+		if parsed.RawQuery != "" || parsed.Fragment != "" {
+			return fmt.Errorf("%s entry %q must not have a query or fragment", setting, federate)
+		}
+	}
+	return nil
 }
 
+// ErrStaleBoard is returned by a BoardRepo when asked to replace a board with
+// one that isn't strictly newer.
+var ErrStaleBoard = errors.New("a board at least as new is already stored")
+
 type BoardRepo interface {
 	GetAllBoards() ([]Board, error)
+	// IterateBoards calls fn with each board, newest first, reading them one
+	// at a time rather than loading them all. It stops at the first error fn
+	// returns and returns it.
+	IterateBoards(fn func(Board) error) error
 	GetBoard(key string) (board *Board, err error)
+	// GetBoards returns the boards stored for any of keys, by key. Keys
+	// without a board are left out.
+	GetBoards(keys []string) (map[string]Board, error)
+	// GetBoardMeta returns a board's key, modified time, and signature
+	// without its body, or nil if the key has no board.
+	GetBoardMeta(key string) (meta *BoardMeta, err error)
+	IncrementViews(key string) error
+	GetViewCounts() (map[string]int, error)
+	// PublishBoard stores a board, replacing the key's board only if the new
+	// one's modified time is strictly newer, and only if it's newer than the
+	// key's tombstone. Otherwise it returns ErrStaleBoard.
 	PublishBoard(Board) error
-	DeleteBoardsBefore(string) error
+	DeleteBoard(key string) error
+	// DeleteBoardOlderThan deletes the key's board if it was modified before
+	// the given time, and returns ErrStaleBoard if it wasn't. Otherwise it
+	// records a tombstone at that time, so that the board isn't stored again
+	// when a federate relays it.
+	DeleteBoardOlderThan(key string, modified time.Time) error
+	// DeleteTombstonesBefore forgets the tombstones recorded before the
+	// given time.
+	DeleteTombstonesBefore(time.Time) error
+	// DeleteBoardsBefore deletes the boards modified before the given time
+	// and returns how many there were.
+	DeleteBoardsBefore(string) (int, error)
+	// DeleteAllBoards deletes every board and returns how many there were.
+	DeleteAllBoards() (int, error)
 	BoardCount() (int, error)
+	// LogPropagation records the outcome of relaying a board.
+	LogPropagation(entry PropagationLogEntry) error
+	// GetPropagationLog returns up to limit log entries, newest first.
+	GetPropagationLog(limit int) ([]PropagationLogEntry, error)
+	DeletePropagationLogBefore(time.Time) error
+	// GetBoardsToVerify returns up to limit signed boards that aren't
+	// quarantined, those verified longest ago (or never) first.
+	GetBoardsToVerify(limit int) ([]Board, error)
+	// RecordVerification records that a board's signature was checked at
+	// the given time, quarantining the board if it didn't verify. Boards
+	// quarantined are left out of every other read. A board replaced since
+	// it was read is left alone.
+	RecordVerification(board Board, at time.Time, valid bool) error
+	// GetVerificationCounts returns how many boards passed their last
+	// re-verification, and how many are quarantined.
+	GetVerificationCounts() (verified int, quarantined int, err error)
+	// GetFeaturedKeys returns the keys of the featured boards, in order.
+	GetFeaturedKeys() ([]string, error)
+	// SetFeaturedKeys replaces the featured boards with keys, in order.
+	SetFeaturedKeys(keys []string) error
+	// WithTx runs fn with a repo whose operations all happen in one
+	// transaction, committed if fn returns nil and rolled back otherwise.
+	WithTx(fn func(BoardRepo) error) error
+}
+
+// staleUnlessAffected returns ErrStaleBoard if a conditional write didn't
+// change any rows.
+func staleUnlessAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "Could not determine whether board was saved")
+	}
+	if affected == 0 {
+		return ErrStaleBoard
+	}
+	return nil
 }
 
 func initDB(driver, connectionString string) BoardRepo {
@@ -54,21 +371,136 @@ func initDB(driver, connectionString string) BoardRepo {
 	}
 }
 
+// DefaultBoardTTL is how long boards are kept when no TTL is configured.
+const DefaultBoardTTL = 22 * 24 * time.Hour
+
+// DefaultIndexPageSize is how many boards the index page shows at a time.
+const DefaultIndexPageSize = 50
+
+// PurgePolicy decides when the server deletes a stored board.
+type PurgePolicy string
+
+const (
+	// PurgeFixedTTL deletes boards once they're older than the board TTL.
+	PurgeFixedTTL PurgePolicy = "ttl"
+	// PurgeKeyExpiry keeps boards until their key expires.
+	PurgeKeyExpiry PurgePolicy = "key-expiry"
+	// PurgeEarliest deletes boards at the TTL or when their key expires,
+	// whichever comes first.
+	PurgeEarliest PurgePolicy = "min"
+)
+
+// IndexOrder decides how boards are ordered on the index page.
+type IndexOrder string
+
+const (
+	// IndexOrderModified shows the newest boards first.
+	IndexOrderModified IndexOrder = "modified"
+	// IndexOrderPinned shows the pinned boards first, in the configured
+	// order, and then the rest newest first.
+	IndexOrderPinned IndexOrder = "pinned"
+)
+
+// ParseIndexOrder validates an index order name. An empty name is
+// IndexOrderModified.
+func ParseIndexOrder(name string) (IndexOrder, error) {
+	switch order := IndexOrder(name); order {
+	case "":
+		return IndexOrderModified, nil
+	case IndexOrderModified, IndexOrderPinned:
+		return order, nil
+	default:
+		return "", fmt.Errorf("Unknown index order %q (expected %q or %q)", name, IndexOrderModified, IndexOrderPinned)
+	}
+}
+
+// ParsePurgePolicy validates a purge policy name. An empty name is
+// PurgeFixedTTL.
+func ParsePurgePolicy(name string) (PurgePolicy, error) {
+	switch policy := PurgePolicy(name); policy {
+	case "":
+		return PurgeFixedTTL, nil
+	case PurgeFixedTTL, PurgeKeyExpiry, PurgeEarliest:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Unknown purge policy %q (expected %q, %q, or %q)", name, PurgeFixedTTL, PurgeKeyExpiry, PurgeEarliest)
+	}
+}
+
 func (s *Spring83Server) periodicallyPurgeOldBoards() {
 	for true {
-		expiry := time.Now().Add(-22 * 24 * time.Hour).Format(time.RFC3339)
+		s.purgeOldBoards(time.Now())
+		time.Sleep(time.Minute)
+	}
+}
+
+// purgeOldBoards deletes the boards the purge policy says are too old. Purges
+// aren't relayed: nobody signed them, so federates couldn't tell them from a
+// forged deletion, and each server purges by its own policy anyway.
+func (s *Spring83Server) purgeOldBoards(now time.Time) {
+	if s.purgePolicy != PurgeKeyExpiry {
+		expiry := now.Add(-s.boardTTL).Format(time.RFC3339)
 		log.Printf("Deleting boards past their TTL (published before %s)", expiry)
-		err := s.repo.DeleteBoardsBefore(expiry)
+		deleted, err := s.repo.DeleteBoardsBefore(expiry)
 		if err != nil {
 			log.Print(err)
+		} else if deleted > 0 {
+			s.events.Publish(ServerEvent{Type: EventPurged, At: now.UTC(), Count: deleted})
 		}
-		time.Sleep(time.Minute)
 	}
+	if s.purgePolicy != PurgeFixedTTL {
+		log.Printf("Deleting boards whose keys have expired")
+		err := s.deleteBoardsWithExpiredKeys(now)
+		if err != nil {
+			log.Print(err)
+		}
+	}
+	s.purgePropagationLog(now)
+
+	// A key valid when its tombstone was recorded expires within
+	// maxExpiryHorizon of then (give or take the month it expires in), and
+	// its boards can't be published after that anyway.
+	if err := s.repo.DeleteTombstonesBefore(now.Add(-s.maxExpiryHorizon).AddDate(0, -1, 0)); err != nil {
+		log.Print(err)
+	}
+}
+
+func (s *Spring83Server) deleteBoardsWithExpiredKeys(now time.Time) error {
+	// Keys are collected first, rather than deleted while iterating, so that
+	// the deletes don't wait on the connection reading the boards.
+	expired := []string{}
+	err := s.repo.IterateBoards(func(board Board) error {
+		expiresAt, err := parseKeyExpiry(board.Key)
+		if err != nil || now.After(expiresAt) {
+			expired = append(expired, board.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not load boards to check key expiry")
+	}
+	for _, key := range expired {
+		log.Printf("  deleting %s", key)
+		if err = s.repo.DeleteBoard(key); err != nil {
+			return err
+		}
+		s.events.Publish(boardEvent(EventPurged, Board{Key: key}))
+	}
+	return nil
 }
 
 //go:embed assets/index.html
 var indexTemplate string
 
+//go:embed assets/board.html
+var boardPageTemplate string
+
+//go:embed assets/compose.html
+var composeHTML []byte
+
+//go:embed assets/compose.js
+var composeJS []byte
+
 func mustTemplate() *template.Template {
 
 	t, err := template.New("index").Parse(indexTemplate)
@@ -79,26 +511,262 @@ func mustTemplate() *template.Template {
 	return t
 }
 
+func mustBoardPageTemplate() *template.Template {
+	return template.Must(template.New("board").Parse(boardPageTemplate))
+}
+
 type Spring83Server struct {
-	repo               BoardRepo
-	homeTemplate       *template.Template
-	federates          []string
-	adminBoard         string
-	propagationTracker *propagationTracker
-	fqdn               string
-	propagateWait      time.Duration
+	repo                    BoardRepo
+	homeTemplate            *template.Template
+	boardPageTemplate       *template.Template
+	adminBoard              string
+	propagationTracker      *propagationTracker
+	fqdn                    string
+	propagateWait           time.Duration
+	allowFormPosts          bool
+	boardTTL                time.Duration
+	purgePolicy             PurgePolicy
+	countViews              bool
+	viewDebouncer           *viewDebouncer
+	staticDir               string
+	staticHandler           http.Handler
+	serveExpiredBoards      bool
+	enableComposer          bool
+	statusCache             statusCache
+	noDifficulty            bool
+	challenges              *challengeStore
+	boardTransformer        BoardTransformer
+	indexPageSize           int
+	wrapBoardPages          bool
+	lenientTimeTags         bool
+	logPropagation          bool
+	propagationLogRetention time.Duration
+	requestTimeout          time.Duration
+	pinnedBoards            []string
+	indexOrder              IndexOrder
+	rejectTagOnlyBoards     bool
+	logViaChain             bool
+	// purgeAllMutex guards lastPurgeAll, when every board was last purged
+	// through /admin/purge-all.
+	purgeAllMutex sync.Mutex
+	lastPurgeAll  time.Time
+	// verifier checks the signatures of published boards and tombstones.
+	verifier                Verifier
+	allowBoardConnections   bool
+	propagationBacklogDepth int
+	propagationBacklogAge   time.Duration
+	pathPrefix              string
+	minifyBoards            bool
+	// config is the configuration the server started with.
+	config ServerConfig
+	// reloadable holds the current *reloadableSettings, which POST
+	// /admin/reload replaces; read it with settings().
+	reloadable        atomic.Value
+	reloadMutex       sync.Mutex
+	maxExpiryHorizon  time.Duration
+	webhooks          *webhookNotifier
+	events            *eventBroker
+	reverifyBatchSize int
+	// difficultyRejections counts new keys rejected for exceeding the
+	// difficulty threshold. Accessed atomically.
+	difficultyRejections int64
+}
+
+func newSpring83Server(repo BoardRepo, config ServerConfig) *Spring83Server {
+	server := &Spring83Server{
+		repo:                    repo,
+		config:                  config,
+		homeTemplate:            mustTemplate(),
+		boardPageTemplate:       mustBoardPageTemplate(),
+		adminBoard:              config.AdminBoard,
+		propagationTracker:      newPropagationTracker(config.FQDN, config.PropagateWait, config.MaxConcurrentPropagations),
+		fqdn:                    config.FQDN,
+		webhooks:                newWebhookNotifier(),
+		events:                  newEventBroker(),
+		propagateWait:           config.PropagateWait,
+		allowFormPosts:          config.AllowFormPosts,
+		boardTTL:                config.BoardTTL,
+		purgePolicy:             config.PurgePolicy,
+		countViews:              config.CountViews,
+		viewDebouncer:           newViewDebouncer(),
+		challenges:              newChallengeStore(),
+		staticDir:               config.StaticDir,
+		serveExpiredBoards:      config.ServeExpiredBoards,
+		enableComposer:          config.EnableComposer,
+		noDifficulty:            config.NoDifficulty,
+		boardTransformer:        config.BoardTransformer,
+		indexPageSize:           config.IndexPageSize,
+		wrapBoardPages:          config.WrapBoardPages,
+		lenientTimeTags:         config.LenientTimeTags,
+		logPropagation:          config.LogPropagation,
+		propagationLogRetention: config.PropagationLogRetention,
+		requestTimeout:          config.RequestTimeout,
+		pinnedBoards:            config.PinnedBoards,
+		indexOrder:              config.IndexOrder,
+		rejectTagOnlyBoards:     config.RejectTagOnlyBoards,
+		logViaChain:             config.LogViaChain,
+		allowBoardConnections:   config.AllowBoardConnections,
+		propagationBacklogDepth: config.PropagationBacklogDepth,
+		propagationBacklogAge:   config.PropagationBacklogAge,
+		pathPrefix:              normalizePathPrefix(config.PathPrefix),
+		minifyBoards:            config.MinifyBoards,
+		maxExpiryHorizon:        config.MaxExpiryHorizon,
+		reverifyBatchSize:       config.ReverifyBatchSize,
+	}
+	if server.noDifficulty {
+		log.Print("WARNING: difficulty checks are disabled; this server is for testing and must not be used in production")
+	}
+	if server.indexPageSize <= 0 {
+		server.indexPageSize = DefaultIndexPageSize
+	}
+	if server.boardTransformer == nil {
+		server.boardTransformer = PassthroughTransformer{}
+	}
+	if server.minifyBoards {
+		server.boardTransformer = MinifyingTransformer{Next: server.boardTransformer}
+	}
+	if server.staticDir != "" {
+		server.staticHandler = http.StripPrefix("/static/", http.FileServer(http.Dir(server.staticDir)))
+	}
+	if server.boardTTL == 0 {
+		server.boardTTL = DefaultBoardTTL
+	}
+	if server.purgePolicy == "" {
+		server.purgePolicy = PurgeFixedTTL
+	}
+	if server.indexOrder == "" {
+		server.indexOrder = IndexOrderModified
+	}
+	if server.logPropagation {
+		server.propagationTracker.propagationLog = repo
+	}
+	server.propagationTracker.onPropagated = func(board Board, destination string) {
+		server.notifyWebhooks(WebhookPropagated, board, destination)
+		event := boardEvent(EventPropagated, board)
+		event.Destination = destination
+		server.events.Publish(event)
+	}
+	if server.requestTimeout <= 0 {
+		server.requestTimeout = DefaultRequestTimeout
+	}
+	if server.propagationBacklogDepth <= 0 {
+		server.propagationBacklogDepth = DefaultPropagationBacklogDepth
+	}
+	if server.propagationBacklogAge <= 0 {
+		server.propagationBacklogAge = DefaultPropagationBacklogAge
+	}
+	if server.propagationLogRetention == 0 {
+		server.propagationLogRetention = DefaultPropagationLogRetention
+	}
+	if server.maxExpiryHorizon == 0 {
+		server.maxExpiryHorizon = DefaultMaxExpiryHorizon
+	}
+	if server.reverifyBatchSize <= 0 {
+		server.reverifyBatchSize = DefaultReverifyBatchSize
+	}
+	verifier, err := VerifierFor(config.SignatureScheme)
+	if err != nil {
+		panic(err)
+	}
+	server.verifier = verifier
+	settings, err := newReloadableSettings(config)
+	if err != nil {
+		panic(err)
+	}
+	server.reloadable.Store(settings)
+	return server
+}
+
+// bootstrapAdminBoard publishes the board at path as the admin board, unless
+// the admin key already has a board. The board must pass the same checks as a
+// published board.
+func (s *Spring83Server) bootstrapAdminBoard(path string, signature string) error {
+	if s.adminBoard == "" {
+		return fmt.Errorf("A bootstrap board requires an admin board key")
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "Could not read bootstrap board %s", path)
+	}
+	hexSignature, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "Could not decode bootstrap board signature")
+	}
+	now := time.Now()
+	if err = s.validateIncomingKey(s.adminBoard, now); err != nil {
+		return errors.Wrap(err, "Bootstrap board is not valid")
+	}
+	modifiedTime, err := s.validateIncomingBody(s.adminBoard, body, now, nil)
+	if err != nil {
+		return errors.Wrap(err, "Bootstrap board is not valid")
+	}
+	if err = s.verifier.Verify(s.adminBoard, body, hexSignature); err != nil {
+		return errors.Wrap(err, "Bootstrap board is not valid")
+	}
+
+	curBoard, err := s.repo.GetBoard(s.adminBoard)
+	if err != nil {
+		return err
+	}
+	if curBoard != nil {
+		return nil
+	}
+	log.Printf("Publishing bootstrap board %s as the admin board", path)
+	err = s.repo.PublishBoard(Board{
+		Key:       s.adminBoard,
+		Board:     string(body),
+		Modified:  modifiedTime,
+		Signature: signature,
+	})
+	if errors.Is(err, ErrStaleBoard) {
+		return nil
+	}
+	return err
+}
+
+// loadAdminKey loads the private key for the admin board, refusing any key
+// pair that isn't the configured admin board's.
+func (s *Spring83Server) loadAdminKey(keyPath string) (ed25519.PrivateKey, error) {
+	pubkey, privkey, err := GetKeys(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if s.adminBoard == "" || hex.EncodeToString(pubkey) != s.adminBoard {
+		return nil, fmt.Errorf("The key pair at %s is not the admin board's key", keyPath)
+	}
+	return privkey, nil
+}
+
+func (s *Spring83Server) periodicallyRefreshAdminBoard(privkey ed25519.PrivateKey, interval time.Duration) {
+	for true {
+		time.Sleep(interval)
+		if err := s.refreshAdminBoard(privkey, time.Now()); err != nil {
+			log.Printf("Could not refresh the admin board: %s", err)
+		}
+	}
 }
 
-func newSpring83Server(repo BoardRepo, federates []string, adminBoard string, fqdn string, propagateWait time.Duration) *Spring83Server {
-	return &Spring83Server{
-		repo:               repo,
-		homeTemplate:       mustTemplate(),
-		federates:          federates,
-		adminBoard:         adminBoard,
-		propagationTracker: newPropagationTracker(fqdn, propagateWait),
-		fqdn:               fqdn,
-		propagateWait:      propagateWait,
+// refreshAdminBoard re-signs the admin board's content with a new <time> tag
+// and publishes and propagates it.
+func (s *Spring83Server) refreshAdminBoard(privkey ed25519.PrivateKey, now time.Time) error {
+	curBoard, err := s.repo.GetBoard(s.adminBoard)
+	if err != nil {
+		return err
+	}
+	if curBoard == nil {
+		log.Printf("No admin board to refresh")
+		return nil
+	}
+	board, err := PrepareBoard(stripTimeTag([]byte(curBoard.Board)), privkey, now)
+	if err != nil {
+		return err
+	}
+	if err = s.repo.PublishBoard(board); err != nil {
+		return err
 	}
+	log.Printf("Refreshed the admin board (now modified %s)", board.Modified.Format(time.RFC3339))
+	s.propagateBoard(board, nil)
+	return nil
 }
 
 func (s *Spring83Server) getBoard(key string) (*Board, error) {
@@ -110,37 +778,146 @@ func (s *Spring83Server) boardCount() (int, error) {
 }
 
 func (s *Spring83Server) getDifficulty() (float64, uint64, error) {
+	if s.noDifficulty {
+		return 0, math.MaxUint64, nil
+	}
 	count, err := s.boardCount()
 	if err != nil {
 		return 0, 0, err
 	}
 
 	difficultyFactor := math.Pow(float64(count)/10_000_000, 4)
-	keyThreshold := uint64(max_sig * (1.0 - difficultyFactor))
+	// Keys are compared with the threshold by their most significant 64
+	// bits, which is precise enough for a factor that is itself a float.
+	// float64(math.MaxUint64) rounds up to 2^64, so small factors have to
+	// be clamped rather than converted.
+	var keyThreshold uint64
+	threshold := float64(math.MaxUint64) * (1.0 - difficultyFactor)
+	switch {
+	case threshold >= float64(math.MaxUint64):
+		keyThreshold = math.MaxUint64
+	case threshold > 0:
+		keyThreshold = uint64(threshold)
+	}
 	return difficultyFactor, keyThreshold, nil
 }
 
+// boardSubmission is a board received from a client or a federate, before
+// it has been validated.
+type boardSubmission struct {
+	key               string
+	signature         []string
+	body              io.Reader
+	ifUnmodifiedSince []string
+	via               []string
+	// contentType is the submitted Content-Type, if any.
+	contentType string
+}
+
 func (s *Spring83Server) publishBoard(w http.ResponseWriter, r *http.Request) {
+	if !s.allowPublish(w, r, r.URL.Path[1:]) {
+		return
+	}
+	body, ok := decodedBody(w, r)
+	if !ok {
+		return
+	}
+	s.acceptBoard(w, boardSubmission{
+		key:               r.URL.Path[1:],
+		signature:         r.Header["Spring-Signature"],
+		body:              body,
+		ifUnmodifiedSince: r.Header["If-Unmodified-Since"],
+		via:               r.Header["Via"],
+		contentType:       r.Header.Get("Content-Type"),
+	})
+}
+
+// decodedBody returns the request body, decompressing it if the client sent
+// it with Content-Encoding: gzip. acceptBoard reads at most MaxBoardSize+1
+// bytes of it, which caps how much a malicious body can decompress to.
+func decodedBody(w http.ResponseWriter, r *http.Request) (body io.Reader, ok bool) {
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+		return r.Body, true
+	case "gzip":
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "Could not decompress gzip body", http.StatusBadRequest)
+			return nil, false
+		}
+		return gzipReader, true
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported Content-Encoding %s", encoding), http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+}
+
+// maxFormSize bounds the size of a multipart board submission, which carries
+// the key and signature alongside the board.
+const maxFormSize = 16 * 1024
+
+// publishBoardForm accepts a board as a multipart form with "key",
+// "signature", and "board" fields, for browser-based tools that can't set
+// custom headers on a PUT.
+func (s *Spring83Server) publishBoardForm(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+	if err := r.ParseMultipartForm(maxFormSize); err != nil {
+		http.Error(w, "Could not parse multipart form", http.StatusBadRequest)
+		return
+	}
+	if !s.allowPublish(w, r, r.FormValue("key")) {
+		return
+	}
+	submission := boardSubmission{
+		key:  r.FormValue("key"),
+		body: strings.NewReader(r.FormValue("board")),
+	}
+	if signature := r.FormValue("signature"); signature != "" {
+		submission.signature = []string{signature}
+	}
+	s.acceptBoard(w, submission)
+}
+
+// acceptBoard validates a submitted board and, if it passes, stores and
+// propagates it.
+func (s *Spring83Server) acceptBoard(w http.ResponseWriter, submission boardSubmission) {
 	w.Header().Set("Spring-Version", "83")
 	var err error
 
-	key, err := hex.DecodeString(r.URL.Path[1:])
+	key, err := hex.DecodeString(submission.key)
 	if err != nil || len(key) != 32 {
 		http.Error(w, "Invalid key", http.StatusBadRequest)
 		return
 	}
 	keyStr := fmt.Sprintf("%x", key)
 	log.Printf("Receiving board for %s", keyStr)
-	log.Printf("%+v", r.Header)
+
+	now := time.Now()
+	if err = s.validateIncomingKey(keyStr, now); err != nil {
+		http.Error(w, err.Error(), validationStatus(err))
+		return
+	}
+
+	// A malformed signature is rejected before anything touches the
+	// database. Verifying it still waits until the other checks pass.
+	hexSignature, strSignature, ok := decodeSignature(w, submission.signature)
+	if !ok {
+		return
+	}
 
 	var ifUnmodifiedSince time.Time
-	ifUnmodifiedSinceHeader := r.Header["If-Unmodified-Since"]
+	ifUnmodifiedSinceHeader := submission.ifUnmodifiedSince
 	if ifUnmodifiedSinceHeader != nil {
 		if ifUnmodifiedSince, err = time.Parse(time.RFC1123, ifUnmodifiedSinceHeader[0]); err != nil {
 			http.Error(w, "Invalid format for If-Unmodified-Since header", http.StatusBadRequest)
 			return
 		}
 	}
+	contentType, err := validateContentType(submission.contentType)
+	if err != nil {
+		http.Error(w, err.Error(), validationStatus(err))
+		return
+	}
 
 	// curBoard is nil if there is no existing board for this key, and a Board object otherwise
 	curBoard, err := s.getBoard(keyStr)
@@ -150,251 +927,956 @@ func (s *Spring83Server) publishBoard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if curBoard != nil && ifUnmodifiedSinceHeader != nil && !curBoard.Modified.Before(ifUnmodifiedSince) {
-		http.Error(w, "Old content", http.StatusConflict)
+	// A board modified exactly at If-Unmodified-Since may be a retry of the
+	// same PUT, which is checked once the signature has been decoded.
+	if curBoard != nil && ifUnmodifiedSinceHeader != nil && curBoard.Modified.After(ifUnmodifiedSince) {
+		rejectOldContent(w, curBoard)
 		return
 	}
 
-	// if the server doesn't have any board stored for <key>, then it must
-	// apply another check. The key, interpreted as a 256-bit number, must be
-	// less than a threshold defined by the server's difficulty factor:
 	if curBoard == nil {
-		difficultyFactor, keyThreshold, err := s.getDifficulty()
-		if err != nil {
+		difficultyFactor, err := s.checkDifficulty(keyStr)
+		if err != nil && !errors.Is(err, ErrDifficulty) {
 			log.Printf(err.Error())
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
-
 		w.Header().Add("Spring-Difficulty", fmt.Sprintf("%f", difficultyFactor))
-
-		// Using that difficulty factor, we can calculate the key threshold:
-		//
-		// MAX_KEY = (2**256 - 1)
-		// key_threshold = MAX_KEY * (1.0 - 0.52) = <an inscrutable gigantic number>
-		//
-		// The server must reject PUT requests for new keys that are not less
-		// than <an inscrutable gigantic number>
-		if binary.BigEndian.Uint64(key) >= keyThreshold {
-			if err != nil || len(key) != 32 {
-				http.Error(w, "Key greater than threshold", http.StatusForbidden)
-				return
-			}
-		}
-	}
-
-	var hexSignature []byte
-	var strSignature string
-	if signatureHeaders, ok := r.Header["Spring-Signature"]; !ok {
-		http.Error(w, "missing Spring-Signature header", http.StatusBadRequest)
-		return
-	} else {
-		strSignature = signatureHeaders[0]
-		if len(strSignature) < 1 {
-			http.Error(w, "Invalid Signature", http.StatusBadRequest)
-			return
-		}
-
-		if len(strSignature) != 128 {
-			http.Error(w, fmt.Sprintf("Expecting 64-bit signature %s %d", strSignature, len(strSignature)), http.StatusBadRequest)
-			return
-		}
-
-		hexSignature, err = hex.DecodeString(strSignature)
 		if err != nil {
-			http.Error(w, "Unable to decode signature", http.StatusBadRequest)
+			http.Error(w, err.Error(), validationStatus(err))
 			return
 		}
 	}
 
-	// Spring '83 specifies a test keypair
-	// Servers must not accept PUTs for this key, returning 401 Unauthorized.
-	// The server may also use a denylist to block certain keys, rejecting all PUTs for those keys.
-	denylist := []string{"fad415fbaa0339c4fd372d8287e50f67905321ccfd9c43fa4c20ac40afed1983"}
-	for _, key := range denylist {
-		if bytes.Compare(hexSignature, []byte(key)) == 0 {
-			http.Error(w, "Denied", http.StatusUnauthorized)
-		}
-	}
-
-	// Keys are of the form 83eMMYY
-	// when PUTting, a key must
-	// - be greater than today (more specifically the today must be before the first day of the next month following the expire, similar to credit cards)
-	// - be less than two years from now
-	// The server must reject other keys with 400 Bad Request.
-	last4 := string(keyStr[60:64])
-	today := time.Now()
-	expiry, err := time.Parse("0206", last4)
-	if keyStr[57:60] != "83e" || err != nil {
-		http.Error(w, "Signature must end with 83eMMYY. You might be using an old key format. Delete your old key, update your client, and try again.", http.StatusBadRequest)
-		return
-	}
-	if today.After(expiry.AddDate(0, 1, 0)) {
-		http.Error(w, "Key has expired", http.StatusBadRequest)
-		return
-	}
-	if expiry.After(today.AddDate(2, 0, 0)) {
-		http.Error(w, "Key is set to expire more than two years in the future", http.StatusBadRequest)
+	// Peers often relay boards we already have. Retrying a PUT that already
+	// succeeded isn't a conflict either, and there's nothing new to store or
+	// propagate, so don't bother reading or verifying the body.
+	if curBoard != nil && isResubmission(curBoard, strSignature) {
+		log.Printf("Board for %s is identical to the stored one", keyStr)
 		return
 	}
 
-	body, err := ioutil.ReadAll(r.Body)
+	body, err := ioutil.ReadAll(io.LimitReader(submission.body, MaxBoardSize+1))
 	if err != nil {
-		http.Error(w, "Could not read body", http.StatusInternalServerError)
-	}
-
-	if len(body) > 2217 {
-		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		http.Error(w, "Could not read body", http.StatusBadRequest)
 		return
 	}
-
-	dateTagRegExp := regexp.MustCompile(`(?i)<\s*time\s+datetime\s*=\s*"(\d\d\d\d-\d\d-\d\dT\d\d:\d\d:\d\dZ)"\s*\/?\s*>`)
-
-	submatches := dateTagRegExp.FindSubmatch(body)
-	if submatches == nil {
-		http.Error(w, `Missing <time datetime="YYYY-MM-DDTHH:MM:SSZ"> tag`, http.StatusBadRequest)
-		return
+	var fallbackModified *time.Time
+	if ifUnmodifiedSinceHeader != nil {
+		fallbackModified = &ifUnmodifiedSince
 	}
-	maybeDate := string(submatches[1][:])
-	modifiedTime, err := time.Parse("2006-01-02T15:04:05Z", maybeDate)
+	modifiedTime, err := s.validateIncomingBody(keyStr, body, now, fallbackModified)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Could not parse date %s", maybeDate), http.StatusBadRequest)
+		http.Error(w, err.Error(), validationStatus(err))
 		return
 	}
 	if curBoard != nil && !curBoard.Modified.Before(modifiedTime) {
-		http.Error(w, "Old content", http.StatusConflict)
+		rejectOldContent(w, curBoard)
 		return
 	}
 
 	// at this point, we should have met all the preconditions prior to the
 	// cryptographic check. By the spec, we should perform all
 	// non-cryptographic checks first.
-	if !ed25519.Verify(key, body, hexSignature) {
-		http.Error(w, "Invalid signature", http.StatusBadRequest)
+	if err = s.verifier.Verify(keyStr, body, hexSignature); err != nil {
+		http.Error(w, err.Error(), validationStatus(err))
 		return
 	}
 
 	newBoard := Board{
-		Key:       keyStr,
-		Board:     string(body[:]),
-		Modified:  modifiedTime,
-		Signature: strSignature,
+		Key:         keyStr,
+		Board:       string(body[:]),
+		Modified:    modifiedTime,
+		Signature:   strSignature,
+		ContentType: contentType,
 	}
-	err = s.repo.PublishBoard(newBoard)
-	if err != nil {
+	// Anything else stored alongside a published board belongs in this
+	// transaction, so a failure leaves the previous board untouched.
+	err = s.repo.WithTx(func(repo BoardRepo) error {
+		return repo.PublishBoard(newBoard)
+	})
+	if errors.Is(err, ErrStaleBoard) {
+		s.rejectStaleWrite(w, keyStr)
+		return
+	} else if err != nil {
 		log.Printf("%s", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
 	}
 
-	// Via headers are in the form "Via: Spring/83 servername.tld"
-	var viaDomain string
-	viaHeader := r.Header["Via"]
-	if len(viaHeader) > 0 {
-		tokens := strings.Split(viaHeader[0], " ")
-		if len(tokens) == 2 {
-			viaDomain = tokens[1]
-		} else {
-			log.Printf("Malformed Via header: %s", viaHeader)
-		}
-	}
-
-	s.propagateBoard(newBoard, viaDomain)
+	s.notifyWebhooks(WebhookPublished, newBoard, "")
+	s.events.Publish(boardEvent(EventPublished, newBoard))
+	s.propagateBoard(newBoard, parseViaChain(submission.via))
 }
 
-func (server *Spring83Server) propagateBoard(board Board, viaDomain string) {
-	rand.Seed(time.Now().UnixNano())
-	for _, federate := range server.federates {
-		normalizedFederate := strings.TrimPrefix(federate, "https://")
-		normalizedFederate = strings.TrimPrefix(normalizedFederate, "http://")
-		if normalizedFederate == viaDomain {
-			continue
-		}
-		server.propagationTracker.Schedule(board, federate)
+// validateIncomingKey checks a board's key before anything else about it,
+// whether the board was PUT or pulled from a federate. Anyone can sign boards
+// with the spec's test keypair, so they're always refused with 401. Other
+// keys are of the form 83eMMYY and must be within their validity window: not
+// yet expired (a key is valid until the first day of the month after MMYY,
+// like a credit card), nor expiring more than s.maxExpiryHorizon from now.
+func (s *Spring83Server) validateIncomingKey(key string, now time.Time) error {
+	if key == TestPublicKey {
+		return invalid(ErrKeyDenied, "The test key can't publish boards")
 	}
+	return validateKeyWithin(key, now, s.maxExpiryHorizon)
 }
 
-func (s *Spring83Server) loadBoards() ([]Board, error) {
-	return s.repo.GetAllBoards()
-}
-
-func (s *Spring83Server) showAllBoards(w http.ResponseWriter, r *http.Request) {
-	boards, err := s.loadBoards()
+// checkDifficulty applies the check a key must pass if the server has no
+// board stored for it yet: interpreted as a 256-bit number, it must be less
+// than a threshold defined by the server's difficulty factor,
+//
+//	MAX_KEY = (2**256 - 1)
+//	key_threshold = MAX_KEY * (1.0 - difficulty_factor)
+//
+// It returns an ErrDifficulty error if the key isn't, and any other error if
+// the difficulty couldn't be computed.
+func (s *Spring83Server) checkDifficulty(key string) (difficultyFactor float64, err error) {
+	decodedKey, err := hex.DecodeString(key)
+	if err != nil || len(decodedKey) != 32 {
+		return 0, invalid(ErrInvalidKey, "Invalid key")
+	}
+	difficultyFactor, keyThreshold, err := s.getDifficulty()
 	if err != nil {
-		log.Printf(err.Error())
-		http.Error(w, "Unable to load boards", http.StatusInternalServerError)
 		return
 	}
+	if binary.BigEndian.Uint64(decodedKey) >= keyThreshold {
+		atomic.AddInt64(&s.difficultyRejections, 1)
+		log.Printf("Rejected new key %s: greater than the difficulty threshold (factor %f)", key, difficultyFactor)
+		return difficultyFactor, invalid(ErrDifficulty, "Key greater than threshold")
+	}
+	return
+}
 
-	difficultyFactor, _, err := s.getDifficulty()
+// validateIncomingBody checks a board's body, whether the board was PUT or
+// pulled from a federate, and returns its modified time. The body can't be
+// empty, needs a valid <time> tag, can't be nothing but that tag if the
+// server rejects those, and can't match a content deny pattern. With lenient
+// time tags, a body without a <time> tag is dated fallbackModified instead,
+// if it's given.
+func (s *Spring83Server) validateIncomingBody(key string, body []byte, now time.Time, fallbackModified *time.Time) (modified time.Time, err error) {
+	if len(body) == 0 {
+		return modified, invalid(ErrBadRequest, "Empty board")
+	}
+	modified, err = validateBoardBody(body, now)
+	if err != nil && s.lenientTimeTags && fallbackModified != nil && errors.Is(err, ErrInvalidTimeTag) && !timeTagRegExp.Match(body) {
+		log.Printf("DEPRECATED: board for %s has no <time> tag; using its If-Unmodified-Since header instead", key)
+		modified, err = fallbackModified.UTC().Truncate(time.Second), nil
+		if modified.After(now) {
+			err = invalid(ErrInvalidTimeTag, "If-Unmodified-Since header is in the future")
+		}
+	}
 	if err != nil {
-		log.Printf(err.Error())
-		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	if s.rejectTagOnlyBoards && isTagOnly(body) {
+		return modified, invalid(ErrBadRequest, "Board has no content besides its time tag; unpublish it to delete it")
+	}
+	if pattern := s.deniedContent(body); pattern != nil {
+		log.Printf("Rejected board for %s: it matches the content deny pattern %q", key, pattern)
+		return modified, invalid(ErrForbidden, "Board contains content this server doesn't accept")
+	}
+	return
+}
 
-	w.Header().Add("Spring-Difficulty", fmt.Sprintf("%f", difficultyFactor))
+// isResubmission reports whether signature is the stored board's. A
+// signature that verified against the stored body can't be valid for any
+// other body under the same key, so the submission is either the stored
+// board again or a forgery that would fail verification, and either way
+// there's nothing to store.
+func isResubmission(curBoard *Board, signature string) bool {
+	return curBoard.Signature != "" && strings.EqualFold(curBoard.Signature, signature)
+}
 
-	data := struct {
-		AdminBoard Board
-		Boards     []Board
-	}{}
+// rejectOldContent responds 409 Conflict, telling the client the modified
+// time and signature of the board it needs to beat.
+func rejectOldContent(w http.ResponseWriter, curBoard *Board) {
+	w.Header().Set("Last-Modified", curBoard.Modified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Spring-Signature", curBoard.Signature)
+	http.Error(w, "Old content", http.StatusConflict)
+}
 
-	for _, board := range boards {
-		if board.Key == s.adminBoard {
-			data.AdminBoard = board
-		} else {
-			data.Boards = append(data.Boards, board)
-		}
+// rejectStaleWrite responds 409 Conflict when a newer board for key was
+// stored while the request was being validated.
+func (s *Spring83Server) rejectStaleWrite(w http.ResponseWriter, key string) {
+	curBoard, err := s.repo.GetBoard(key)
+	if err == nil && curBoard != nil {
+		rejectOldContent(w, curBoard)
+		return
 	}
-
-	s.homeTemplate.Execute(w, data)
+	http.Error(w, "Old content", http.StatusConflict)
 }
 
-func (s *Spring83Server) showBoard(w http.ResponseWriter, r *http.Request) {
-	board, err := s.getBoard(r.URL.Path[1:])
-	if err != nil {
-		log.Printf(err.Error())
-		http.Error(w, "Unable to load boards", http.StatusInternalServerError)
+// decodeSignature decodes the hex signature from a Spring-Signature header,
+// responding with 400 Bad Request if it's missing or malformed.
+func decodeSignature(w http.ResponseWriter, signatureHeaders []string) (hexSignature []byte, strSignature string, ok bool) {
+	if len(signatureHeaders) == 0 {
+		http.Error(w, "missing Spring-Signature header", http.StatusBadRequest)
 		return
 	}
-	if board == nil {
-		http.Error(
-			w,
-			fmt.Sprintf("Could not find board %s", r.URL.Path[1:]),
-			http.StatusNotFound)
+	strSignature = signatureHeaders[0]
+	if len(strSignature) < 1 {
+		http.Error(w, "Invalid Signature", http.StatusBadRequest)
 		return
 	}
 
-	difficultyFactor, _, err := s.getDifficulty()
-	if err != nil {
+	if len(strSignature) != 128 {
+		http.Error(w, fmt.Sprintf("Expecting 64-bit signature %s %d", strSignature, len(strSignature)), http.StatusBadRequest)
+		return
+	}
+
+	hexSignature, err := hex.DecodeString(strSignature)
+	if err != nil {
+		http.Error(w, "Unable to decode signature", http.StatusBadRequest)
+		return
+	}
+	ok = true
+	return
+}
+
+// parseViaChain returns the servers a board passed through, oldest first.
+// Via headers are in the form "Via: Spring/83 servername.tld", with each
+// server that relays a board appending itself, comma separated (a chain may
+// also be split across several Via headers).
+func parseViaChain(viaHeader []string) (chain []string) {
+	for _, header := range viaHeader {
+		for _, entry := range strings.FieldsFunc(header, func(r rune) bool { return r == ',' || r == '\n' }) {
+			tokens := strings.Fields(entry)
+			if len(tokens) < 2 {
+				log.Printf("Malformed Via entry: %q", entry)
+				continue
+			}
+			chain = append(chain, tokens[1])
+		}
+	}
+	return
+}
+
+// formatViaChain is the Via header for a board that passed through chain.
+func formatViaChain(chain []string) string {
+	entries := make([]string, len(chain))
+	for i, server := range chain {
+		entries[i] = "Spring/83 " + server
+	}
+	return strings.Join(entries, ", ")
+}
+
+// relayTargets returns the federates to relay a board to, leaving out any
+// server it already passed through. A board whose chain includes this server
+// has looped back, and isn't relayed at all.
+func (s *Spring83Server) relayTargets(key string, via []string) (targets []string) {
+	if s.logViaChain && len(via) > 0 {
+		log.Printf("Board for %s arrived via %s", key, strings.Join(via, " -> "))
+	}
+	seen := map[string]bool{}
+	for _, server := range via {
+		seen[normalizeFederate(server)] = true
+	}
+	if s.fqdn != "" && seen[normalizeFederate(s.fqdn)] {
+		log.Printf("Board for %s already passed through this server, not relaying it", key)
+		return nil
+	}
+	for _, federate := range s.settings().propagateTo {
+		if !seen[normalizeFederate(federate)] {
+			targets = append(targets, federate)
+		}
+	}
+	return
+}
+
+// deleteBoard removes a key's board when sent a signed tombstone (a body with
+// nothing but a <time> tag newer than the stored board), and relays the
+// tombstone to federates.
+func (s *Spring83Server) deleteBoard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Spring-Version", "83")
+	if !s.allowPublish(w, r, r.URL.Path[1:]) {
+		return
+	}
+
+	key, err := hex.DecodeString(r.URL.Path[1:])
+	if err != nil || len(key) != 32 {
+		http.Error(w, "Invalid key", http.StatusBadRequest)
+		return
+	}
+	keyStr := fmt.Sprintf("%x", key)
+	if r.Header.Get("Spring-Auth") != "" {
+		s.deleteBoardWithAuth(w, r, keyStr)
+		return
+	}
+	log.Printf("Receiving tombstone for %s", keyStr)
+
+	hexSignature, strSignature, ok := decodeSignature(w, r.Header["Spring-Signature"])
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if err = validateKeyWithin(keyStr, now, s.maxExpiryHorizon); err != nil {
+		http.Error(w, err.Error(), validationStatus(err))
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBoardSize+1))
+	if err != nil {
+		http.Error(w, "Could not read body", http.StatusInternalServerError)
+		return
+	}
+	modifiedTime, err := validateTombstone(body, now)
+	if err != nil {
+		http.Error(w, err.Error(), validationStatus(err))
+		return
+	}
+
+	curBoard, err := s.getBoard(keyStr)
+	if err != nil {
+		log.Printf(err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if curBoard != nil && !curBoard.Modified.Before(modifiedTime) {
+		rejectOldContent(w, curBoard)
+		return
+	}
+
+	if err = s.verifier.Verify(keyStr, body, hexSignature); err != nil {
+		http.Error(w, err.Error(), validationStatus(err))
+		return
+	}
+
+	tombstone := Board{
+		Key:       keyStr,
+		Board:     string(body),
+		Modified:  modifiedTime,
+		Signature: strSignature,
+	}
+	// The tombstone is recorded even without a board to delete, so a relay
+	// of an older board that hasn't reached us yet isn't stored.
+	err = s.repo.DeleteBoardOlderThan(keyStr, modifiedTime)
+	if errors.Is(err, ErrStaleBoard) {
+		s.rejectStaleWrite(w, keyStr)
+		return
+	} else if err != nil {
+		log.Printf("%s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if curBoard != nil {
+		log.Printf("Deleted board for %s", keyStr)
+		s.events.Publish(boardEvent(EventDeleted, tombstone))
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	via := parseViaChain(r.Header["Via"])
+	for _, federate := range s.relayTargets(keyStr, via) {
+		s.propagationTracker.ScheduleDeletion(tombstone, federate, via)
+	}
+}
+
+// deleteBoardWithAuth deletes a key's board when the request proves ownership
+// of the key with a Spring-Auth header instead of a tombstone. The time the
+// nonce was issued stands in for a tombstone's: boards modified before then
+// are deleted, and refused if they're relayed to us later. The header is
+// relayed to federates, which check it with verifyRelayedOwner.
+func (s *Spring83Server) deleteBoardWithAuth(w http.ResponseWriter, r *http.Request, key string) {
+	via := parseViaChain(r.Header["Via"])
+	authorized := s.verifyOwner(r, key)
+	if !authorized && len(via) > 0 {
+		authorized = s.verifyRelayedOwner(r, key, time.Now())
+	}
+	if !authorized {
+		http.Error(w, "Invalid or expired Spring-Auth challenge", http.StatusForbidden)
+		return
+	}
+	springAuth := r.Header.Get("Spring-Auth")
+	deletedAt, err := nonceIssuedAt(strings.Fields(springAuth)[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	err = s.repo.DeleteBoardOlderThan(key, deletedAt)
+	if errors.Is(err, ErrStaleBoard) {
+		s.rejectStaleWrite(w, key)
+		return
+	} else if err != nil {
+		log.Printf("%s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Deleted board for %s (authenticated by challenge)", key)
+	s.events.Publish(boardEvent(EventDeleted, Board{Key: key}))
+	w.WriteHeader(http.StatusNoContent)
+
+	for _, federate := range s.relayTargets(key, via) {
+		s.propagationTracker.ScheduleAuthDeletion(key, springAuth, federate, via)
+	}
+}
+
+func (server *Spring83Server) propagateBoard(board Board, via []string) {
+	rand.Seed(time.Now().UnixNano())
+	for _, federate := range server.relayTargets(board.Key, via) {
+		server.propagationTracker.Schedule(board, federate, via)
+	}
+}
+
+func normalizeFederate(federate string) string {
+	normalizedFederate := strings.TrimPrefix(federate, "https://")
+	return strings.TrimPrefix(normalizedFederate, "http://")
+}
+
+// loadBoards returns the boards to list in the index, leaving out any whose
+// keys have expired but haven't been purged yet.
+func (s *Spring83Server) loadBoards() ([]Board, error) {
+	boards, err := s.repo.GetAllBoards()
+	if err != nil {
+		return nil, err
+	}
+	return activeBoards(boards, time.Now()), nil
+}
+
+// errPageFull stops IterateBoards once a page of the index has been read.
+var errPageFull = errors.New("page full")
+
+// loadBoardsPage loads a page (starting at 1) of the index's boards, not
+// including the admin board, and reports whether there are more pages. The
+// featured boards, and then the pinned ones when the index is ordered with
+// pinned boards first, lead the first page. Boards the index leaves out are
+// skipped before counting the boards on earlier pages, so that every page
+// but the last is full. A page past the last is the last.
+func (s *Spring83Server) loadBoardsPage(page int) (boards []Board, more bool, err error) {
+	count, err := s.repo.BoardCount()
+	if err != nil {
+		return
+	}
+	if lastPage := count/s.indexPageSize + 1; page > lastPage {
+		page = lastPage
+	}
+	leading, err := s.leadingKeys()
+	if err != nil {
+		return
+	}
+	isLeading := map[string]bool{}
+	for _, key := range leading {
+		isLeading[key] = true
+	}
+
+	now := time.Now()
+	skip := (page - 1) * s.indexPageSize
+	boards = []Board{}
+	err = s.repo.IterateBoards(func(board Board) error {
+		if board.Key == s.adminBoard || isLeading[board.Key] || keyExpired(board.Key, now) {
+			return nil
+		}
+		if skip > 0 {
+			skip--
+			return nil
+		}
+		if len(boards) == s.indexPageSize {
+			more = true
+			return errPageFull
+		}
+		boards = append(boards, board)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPageFull) {
+		return nil, false, err
+	}
+	if page == 1 && len(leading) > 0 {
+		leadingBoards, err := s.loadBoardsInOrder(leading)
+		if err != nil {
+			return nil, false, err
+		}
+		boards = append(leadingBoards, boards...)
+	}
+	return boards, more, nil
+}
+
+// leadingKeys returns the keys of the boards shown before the rest of the
+// index: the featured boards, then the pinned boards unless the index is
+// ordered by modified time. The admin board is left out.
+func (s *Spring83Server) leadingKeys() ([]string, error) {
+	featured, err := s.repo.GetFeaturedKeys()
+	if err != nil {
+		return nil, err
+	}
+	keys := featured
+	if s.indexOrder == IndexOrderPinned {
+		keys = append(keys, s.pinnedBoards...)
+	}
+	leading := []string{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if key != s.adminBoard && !seen[key] {
+			seen[key] = true
+			leading = append(leading, key)
+		}
+	}
+	return leading, nil
+}
+
+// loadBoardsInOrder loads the boards for keys in the same order, skipping any
+// that aren't stored or whose keys have expired.
+func (s *Spring83Server) loadBoardsInOrder(keys []string) ([]Board, error) {
+	boards, err := s.repo.GetBoards(keys)
+	if err != nil {
+		return nil, err
+	}
+	ordered := []Board{}
+	for _, key := range keys {
+		if board, found := boards[key]; found {
+			ordered = append(ordered, board)
+		}
+	}
+	return activeBoards(ordered, time.Now()), nil
+}
+
+// activeBoards filters out boards whose keys have expired.
+func activeBoards(boards []Board, now time.Time) []Board {
+	active := boards[:0]
+	for _, board := range boards {
+		if !keyExpired(board.Key, now) {
+			active = append(active, board)
+		}
+	}
+	return active
+}
+
+// viewCounts returns each board's view count, or nil if views aren't counted.
+func (s *Spring83Server) viewCounts() (map[string]int, error) {
+	if !s.countViews {
+		return nil, nil
+	}
+	return s.repo.GetViewCounts()
+}
+
+// countView records a view of a board, unless it's a HEAD request, a request
+// from a federate, or a repeat view from the same address.
+func (s *Spring83Server) countView(r *http.Request, key string) {
+	if !s.countViews || r.Method != http.MethodGet || len(r.Header["Via"]) > 0 {
+		return
+	}
+	if !s.viewDebouncer.ShouldCount(r, key, time.Now()) {
+		return
+	}
+	if err := s.repo.IncrementViews(key); err != nil {
+		log.Print(err)
+	}
+}
+
+func (s *Spring83Server) showAllBoards(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	if requested, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && requested > 1 {
+		page = requested
+	}
+	boards, more, err := s.loadBoardsPage(page)
+	if err != nil {
+		log.Printf(err.Error())
+		http.Error(w, "Unable to load boards", http.StatusInternalServerError)
+		return
+	}
+	adminBoard, err := s.getBoard(s.adminBoard)
+	if err != nil {
+		log.Printf(err.Error())
+		http.Error(w, "Unable to load boards", http.StatusInternalServerError)
+		return
+	}
+
+	views, err := s.viewCounts()
+	if err != nil {
+		log.Printf(err.Error())
+		http.Error(w, "Unable to load boards", http.StatusInternalServerError)
+		return
+	}
+
+	difficultyFactor, _, err := s.getDifficulty()
+	if err != nil {
 		log.Printf(err.Error())
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Add("Spring-Difficulty", fmt.Sprintf("%f", difficultyFactor))
+
+	data := struct {
+		PathPrefix    string
+		Notice        string
+		CustomFavicon bool
+		AdminBoard    Board
+		Boards        []Board
+		CountViews    bool
+		Views         map[string]int
+		NextPage      int
+	}{
+		PathPrefix:    s.pathPrefix,
+		Notice:        s.settings().notice,
+		CustomFavicon: s.hasStaticFile("favicon.svg"),
+		Boards:        boards,
+		CountViews:    s.countViews,
+		Views:         views,
+	}
+	if adminBoard != nil && !keyExpired(adminBoard.Key, time.Now()) {
+		data.AdminBoard = *adminBoard
+	}
+	if more {
+		data.NextPage = page + 1
+	}
+
+	s.homeTemplate.Execute(w, data)
+}
+
+func (s *Spring83Server) showBoard(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Path[1:]
+	// Only the board's metadata is loaded until it's clear the response
+	// needs its body: HEAD requests and unchanged conditional GETs don't.
+	meta, err := s.repo.GetBoardMeta(key)
+	if err != nil {
+		log.Printf(err.Error())
+		http.Error(w, "Unable to load boards", http.StatusInternalServerError)
+		return
+	}
+	if meta == nil {
+		http.Error(
+			w,
+			fmt.Sprintf("Could not find board %s", key),
+			http.StatusNotFound)
+		return
+	}
+
+	// A key is valid until the first day of the month after its 83eMMYY
+	// expiry, the same rule used when publishing. Past that, the board is
+	// permanently unavailable even if it hasn't been purged yet.
+	if !s.serveExpiredBoards && keyExpired(meta.Key, time.Now()) {
+		http.Error(w, "Board's key has expired", http.StatusGone)
+		return
+	}
+
+	// Both wrapping boards in a page and transforming them depend on who's
+	// asking.
+	w.Header().Add("Vary", "Accept, Sec-Fetch-Dest")
+	page := false
+	if s.wrapBoardPages {
+		page = isDocumentNavigation(r)
+	}
+	raw := wantsRawBoard(r)
+
+	if !page {
+		s.countView(r, meta.Key)
+		if !raw {
+			if err = s.setBoardHeaders(w, meta); err != nil {
+				log.Printf(err.Error())
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			w.Header().Add("Content-Type", contentTypeOrDefault(meta.ContentType))
+			w.Header().Add("Spring-Signature", meta.Signature)
+		}
+		if !raw && notModifiedSince(r, meta.Modified) {
+			// What http.ServeContent would answer, without the body.
+			w.Header().Del("Content-Type")
+			w.Header().Set("Last-Modified", meta.Modified.UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.Method == http.MethodHead {
+			if !raw {
+				w.Header().Set("Last-Modified", meta.Modified.UTC().Format(http.TimeFormat))
+				w.Header().Set("Accept-Ranges", "bytes")
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	board, err := s.getBoard(key)
+	if err != nil {
+		log.Printf(err.Error())
+		http.Error(w, "Unable to load boards", http.StatusInternalServerError)
+		return
+	}
+	if board == nil {
+		// Deleted since its metadata was loaded.
+		http.Error(
+			w,
+			fmt.Sprintf("Could not find board %s", key),
+			http.StatusNotFound)
+		return
+	}
+
+	if page {
+		s.showBoardPage(w, board)
+		return
+	}
+
+	if raw {
+		w.Write([]byte(board.Board))
+		return
+	}
+
+	// Programs check the bytes they get against Spring-Signature, so boards
+	// are only transformed for browsers displaying them.
+	body := board.Board
+	if isBrowserDisplay(r) {
+		if body, err = s.boardTransformer.Transform(*board); err != nil {
+			log.Printf("Could not transform board %s: %s", board.Key, err)
+			http.Error(w, "Unable to display board", http.StatusInternalServerError)
+			return
+		}
+		if body != board.Board {
+			w.Header().Del("Spring-Signature")
+		}
+	}
+
+	// ServeContent answers Range requests (with 206 Partial Content or 416
+	// Range Not Satisfiable) and advertises Accept-Ranges, for caches and
+	// clients that probe with them.
+	http.ServeContent(w, r, "", board.Modified, strings.NewReader(body))
+}
+
+// setBoardHeaders sets the headers served with a board (other than a raw
+// one), which only depend on its metadata.
+func (s *Spring83Server) setBoardHeaders(w http.ResponseWriter, meta *BoardMeta) error {
+	difficultyFactor, _, err := s.getDifficulty()
+	if err != nil {
+		return err
+	}
+	w.Header().Add("Spring-Difficulty", fmt.Sprintf("%f", difficultyFactor))
+	w.Header().Add("Content-Type", contentTypeOrDefault(meta.ContentType))
+	w.Header().Add("Spring-Signature", meta.Signature)
+
+	w.Header().Add("Content-Security-Policy", s.boardCSP())
+	return nil
+}
+
+// boardCSP is the Content-Security-Policy served with boards. Unless the
+// operator allows it, boards can't make requests anywhere.
+func (s *Spring83Server) boardCSP() string {
+	connectSrc := "'none'"
+	if s.allowBoardConnections {
+		connectSrc = "*"
+	}
+	return fmt.Sprintf("default-src 'none'; style-src 'self' 'unsafe-inline'; font-src 'self'; script-src 'self'; form-action *; connect-src %s;", connectSrc)
+}
+
+// notModifiedSince reports whether a GET or HEAD request's If-Modified-Since
+// header shows the client already has the board modified at modified. Like
+// http.ServeContent, it's ignored when the request has If-None-Match.
+func notModifiedSince(r *http.Request, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// isDocumentNavigation reports whether a board was requested by a browser
+// opening it in a tab, rather than by an iframe or a program. Browsers that
+// don't send Sec-Fetch-Dest are recognized by preferring text/html. Boards
+// requested with ?embed=1 (as the board page's iframe does) never are.
+func isDocumentNavigation(r *http.Request) bool {
+	if r.URL.Query().Get("embed") == "1" || wantsRawBoard(r) {
+		return false
+	}
+	if dest := r.Header.Get("Sec-Fetch-Dest"); dest != "" {
+		return dest == "document"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// showBoardPage shows a board in a sandboxed iframe below its key, modified
+// time, key expiry, and a link back to the index.
+func (s *Spring83Server) showBoardPage(w http.ResponseWriter, board *Board) {
+	expires := ""
+	if expiresAt, err := parseKeyExpiry(board.Key); err == nil {
+		expires = expiresAt.Format("2006-01-02")
+	}
+	data := struct {
+		PathPrefix string
+		Key        string
+		Preview    string
+		Modified   string
+		Expires    string
+	}{
+		PathPrefix: s.pathPrefix,
+		Key:        board.Key,
+		Preview:    board.Preview(),
+		Modified:   board.Modified.UTC().Format(time.RFC3339),
+		Expires:    expires,
+	}
 	w.Header().Add("Content-Type", "text/html;charset=utf-8")
-	w.Header().Add("Spring-Signature", board.Signature)
+	w.Header().Add("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src data:; frame-src 'self';")
+	if err := s.boardPageTemplate.Execute(w, data); err != nil {
+		log.Printf("Could not render board page for %s: %s", board.Key, err)
+	}
+}
 
-	w.Header().Add("Content-Security-Policy", "default-src 'none'; style-src 'self' 'unsafe-inline'; font-src 'self'; script-src 'self'; form-action *; connect-src *;")
+// isBrowserDisplay reports whether a board was requested by a browser to
+// display it, in a tab or an iframe, rather than by a program.
+func isBrowserDisplay(r *http.Request) bool {
+	if wantsRawBoard(r) {
+		return false
+	}
+	if r.URL.Query().Get("embed") == "1" {
+		return true
+	}
+	if dest := r.Header.Get("Sec-Fetch-Dest"); dest != "" {
+		return dest == "document" || dest == "iframe" || dest == "frame"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
 
-	w.Write([]byte(board.Board))
+// wantsRawBoard reports whether the client asked for the stored board bytes
+// without the browser-oriented headers, either with
+// "Accept: application/spring-83" or a "?raw=1" query parameter.
+func wantsRawBoard(r *http.Request) bool {
+	if r.URL.Query().Get("raw") == "1" {
+		return true
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType = strings.TrimSpace(strings.Split(mediaType, ";")[0])
+			if strings.EqualFold(mediaType, "application/spring-83") {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func (s *Spring83Server) showIndexJson(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "application/json")
+// MaxBoardsPerRequest is the most keys GET /boards accepts at once.
+const MaxBoardsPerRequest = 100
+
+// showBoards returns the boards for the comma separated keys in ?keys=, with
+// their signatures, so clients showing several boards can fetch them in one
+// request. Keys with no board (or whose key has expired) are listed as
+// missing.
+func (s *Spring83Server) showBoards(w http.ResponseWriter, r *http.Request) {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, key := range strings.Split(r.URL.Query().Get("keys"), ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || seen[key] {
+			continue
+		}
+		if !isKeyPath(key) {
+			http.Error(w, fmt.Sprintf("Invalid key %q", key), http.StatusBadRequest)
+			return
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		http.Error(w, "Pass the keys to fetch as ?keys=KEY1,KEY2", http.StatusBadRequest)
+		return
+	}
+	if len(keys) > MaxBoardsPerRequest {
+		http.Error(w, fmt.Sprintf("At most %d keys can be fetched at once", MaxBoardsPerRequest), http.StatusBadRequest)
+		return
+	}
+
+	boards, err := s.repo.GetBoards(keys)
+	if err != nil {
+		log.Printf("Error in showBoards: %s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
 	type boardJson struct {
-		Key    string    `json:"key"`
-		Posted time.Time `json:"posted"`
+		Key       string    `json:"key"`
+		Board     string    `json:"board"`
+		Modified  time.Time `json:"modified"`
+		Signature string    `json:"signature"`
 	}
-	type responseJson struct {
-		AdminBoard boardJson   `json:"adminBoard"`
-		Boards     []boardJson `json:"boards"`
+	response := struct {
+		Boards  []boardJson `json:"boards"`
+		Missing []string    `json:"missing"`
+	}{Boards: []boardJson{}, Missing: []string{}}
+	now := time.Now()
+	for _, key := range keys {
+		board, found := boards[key]
+		if !found || (!s.serveExpiredBoards && keyExpired(key, now)) {
+			response.Missing = append(response.Missing, key)
+			continue
+		}
+		response.Boards = append(response.Boards, boardJson{
+			Key:       board.Key,
+			Board:     board.Board,
+			Modified:  board.Modified,
+			Signature: board.Signature,
+		})
 	}
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error in showBoards: %s", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(encoded)
+}
+
+// ageFraction is how far a board modified at modified is through its ttl:
+// 0 when just posted and 1 once it's old enough to be purged.
+func ageFraction(modified time.Time, now time.Time, ttl time.Duration) float64 {
+	if ttl <= 0 {
+		return 1
+	}
+	fraction := float64(now.Sub(modified)) / float64(ttl)
+	return math.Max(0, math.Min(1, fraction))
+}
+
+// boardAgeFraction is ageFraction for board under the purge policy: through
+// the board TTL, through the time left on its key when it was posted, or
+// whichever is further along when boards are purged at the earliest of the
+// two.
+func (s *Spring83Server) boardAgeFraction(board Board, now time.Time) float64 {
+	ttlFraction := ageFraction(board.Modified, now, s.boardTTL)
+	if s.purgePolicy == PurgeFixedTTL {
+		return ttlFraction
+	}
+	keyFraction := 1.0
+	if expiresAt, err := parseKeyExpiry(board.Key); err == nil {
+		keyFraction = ageFraction(board.Modified, now, expiresAt.Sub(board.Modified))
+	}
+	if s.purgePolicy == PurgeKeyExpiry {
+		return keyFraction
+	}
+	return math.Max(ttlFraction, keyFraction)
+}
 
-	var response responseJson
+// showIndexJson lists the boards on this server. With ?expiring_within=30d
+// (days, or a Go duration like 72h), it only lists boards whose keys expire
+// within that long from now.
+func (s *Spring83Server) showIndexJson(w http.ResponseWriter, r *http.Request) {
+	var expiringBefore time.Time
+	if param := r.URL.Query().Get("expiring_within"); param != "" {
+		window, err := parseExpiryWindow(param)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		expiringBefore = time.Now().Add(window)
+	}
+	type boardJson struct {
+		Key         string    `json:"key"`
+		Posted      time.Time `json:"posted"`
+		AgeFraction float64   `json:"ageFraction"`
+		Preview     string    `json:"preview"`
+		Views       *int      `json:"views,omitempty"`
+	}
 
-	boards, err := s.loadBoards()
+	views, err := s.viewCounts()
+	if err != nil {
+		log.Printf("Error in showIndexJson: %s", err.Error())
+		w.WriteHeader(500)
+		w.Write([]byte(`{"error": "unexpected server error"}`))
+		return
+	}
+	adminBoard, err := s.repo.GetBoard(s.adminBoard)
 	if err != nil {
 		log.Printf("Error in showIndexJson: %s", err.Error())
 		w.WriteHeader(500)
@@ -402,63 +1884,246 @@ func (s *Spring83Server) showIndexJson(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, board := range boards {
+	now := time.Now()
+	jsonify := func(board Board) []byte {
 		jsonifiedBoard := boardJson{
-			Key:    board.Key,
-			Posted: board.Modified,
+			Key:         board.Key,
+			Posted:      board.Modified,
+			AgeFraction: s.boardAgeFraction(board, now),
+			Preview:     board.Preview(),
 		}
-		if board.Key == s.adminBoard {
-			response.AdminBoard = jsonifiedBoard
-		} else {
-			response.Boards = append(response.Boards, jsonifiedBoard)
+		if views != nil {
+			boardViews := views[board.Key]
+			jsonifiedBoard.Views = &boardViews
 		}
+		encoded, _ := json.Marshal(jsonifiedBoard) // can't fail for boardJson
+		return encoded
 	}
 
-	encodedResponse, err := json.Marshal(response)
+	// The boards are written as they're read from the database, so that
+	// servers with many boards don't hold them all in memory. That's why the
+	// index is exempt from the request timeout, which would buffer it; it
+	// stops at the timeout itself instead. Once the response has started, an
+	// error ends the list early with an error field, so it's still JSON.
+	ctx, cancel := context.WithTimeout(r.Context(), s.requestTimeout)
+	defer cancel()
+	w.Header().Add("Content-Type", "application/json")
+	encodedAdminBoard, _ := json.Marshal(boardJson{})
+	if adminBoard != nil && !keyExpired(adminBoard.Key, now) {
+		encodedAdminBoard = jsonify(*adminBoard)
+	}
+	w.Write([]byte(`{"adminBoard":`))
+	w.Write(encodedAdminBoard)
+	w.Write([]byte(`,"boards":[`))
+	first := true
+	err = s.repo.IterateBoards(func(board Board) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if board.Key == s.adminBoard || keyExpired(board.Key, now) {
+			return nil
+		}
+		if !expiringBefore.IsZero() && !keyExpiresBetween(board.Key, now, expiringBefore) {
+			return nil
+		}
+		if !first {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err := w.Write(jsonify(board))
+		return err
+	})
 	if err != nil {
-		log.Printf("Error in showIndexJson: %s", err.Error())
-		w.WriteHeader(500)
-		w.Write([]byte(`{"error": "unexpected server error"}`))
+		log.Printf("Error in showIndexJson, after the response started: %s", err.Error())
+		w.Write([]byte(`],"error":"unexpected server error"}`))
 		return
 	}
-	w.Write(encodedResponse)
+	w.Write([]byte("]}"))
 }
 
+// showOptions advertises the methods the requested resource supports.
 func (s *Spring83Server) showOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", s.allowedMethods(r.URL.Path))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// allowedMethods lists the methods a path supports, for the Allow header.
+// Boards can be read, published, and deleted; everything else is read-only,
+// apart from form posts to the root when they're enabled and admin actions.
+func (s *Spring83Server) allowedMethods(path string) string {
+	switch {
+	case len(path) == 1 && s.allowFormPosts:
+		return "GET, HEAD, POST, OPTIONS"
+	case len(path) == 1:
+		return "GET, HEAD, OPTIONS"
+	case isKeyPath(path):
+		return "GET, HEAD, PUT, DELETE, OPTIONS"
+	case path[1:] == "admin/purge-all", path[1:] == "admin/reload":
+		return "POST, OPTIONS"
+	case path[1:] == "admin/featured":
+		return "GET, HEAD, POST, OPTIONS"
+	default:
+		return "GET, HEAD, OPTIONS"
+	}
+}
+
+// isKeyPath reports whether path names a board, i.e. is a slash followed by a
+// hex-encoded ed25519 public key.
+func isKeyPath(path string) bool {
+	key, err := hex.DecodeString(strings.TrimPrefix(path, "/"))
+	return err == nil && len(key) == ed25519.PublicKeySize
+}
+
+// hasStaticFile reports whether name exists in the static assets directory.
+func (s *Spring83Server) hasStaticFile(name string) bool {
+	if s.staticDir == "" {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(s.staticDir, name))
+	return err == nil && !info.IsDir()
+}
+
+// showComposer serves the board composer page. Boards are signed by
+// compose.js in the browser, so the page's CSP only needs to allow our own
+// script and PUTs back to this server.
+func (s *Spring83Server) showComposer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html;charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; script-src 'self'; connect-src 'self'; form-action 'none';")
+	w.Write(composeHTML)
+}
+
+func (s *Spring83Server) showComposerScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript;charset=utf-8")
+	w.Write(composeJS)
+}
+
 func (s *Spring83Server) showFederation(w http.ResponseWriter, r *http.Request) {
-	federationText := fmt.Sprintf("%s\n", strings.Join(s.federates, "\n"))
+	federationText := fmt.Sprintf("%s\n", strings.Join(s.settings().federates, "\n"))
 	w.Write([]byte(federationText))
 }
 
 func (s *Spring83Server) addCORSHeaders(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Access-Control-Allow-Methods", "GET, PUT, OPTIONS")
+	if s.allowFormPosts {
+		w.Header().Add("Access-Control-Allow-Methods", "GET, PUT, POST, DELETE, OPTIONS")
+	} else {
+		w.Header().Add("Access-Control-Allow-Methods", "GET, PUT, DELETE, OPTIONS")
+	}
 	w.Header().Add("Access-Control-Allow-Origin", "*")
-	w.Header().Add("Access-Control-Allow-Headers", "Content-Type, If-Modified-Since, Spring-Signature, Spring-Version")
+	w.Header().Add("Access-Control-Allow-Headers", "Content-Encoding, Content-Type, If-Modified-Since, Spring-Auth, Spring-Signature, Spring-Version")
 	w.Header().Add("Access-Control-Expose-Headers", "Content-Type, Last-Modified, Spring-Difficulty, Spring-Signature, Spring-Version")
 }
 
+// DefaultRequestTimeout is how long a request may take when no timeout is
+// configured.
+const DefaultRequestTimeout = 30 * time.Second
+
+// untimedPaths are exempt from the request timeout, which buffers the whole
+// response: endpoints that hold the connection open on purpose, and the
+// index, which is streamed and keeps its own deadline.
+var untimedPaths = map[string]bool{
+	"/events":     true,
+	"/index.json": true,
+}
+
+// heldOpenPaths hold their connection open on purpose, so they're exempt from
+// the concurrency limit too.
+var heldOpenPaths = map[string]bool{
+	"/events": true,
+}
+
+// Handler returns RootHandler wrapped so that a request taking longer than
+// the request timeout gets 503 Service Unavailable instead of holding its
+// connection open, limited to the configured number of concurrent requests,
+// and with the path prefix stripped from requests.
+func (s *Spring83Server) Handler() http.Handler {
+	timed := http.TimeoutHandler(http.HandlerFunc(s.RootHandler), s.requestTimeout, "Request timed out")
+	limited := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if untimedPaths[r.URL.Path] {
+			s.RootHandler(w, r)
+			return
+		}
+		timed.ServeHTTP(w, r)
+	})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.settings().requestLimiter.Serve(w, r, limited)
+	})
+	if s.pathPrefix == "" {
+		return handler
+	}
+	stripped := http.StripPrefix(s.pathPrefix, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == s.pathPrefix {
+			http.Redirect(w, r, s.pathPrefix+"/", http.StatusMovedPermanently)
+		} else if strings.HasPrefix(r.URL.Path, s.pathPrefix+"/") {
+			stripped.ServeHTTP(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// normalizePathPrefix gives a path prefix a leading slash and no trailing
+// one, so that "spring/" and "/spring" mean the same. "/" is no prefix.
+func normalizePathPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
 func (s *Spring83Server) RootHandler(w http.ResponseWriter, r *http.Request) {
 	s.addCORSHeaders(w, r)
 	if r.Method == "PUT" {
 		s.publishBoard(w, r)
-	} else if r.Method == "GET" {
+	} else if r.Method == "GET" || r.Method == "HEAD" {
 		if len(r.URL.Path) == 1 {
 			s.showAllBoards(w, r)
 		} else {
-			if r.URL.Path[1:] == "federation.txt" {
+			if s.staticHandler != nil && strings.HasPrefix(r.URL.Path, "/static/") {
+				s.staticHandler.ServeHTTP(w, r)
+			} else if r.URL.Path[1:] == "federation.txt" {
 				s.showFederation(w, r)
 			} else if r.URL.Path[1:] == "index.json" {
 				s.showIndexJson(w, r)
+			} else if r.URL.Path[1:] == "status" {
+				s.showStatus(w, r)
+			} else if r.URL.Path[1:] == "boards" {
+				s.showBoards(w, r)
+			} else if r.URL.Path[1:] == "readyz" {
+				s.showReadiness(w, r)
+			} else if r.URL.Path[1:] == "admin/propagation-log" {
+				s.showPropagationLog(w, r)
+			} else if r.URL.Path[1:] == "admin/featured" {
+				s.featured(w, r)
+			} else if r.URL.Path[1:] == "events" {
+				s.streamEvents(w, r)
+			} else if strings.HasSuffix(r.URL.Path, "/challenge") {
+				s.showChallenge(w, r)
+			} else if s.enableComposer && r.URL.Path[1:] == "compose" {
+				s.showComposer(w, r)
+			} else if s.enableComposer && r.URL.Path[1:] == "compose.js" {
+				s.showComposerScript(w, r)
 			} else {
 				s.showBoard(w, r)
 			}
 		}
+	} else if r.Method == "DELETE" && len(r.URL.Path) > 1 {
+		s.deleteBoard(w, r)
+	} else if r.Method == "POST" && len(r.URL.Path) == 1 && s.allowFormPosts {
+		s.publishBoardForm(w, r)
+	} else if r.Method == "POST" && r.URL.Path[1:] == "admin/purge-all" {
+		s.purgeAllBoards(w, r)
+	} else if r.Method == "POST" && r.URL.Path[1:] == "admin/reload" {
+		s.reloadConfig(w, r)
+	} else if r.Method == "POST" && r.URL.Path[1:] == "admin/featured" {
+		s.featured(w, r)
 	} else if r.Method == "OPTIONS" {
 		s.showOptions(w, r)
 	} else {
-		http.Error(w, "Invalid method", http.StatusBadRequest)
+		w.Header().Set("Allow", s.allowedMethods(r.URL.Path))
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
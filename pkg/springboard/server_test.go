@@ -0,0 +1,1699 @@
+package springboard
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestIndexShowsNoticeOnlyWhenConfigured(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/", nil))
+	if strings.Contains(w.Body.String(), `id="notice"`) {
+		t.Errorf("Index has a notice banner without a notice configured")
+	}
+
+	server = newTestServer(t, ServerConfig{Notice: `Maintenance <b>tonight</b> & "tomorrow"`})
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, `<div id="notice">Maintenance &lt;b&gt;tonight&lt;/b&gt; &amp; &#34;tomorrow&#34;</div>`) {
+		t.Errorf("Index doesn't show the escaped notice:\n%s", body)
+	}
+}
+
+func TestShowBoardNegotiatesRawOrRendered(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	board := testBoard(testKey(1), time.Now().Add(-time.Minute), "<p>hello</p>")
+	mustPublish(t, server.repo, board)
+
+	for _, raw := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/"+board.Key+"?raw=1", nil),
+		httptest.NewRequest(http.MethodGet, "/"+board.Key, nil),
+	} {
+		if raw.URL.RawQuery == "" {
+			raw.Header.Set("Accept", "text/html;q=0.5, application/spring-83")
+		}
+		w := serve(server, raw)
+		if w.Code != http.StatusOK || w.Body.String() != board.Board {
+			t.Fatalf("Raw fetch got %d %q, want the stored board", w.Code, w.Body.String())
+		}
+		if w.Header().Get("Spring-Signature") != board.Signature {
+			t.Errorf("Raw fetch has Spring-Signature %q", w.Header().Get("Spring-Signature"))
+		}
+		if w.Header().Get("Content-Security-Policy") != "" || w.Header().Get("Spring-Difficulty") != "" {
+			t.Errorf("Raw fetch has browser headers: %v", w.Header())
+		}
+	}
+
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/"+board.Key, nil))
+	if w.Code != http.StatusOK || w.Body.String() != board.Board {
+		t.Fatalf("Rendered fetch got %d %q, want the stored board", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Security-Policy") == "" || w.Header().Get("Spring-Difficulty") == "" {
+		t.Errorf("Rendered fetch is missing browser headers: %v", w.Header())
+	}
+}
+
+func TestFormPostStoresBoardLikePut(t *testing.T) {
+	server := newTestServer(t, ServerConfig{AllowFormPosts: true})
+	modified := time.Now().Add(-time.Minute)
+	putBoard := testBoard(testKey(1), modified, "<p>hello</p>")
+	formBoard := testBoard(testKey(2), modified, "<p>hello</p>")
+
+	if w := put(server, putBoard); w.Code != http.StatusOK {
+		t.Fatalf("PUT got %d: %s", w.Code, w.Body.String())
+	}
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	writer.WriteField("key", formBoard.Key)
+	writer.WriteField("signature", formBoard.Signature)
+	writer.WriteField("board", formBoard.Board)
+	writer.Close()
+	r := httptest.NewRequest(http.MethodPost, "/", &form)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	if w := serve(server, r); w.Code != http.StatusOK {
+		t.Fatalf("Form POST got %d: %s", w.Code, w.Body.String())
+	}
+
+	stored, err := server.repo.GetBoards([]string{putBoard.Key, formBoard.Key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("Got %d stored boards, want 2", len(stored))
+	}
+	for _, board := range stored {
+		want := putBoard
+		if board.Key == formBoard.Key {
+			want = formBoard
+		}
+		if board.Board != want.Board || board.Signature != want.Signature || !board.Modified.Equal(want.Modified) || board.ContentType != "" {
+			t.Errorf("Stored %+v, want %+v", board, want)
+		}
+	}
+}
+
+func TestFormPostsAreDisabledByDefault(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(""))
+	if w := serve(server, r); w.Code == http.StatusOK {
+		t.Errorf("Form POST succeeded without AllowFormPosts")
+	}
+}
+
+func TestDeletionPropagatesToFederates(t *testing.T) {
+	peer := newTestServer(t, ServerConfig{})
+	peerHTTP := httptest.NewServer(peer.Handler())
+	defer peerHTTP.Close()
+	server := newTestServer(t, ServerConfig{Federates: []string{peerHTTP.URL}})
+
+	board := testBoard(testKey(1), time.Now().Add(-time.Hour), "<p>hello</p>")
+	mustPublish(t, server.repo, board)
+	mustPublish(t, peer.repo, board)
+
+	if w := serve(server, deleteRequest(board.Key, time.Now().Add(-time.Minute))); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE got %d: %s", w.Code, w.Body.String())
+	}
+	if stored, _ := server.repo.GetBoard(board.Key); stored != nil {
+		t.Errorf("Board is still stored after DELETE")
+	}
+	waitFor(t, 5*time.Second, "the peer to delete the board", func() bool {
+		stored, err := peer.repo.GetBoard(board.Key)
+		return err == nil && stored == nil
+	})
+}
+
+func TestPurgePolicies(t *testing.T) {
+	now := time.Now()
+	expiredKey := testKeyExpiring(1, now.AddDate(0, -2, 0))
+	validKey := testKeyExpiring(2, now.AddDate(1, 0, 0))
+	boards := []Board{
+		testBoard(expiredKey, now.Add(-time.Hour), "new board, expired key"),
+		testBoard(validKey, now.Add(-30*24*time.Hour), "old board, valid key"),
+		testBoard(testKeyExpiring(3, now.AddDate(0, -2, 0)), now.Add(-30*24*time.Hour), "old board, expired key"),
+		testBoard(testKeyExpiring(4, now.AddDate(1, 0, 0)), now.Add(-time.Hour), "new board, valid key"),
+	}
+	tests := []struct {
+		policy PurgePolicy
+		kept   []int
+	}{
+		{PurgeFixedTTL, []int{0, 3}},
+		{PurgeKeyExpiry, []int{1, 3}},
+		{PurgeEarliest, []int{3}},
+	}
+	for _, test := range tests {
+		server := newTestServer(t, ServerConfig{PurgePolicy: test.policy, BoardTTL: 22 * 24 * time.Hour})
+		for _, board := range boards {
+			mustPublish(t, server.repo, board)
+		}
+		server.purgeOldBoards(now)
+		for i, board := range boards {
+			stored, err := server.repo.GetBoard(board.Key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := false
+			for _, k := range test.kept {
+				kept = kept || k == i
+			}
+			if (stored != nil) != kept {
+				t.Errorf("%s: %q kept is %t, want %t", test.policy, board.Board, stored != nil, kept)
+			}
+		}
+	}
+}
+
+func TestConcurrentPutsKeepNewestBoard(t *testing.T) {
+	forEachRepo(t, func(t *testing.T, repo BoardRepo) {
+		server := newTestServerWithRepo(repo, ServerConfig{})
+		key := testKey(1)
+		start := time.Now().Add(-time.Hour)
+		const writers = 8
+		const boardsPerWriter = 10
+
+		var wait sync.WaitGroup
+		for writer := 0; writer < writers; writer++ {
+			wait.Add(1)
+			go func(writer int) {
+				defer wait.Done()
+				// Writers interleave their boards' times, so each races
+				// the others to replace the stored board.
+				for i := 0; i < boardsPerWriter; i++ {
+					modified := start.Add(time.Duration(i*writers+writer) * time.Second)
+					board := testBoard(key, modified, fmt.Sprintf("<p>writer %d, board %d</p>", writer, i))
+					w := put(server, board)
+					if w.Code != http.StatusOK && w.Code != http.StatusConflict {
+						t.Errorf("PUT got %d: %s", w.Code, w.Body.String())
+					}
+				}
+			}(writer)
+		}
+		wait.Wait()
+
+		newest := testBoard(key, start.Add(time.Duration(writers*boardsPerWriter-1)*time.Second),
+			fmt.Sprintf("<p>writer %d, board %d</p>", writers-1, boardsPerWriter-1))
+		stored, err := repo.GetBoard(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored == nil || stored.Board != newest.Board || stored.Signature != newest.Signature || !stored.Modified.Equal(newest.Modified) {
+			t.Errorf("Stored %+v, want the newest board %+v", stored, newest)
+		}
+	})
+}
+
+func TestServesStaticDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "favicon.svg"), []byte("<svg></svg>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, ServerConfig{StaticDir: dir})
+
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/static/favicon.svg", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "<svg></svg>" {
+		t.Errorf("GET /static/favicon.svg got %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "/static/missing.css", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a missing static file got %d, want 404", w.Code)
+	}
+	w = serve(server, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(w.Body.String(), `<link rel="icon" href="/static/favicon.svg">`) {
+		t.Errorf("Index doesn't use the custom favicon")
+	}
+}
+
+func TestIndexLeavesOutExpiredKeys(t *testing.T) {
+	now := time.Now()
+	active := testBoard(testKey(1), now, "active board")
+	expired := testBoard(testKeyExpiring(2, now.AddDate(0, -2, 0)), now, "expired board")
+
+	for _, serveExpired := range []bool{false, true} {
+		server := newTestServer(t, ServerConfig{ServeExpiredBoards: serveExpired})
+		mustPublish(t, server.repo, active)
+		mustPublish(t, server.repo, expired)
+
+		index := serve(server, httptest.NewRequest(http.MethodGet, "/index.json", nil))
+		var listed struct {
+			Boards []struct{ Key string }
+		}
+		if err := json.Unmarshal(index.Body.Bytes(), &listed); err != nil {
+			t.Fatalf("Index JSON didn't parse: %s", err)
+		}
+		if len(listed.Boards) != 1 || listed.Boards[0].Key != active.Key {
+			t.Errorf("Index JSON listed %+v, want only %s", listed.Boards, active.Key)
+		}
+		page := serve(server, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String()
+		if !strings.Contains(page, active.Key) || strings.Contains(page, expired.Key) {
+			t.Errorf("Index should list only the active board")
+		}
+
+		want := http.StatusGone
+		if serveExpired {
+			want = http.StatusOK
+		}
+		if w := serve(server, httptest.NewRequest(http.MethodGet, "/"+expired.Key, nil)); w.Code != want {
+			t.Errorf("With ServeExpiredBoards %t, GET of an expired key got %d, want %d", serveExpired, w.Code, want)
+		}
+	}
+}
+
+func TestShowBoardIsGoneOnceKeyExpires(t *testing.T) {
+	now := time.Now()
+	server := newTestServer(t, ServerConfig{})
+	boards := map[string]int{
+		testKey(1):              http.StatusOK,
+		testKeyExpiring(2, now): http.StatusOK, // valid until the first of next month
+		testKeyExpiring(3, now.AddDate(0, -1, 0)): http.StatusGone,
+	}
+	for key := range boards {
+		mustPublish(t, server.repo, testBoard(key, now, "hello"))
+	}
+	for key, want := range boards {
+		if w := serve(server, httptest.NewRequest(http.MethodGet, "/"+key, nil)); w.Code != want {
+			t.Errorf("GET /%s got %d, want %d", key, w.Code, want)
+		}
+	}
+
+	// Keys expire at the start of the month after their MMYY.
+	key := testKeyExpiring(4, time.Date(2022, 6, 15, 0, 0, 0, 0, time.UTC))
+	if keyExpired(key, time.Date(2022, 6, 30, 23, 59, 59, 0, time.UTC)) {
+		t.Errorf("Key expiring 0622 expired before July")
+	}
+	if !keyExpired(key, time.Date(2022, 7, 1, 0, 0, 1, 0, time.UTC)) {
+		t.Errorf("Key expiring 0622 still valid in July")
+	}
+}
+
+func TestBootstrapBoardIsPublishedOnStartup(t *testing.T) {
+	adminKey := testKey(1)
+	bootstrap := testBoard(adminKey, time.Now(), "<h1>Welcome</h1>")
+	path := filepath.Join(t.TempDir(), "welcome.html")
+	if err := os.WriteFile(path, []byte(bootstrap.Board), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestServer(t, ServerConfig{AdminBoard: adminKey})
+	if err := server.bootstrapAdminBoard(path, bootstrap.Signature); err != nil {
+		t.Fatalf("Bootstrap failed: %s", err)
+	}
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "/"+adminKey, nil)); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Welcome") {
+		t.Errorf("GET of the admin board got %d %q", w.Code, w.Body.String())
+	}
+	if !strings.Contains(serve(server, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String(), "Welcome") {
+		t.Errorf("Index doesn't show the bootstrap board")
+	}
+
+	// A later start leaves the admin board alone.
+	newer := testBoard(adminKey, time.Now().Add(time.Second), "<h1>Updated</h1>")
+	mustPublish(t, server.repo, newer)
+	if err := server.bootstrapAdminBoard(path, bootstrap.Signature); err != nil {
+		t.Fatalf("Second bootstrap failed: %s", err)
+	}
+	if board, _ := server.repo.GetBoard(adminKey); board == nil || board.Board != newer.Board {
+		t.Errorf("Bootstrap replaced the existing admin board")
+	}
+
+	// A board that fails the publish checks stops startup.
+	if err := newTestServer(t, ServerConfig{AdminBoard: adminKey}).bootstrapAdminBoard(path, newer.Signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Bootstrap with a bad signature returned %v", err)
+	}
+}
+
+func TestRefreshAdminBoardAdvancesItsTimestamp(t *testing.T) {
+	keyPath, pubkey, privkey := newTestKeyPair(t)
+	adminKey := hex.EncodeToString(pubkey)
+	server := newTestServer(t, ServerConfig{AdminBoard: adminKey})
+	loaded, err := server.loadAdminKey(keyPath)
+	if err != nil {
+		t.Fatalf("Could not load the admin key: %s", err)
+	}
+	if _, err := newTestServer(t, ServerConfig{AdminBoard: testKey(1)}).loadAdminKey(keyPath); err == nil {
+		t.Errorf("Loaded a key pair that isn't the admin board's")
+	}
+
+	posted := time.Now().Add(-48 * time.Hour)
+	original, err := PrepareBoard([]byte("<h1>Admin</h1>"), privkey, posted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustPublish(t, server.repo, original)
+
+	refreshedAt := time.Now()
+	if err := server.refreshAdminBoard(loaded, refreshedAt); err != nil {
+		t.Fatalf("Refresh failed: %s", err)
+	}
+	board, err := server.repo.GetBoard(adminKey)
+	if err != nil || board == nil {
+		t.Fatalf("Admin board is gone after the refresh (%v)", err)
+	}
+	if !board.Modified.Equal(refreshedAt.UTC().Truncate(time.Second)) {
+		t.Errorf("Refreshed board is modified %s, want %s", board.Modified, refreshedAt)
+	}
+	if stripped := string(stripTimeTag([]byte(board.Board))); stripped != "<h1>Admin</h1>" {
+		t.Errorf("Refresh changed the content to %q", stripped)
+	}
+	if err := board.Verify(); err != nil {
+		t.Errorf("Refreshed board's signature doesn't verify: %s", err)
+	}
+}
+
+func TestOldContentConflictTellsClientWhatToBeat(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	key := testKey(1)
+	stored := testBoard(key, time.Now(), "newer")
+	mustPublish(t, server.repo, stored)
+
+	w := put(server, testBoard(key, time.Now().Add(-time.Hour), "older"))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("PUT of an older board got %d, want 409", w.Code)
+	}
+	lastModified, err := http.ParseTime(w.Header().Get("Last-Modified"))
+	if err != nil || !lastModified.Equal(stored.Modified) {
+		t.Errorf("409 Last-Modified is %q, want %s", w.Header().Get("Last-Modified"), stored.Modified.Format(http.TimeFormat))
+	}
+	if w.Header().Get("Spring-Signature") != stored.Signature {
+		t.Errorf("409 Spring-Signature is %q, want the stored board's", w.Header().Get("Spring-Signature"))
+	}
+}
+
+func TestShowBoardAnswersRangeRequests(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	board := testBoard(testKey(1), time.Now().Add(-time.Minute), "<p>hello</p>")
+	mustPublish(t, server.repo, board)
+	size := len(board.Board)
+
+	tests := []struct {
+		rangeHeader  string
+		code         int
+		body         string
+		contentRange string
+	}{
+		{"", http.StatusOK, board.Board, ""},
+		{"bytes=0-9", http.StatusPartialContent, board.Board[:10], fmt.Sprintf("bytes 0-9/%d", size)},
+		{"bytes=-5", http.StatusPartialContent, board.Board[size-5:], fmt.Sprintf("bytes %d-%d/%d", size-5, size-1, size)},
+		{fmt.Sprintf("bytes=%d-", size+10), http.StatusRequestedRangeNotSatisfiable, "", fmt.Sprintf("bytes */%d", size)},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/"+board.Key, nil)
+		if test.rangeHeader != "" {
+			r.Header.Set("Range", test.rangeHeader)
+		}
+		w := serve(server, r)
+		if w.Code != test.code {
+			t.Errorf("Range %q got %d, want %d", test.rangeHeader, w.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusRequestedRangeNotSatisfiable && w.Header().Get("Accept-Ranges") != "bytes" {
+			t.Errorf("Range %q response doesn't advertise Accept-Ranges", test.rangeHeader)
+		}
+		if w.Header().Get("Content-Range") != test.contentRange {
+			t.Errorf("Range %q got Content-Range %q, want %q", test.rangeHeader, w.Header().Get("Content-Range"), test.contentRange)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("Range %q got body %q, want %q", test.rangeHeader, w.Body.String(), test.body)
+		}
+	}
+}
+
+func TestComposerIsServedOnlyWhenEnabled(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		server := newTestServer(t, ServerConfig{EnableComposer: enabled})
+		for _, path := range []string{"/compose", "/compose.js"} {
+			w := serve(server, httptest.NewRequest(http.MethodGet, path, nil))
+			if served := w.Code == http.StatusOK; served != enabled {
+				t.Errorf("With EnableComposer %t, GET %s got %d", enabled, path, w.Code)
+			}
+		}
+		if !enabled {
+			continue
+		}
+		w := serve(server, httptest.NewRequest(http.MethodGet, "/compose", nil))
+		if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self'") || !strings.Contains(csp, "connect-src 'self'") {
+			t.Errorf("Composer's CSP doesn't allow its script to PUT boards: %q", csp)
+		}
+		if !strings.Contains(w.Body.String(), "compose.js") {
+			t.Errorf("Composer page doesn't load its script")
+		}
+		script := serve(server, httptest.NewRequest(http.MethodGet, "/compose.js", nil)).Body.String()
+		if buffer := fmt.Sprintf("TIME_BUFFER_MINUTES = %d;", int(DefaultTimeBuffer.Minutes())); !strings.Contains(script, buffer) {
+			t.Errorf("Composer doesn't backdate boards by DefaultTimeBuffer, want %q", buffer)
+		}
+	}
+}
+
+// gzipRequest compresses r's body with gzip, as the client does with Gzip.
+func gzipRequest(t *testing.T, r *http.Request, body []byte) *http.Request {
+	t.Helper()
+	compressed, err := gzipBody(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(compressed))
+	r.ContentLength = int64(len(compressed))
+	r.Header.Set("Content-Encoding", "gzip")
+	return r
+}
+
+func TestPublishBoardDecompressesGzip(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	board := testBoard(testKey(1), time.Now(), "<p>squeezed</p>")
+	w := serve(server, gzipRequest(t, putRequest(board), []byte(board.Board)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Gzipped PUT got %d %q", w.Code, w.Body.String())
+	}
+	if stored, _ := server.repo.GetBoard(board.Key); stored == nil || stored.Board != board.Board {
+		t.Errorf("Stored %+v, want the decompressed board", stored)
+	}
+
+	// A few kilobytes that decompress to 10 MB are cut off at the size limit.
+	bomb := testBoard(testKey(2), time.Now(), strings.Repeat(" ", 10<<20))
+	r := gzipRequest(t, putRequest(bomb), []byte(bomb.Board))
+	if r.ContentLength > MaxBoardSize*10 {
+		t.Fatalf("Bomb compressed to %d bytes", r.ContentLength)
+	}
+	if w := serve(server, r); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Decompression bomb got %d, want 413", w.Code)
+	}
+	if stored, _ := server.repo.GetBoard(bomb.Key); stored != nil {
+		t.Errorf("Decompression bomb was stored")
+	}
+}
+
+func TestPropagationOnlyTargetsPushList(t *testing.T) {
+	pushPeer := newTestServer(t, ServerConfig{})
+	pushHTTP := httptest.NewServer(pushPeer.Handler())
+	defer pushHTTP.Close()
+	readPeer := newTestServer(t, ServerConfig{})
+	readHTTP := httptest.NewServer(readPeer.Handler())
+	defer readHTTP.Close()
+
+	server := newTestServer(t, ServerConfig{
+		Federates:   []string{readHTTP.URL, pushHTTP.URL},
+		PropagateTo: []string{pushHTTP.URL},
+	})
+	federation := serve(server, httptest.NewRequest(http.MethodGet, "/federation.txt", nil)).Body.String()
+	if federation != readHTTP.URL+"\n"+pushHTTP.URL+"\n" {
+		t.Errorf("federation.txt is %q, want both advertised federates", federation)
+	}
+	if targets := server.relayTargets(testKey(1), nil); len(targets) != 1 || targets[0] != pushHTTP.URL {
+		t.Errorf("Relaying to %v, want only the push list", targets)
+	}
+
+	board := testBoard(testKey(1), time.Now(), "<p>hello</p>")
+	if w := put(server, board); w.Code != http.StatusOK {
+		t.Fatalf("PUT got %d: %s", w.Code, w.Body.String())
+	}
+	waitFor(t, 5*time.Second, "the push peer to get the board", func() bool {
+		stored, err := pushPeer.repo.GetBoard(board.Key)
+		return err == nil && stored != nil
+	})
+	if stored, _ := readPeer.repo.GetBoard(board.Key); stored != nil {
+		t.Errorf("Board was pushed to a federate that's only advertised")
+	}
+
+	// Without a push list, boards are pushed to every federate.
+	defaulted := newTestServer(t, ServerConfig{Federates: []string{readHTTP.URL, pushHTTP.URL}})
+	if targets := defaulted.relayTargets(testKey(1), nil); len(targets) != 2 {
+		t.Errorf("Relaying to %v without a push list, want every federate", targets)
+	}
+}
+
+// crowdedRepo reports a board count high enough for the difficulty factor to
+// reject some keys, without storing that many boards.
+type crowdedRepo struct {
+	BoardRepo
+	count int
+}
+
+func (repo crowdedRepo) BoardCount() (int, error) {
+	return repo.count, nil
+}
+
+func TestNoDifficultyAcceptsHighKeys(t *testing.T) {
+	// At 5 million boards, the difficulty factor is 0.5^4 = 0.0625, so keys
+	// over 15/16 of the maximum are rejected.
+	highKey := "f8" + testKey(1)[2:]
+	for _, noDifficulty := range []bool{false, true} {
+		repo := crowdedRepo{BoardRepo: newTestSqliteRepo(t), count: 5_000_000}
+		server := newTestServerWithRepo(repo, ServerConfig{NoDifficulty: noDifficulty})
+		if w := put(server, testBoard(testKey(2), time.Now(), "low key")); w.Code != http.StatusOK {
+			t.Errorf("With NoDifficulty %t, a low key got %d", noDifficulty, w.Code)
+		}
+		want := http.StatusForbidden
+		if noDifficulty {
+			want = http.StatusOK
+		}
+		if w := put(server, testBoard(highKey, time.Now(), "high key")); w.Code != want {
+			t.Errorf("With NoDifficulty %t, a high key got %d, want %d", noDifficulty, w.Code, want)
+		}
+		// Other checks still apply.
+		if w := put(server, testBoard(testKeyExpiring(3, time.Now().AddDate(0, -2, 0)), time.Now(), "expired")); w.Code != http.StatusBadRequest {
+			t.Errorf("With NoDifficulty %t, an expired key got %d", noDifficulty, w.Code)
+		}
+	}
+}
+
+func TestIndexPagesBoards(t *testing.T) {
+	server := newTestServer(t, ServerConfig{IndexPageSize: 3})
+	for i := 1; i <= 7; i++ {
+		mustPublish(t, server.repo, testBoard(testKey(i), time.Now().Add(-time.Duration(i)*time.Minute), fmt.Sprintf("board %d", i)))
+	}
+	renderedKey := regexp.MustCompile(`id="b[0-9a-f]{64}"`)
+
+	for _, test := range []struct {
+		page     string
+		boards   int
+		nextPage string
+	}{
+		{"", 3, "/?page=2"},
+		{"?page=2", 3, "/?page=3"},
+		{"?page=3", 1, ""},
+	} {
+		body := serve(server, httptest.NewRequest(http.MethodGet, "/"+test.page, nil)).Body.String()
+		if rendered := len(renderedKey.FindAllString(body, -1)); rendered != test.boards {
+			t.Errorf("Page %q rendered %d boards, want %d", test.page, rendered, test.boards)
+		}
+		if hasMore := strings.Contains(body, `id="more"`); hasMore != (test.nextPage != "") || !strings.Contains(body, test.nextPage) {
+			t.Errorf("Page %q has the wrong show more link, want %q", test.page, test.nextPage)
+		}
+	}
+}
+
+func TestIndexPagesStayFullAroundUnlistedBoards(t *testing.T) {
+	admin := testKey(20)
+	server := newTestServer(t, ServerConfig{IndexPageSize: 3, AdminBoard: admin})
+	for i := 1; i <= 7; i++ {
+		mustPublish(t, server.repo, testBoard(testKey(i), time.Now().Add(-time.Duration(i)*time.Minute), fmt.Sprintf("board %d", i)))
+		// Boards the index leaves out, interleaved with the listed ones.
+		expired := testKeyExpiring(30+i, time.Now().AddDate(0, -2, 0))
+		mustPublish(t, server.repo, testBoard(expired, time.Now().Add(-time.Duration(i)*time.Minute-time.Second), "expired"))
+	}
+	mustPublish(t, server.repo, testBoard(admin, time.Now().Add(-90*time.Second), "admin"))
+	featured := testKey(21)
+	mustPublish(t, server.repo, testBoard(featured, time.Now().Add(-150*time.Second), "featured"))
+	if err := server.repo.SetFeaturedKeys([]string{featured}); err != nil {
+		t.Fatal(err)
+	}
+	renderedKey := regexp.MustCompile(`id="b[0-9a-f]{64}"`)
+
+	for _, test := range []struct {
+		page   string
+		boards int
+	}{
+		// The admin board is shown on every page, on top of the listed ones.
+		{"?page=2", 4},
+		{"?page=3", 2},
+		{"?page=4", 1},
+		{"?page=9223372036854775807", 1},
+	} {
+		w := serve(server, httptest.NewRequest(http.MethodGet, "/"+test.page, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Page %q got %d", test.page, w.Code)
+		}
+		body := w.Body.String()
+		if rendered := len(renderedKey.FindAllString(body, -1)); rendered != test.boards {
+			t.Errorf("Page %q rendered %d boards, want %d", test.page, rendered, test.boards)
+		}
+		if strings.Contains(body, "expired") || strings.Contains(body, "featured") {
+			t.Errorf("Page %q lists a board it should leave out", test.page)
+		}
+	}
+}
+
+func TestWrappedBoardPagesForDirectNavigation(t *testing.T) {
+	server := newTestServer(t, ServerConfig{WrapBoardPages: true})
+	board := testBoard(testKey(1), time.Now(), "<p>hello</p>")
+	mustPublish(t, server.repo, board)
+
+	navigation := httptest.NewRequest(http.MethodGet, "/"+board.Key, nil)
+	navigation.Header.Set("Sec-Fetch-Dest", "document")
+	navigation.Header.Set("Accept", "text/html")
+	w := serve(server, navigation)
+	page := w.Body.String()
+	if strings.Contains(page, board.Board) || !strings.Contains(page, `src="/`+board.Key+`?embed=1"`) {
+		t.Errorf("Direct navigation didn't get the board wrapped in an iframe: %q", page)
+	}
+	if !strings.Contains(page, `id="metadata"`) || !strings.Contains(page, `href="/"`) {
+		t.Errorf("Wrapped board page has no metadata bar or link home")
+	}
+
+	iframe := httptest.NewRequest(http.MethodGet, "/"+board.Key+"?embed=1", nil)
+	iframe.Header.Set("Sec-Fetch-Dest", "iframe")
+	program := httptest.NewRequest(http.MethodGet, "/"+board.Key, nil)
+	for _, r := range []*http.Request{iframe, program} {
+		if w := serve(server, r); w.Body.String() != board.Board {
+			t.Errorf("GET %s (Sec-Fetch-Dest %q) got %q, want the board itself", r.URL, r.Header.Get("Sec-Fetch-Dest"), w.Body.String())
+		}
+	}
+
+	unwrapped := newTestServer(t, ServerConfig{})
+	mustPublish(t, unwrapped.repo, board)
+	if w := serve(unwrapped, navigation); w.Body.String() != board.Board {
+		t.Errorf("Board was wrapped without WrapBoardPages")
+	}
+}
+
+func TestOptionsAdvertisesAllowedMethodsPerPath(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	formServer := newTestServer(t, ServerConfig{AllowFormPosts: true})
+	for _, test := range []struct {
+		server *Spring83Server
+		path   string
+		allow  string
+	}{
+		{server, "/", "GET, HEAD, OPTIONS"},
+		{formServer, "/", "GET, HEAD, POST, OPTIONS"},
+		{server, "/" + testKey(1), "GET, HEAD, PUT, DELETE, OPTIONS"},
+		{server, "/admin/purge-all", "POST, OPTIONS"},
+		{server, "/index.json", "GET, HEAD, OPTIONS"},
+	} {
+		w := serve(test.server, httptest.NewRequest(http.MethodOptions, test.path, nil))
+		if w.Code != http.StatusNoContent {
+			t.Errorf("OPTIONS %s got %d, want 204", test.path, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != test.allow {
+			t.Errorf("OPTIONS %s allows %q, want %q", test.path, allow, test.allow)
+		}
+		if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Errorf("OPTIONS %s is missing CORS headers", test.path)
+		}
+	}
+}
+
+func TestLenientTimeTagsFallBackToHeader(t *testing.T) {
+	key := testKey(1)
+	body := "<p>no time tag</p>"
+	modified := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	untagged := Board{
+		Key:       key,
+		Board:     body,
+		Modified:  modified,
+		Signature: hex.EncodeToString(testSignature(key, []byte(body))),
+	}
+
+	strict := newTestServer(t, ServerConfig{})
+	if w := put(strict, untagged); w.Code != http.StatusBadRequest {
+		t.Errorf("Strict server got %d for a board without a time tag, want 400", w.Code)
+	}
+
+	lenient := newTestServer(t, ServerConfig{LenientTimeTags: true})
+	if w := put(lenient, untagged); w.Code != http.StatusOK {
+		t.Fatalf("Lenient server got %d: %s", w.Code, w.Body.String())
+	}
+	stored, _ := lenient.repo.GetBoard(key)
+	if stored == nil || stored.Board != body || !stored.Modified.Equal(modified) {
+		t.Errorf("Lenient server stored %+v, want the board dated by its If-Unmodified-Since", stored)
+	}
+
+	// A tag with an impossible date isn't missing, so it's still rejected.
+	malformed := `<time datetime="2026-13-16T10:00:00Z"></time>`
+	untagged.Board, untagged.Signature = malformed, hex.EncodeToString(testSignature(key, []byte(malformed)))
+	untagged.Modified = modified.Add(time.Minute)
+	if w := put(lenient, untagged); w.Code != http.StatusBadRequest {
+		t.Errorf("Lenient server got %d for an impossible time tag, want 400", w.Code)
+	}
+}
+
+func TestDeletedBoardIsNotResurrected(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	board := testBoard(testKey(1), now.Add(-time.Hour), "<p>hello</p>")
+	peer := newStubPeer(t, []Board{board})
+	server := newTestServer(t, ServerConfig{})
+	mustPublish(t, server.repo, board)
+
+	if w := serve(server, deleteRequest(board.Key, now.Add(-time.Minute))); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A federate that hasn't seen the tombstone yet relays the board, or
+	// still lists it when we pull.
+	relayed := put(server, board)
+	if relayed.Code != http.StatusConflict {
+		t.Errorf("Relaying the deleted board got %d, want 409", relayed.Code)
+	}
+	if pulled, err := server.pullFrom(peer.URL, now); err != nil || pulled != 0 {
+		t.Errorf("Pulling the deleted board pulled %d (%v), want 0", pulled, err)
+	}
+	if stored, _ := server.repo.GetBoard(board.Key); stored != nil {
+		t.Errorf("The deleted board was stored again")
+	}
+
+	// Its owner can still publish a newer one.
+	if w := put(server, testBoard(board.Key, now, "<p>back</p>")); w.Code != http.StatusOK {
+		t.Errorf("A board newer than the tombstone got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// indexKeys fetches the index JSON at url and returns the listed keys.
+func indexKeys(t *testing.T, server *Spring83Server, url string) []string {
+	t.Helper()
+	w := serve(server, httptest.NewRequest(http.MethodGet, url, nil))
+	var index Index
+	if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+		t.Fatalf("GET %s didn't return an index (%d %q): %s", url, w.Code, w.Body.String(), err)
+	}
+	keys := []string{}
+	for _, entry := range index.Boards {
+		keys = append(keys, entry.Key)
+	}
+	return keys
+}
+
+func TestIndexFiltersByExpiryWindow(t *testing.T) {
+	now := time.Now()
+	server := newTestServer(t, ServerConfig{})
+	// Keys expire on the first of the month after their MMYY, so this
+	// month's key expires within 31 days and the other two well after.
+	thisMonth := testKeyExpiring(1, now)
+	inThreeMonths := testKeyExpiring(2, now.AddDate(0, 3, 0))
+	nextYear := testKeyExpiring(3, now.AddDate(1, 0, 0))
+	for _, key := range []string{thisMonth, inThreeMonths, nextYear} {
+		mustPublish(t, server.repo, testBoard(key, now, "hello"))
+	}
+
+	if keys := indexKeys(t, server, "/index.json?expiring_within=32d"); len(keys) != 1 || keys[0] != thisMonth {
+		t.Errorf("Boards expiring within 32 days are %v, want only %s", keys, thisMonth)
+	}
+	if keys := indexKeys(t, server, "/index.json?expiring_within=3000h"); len(keys) != 2 {
+		t.Errorf("Boards expiring within 125 days are %v, want 2", keys)
+	}
+	if keys := indexKeys(t, server, "/index.json"); len(keys) != 3 {
+		t.Errorf("Unfiltered index lists %v, want every board", keys)
+	}
+	for _, window := range []string{"soon", "-3d", "30days"} {
+		if w := serve(server, httptest.NewRequest(http.MethodGet, "/index.json?expiring_within="+window, nil)); w.Code != http.StatusBadRequest {
+			t.Errorf("Window %q got %d, want 400", window, w.Code)
+		}
+	}
+
+	// A 30-day window, on fixed dates.
+	june15 := time.Date(2022, 6, 15, 0, 0, 0, 0, time.UTC)
+	window, err := parseExpiryWindow("30d")
+	if err != nil || window != 30*24*time.Hour {
+		t.Fatalf("30d parsed as %s (%v)", window, err)
+	}
+	for month, want := range map[time.Month]bool{time.May: false, time.June: true, time.July: false} {
+		key := testKeyExpiring(4, time.Date(2022, month, 1, 0, 0, 0, 0, time.UTC))
+		if got := keyExpiresBetween(key, june15, june15.Add(window)); got != want {
+			t.Errorf("Key for %s expiring within 30 days of June 15 is %t, want %t", month, got, want)
+		}
+	}
+}
+
+func TestIdenticalRepostIsIdempotent(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	board := testBoard(testKey(1), time.Now(), "<p>hello</p>")
+	if w := put(server, board); w.Code != http.StatusOK {
+		t.Fatalf("First PUT got %d: %s", w.Code, w.Body.String())
+	}
+	if w := put(server, board); w.Code != http.StatusOK {
+		t.Errorf("Identical repost got %d, want 200", w.Code)
+	}
+
+	changed := testBoard(board.Key, board.Modified, "<p>changed</p>")
+	if w := put(server, changed); w.Code != http.StatusConflict {
+		t.Errorf("Changed content at the same time got %d, want 409", w.Code)
+	}
+	if stored, _ := server.repo.GetBoard(board.Key); stored == nil || stored.Board != board.Board {
+		t.Errorf("Conflicting repost replaced the board with %+v", stored)
+	}
+}
+
+func TestFederatesMustBeHTTPURLs(t *testing.T) {
+	for _, test := range []struct {
+		config ServerConfig
+		valid  bool
+	}{
+		{ServerConfig{Federates: []string{"https://bogbody.biz", "http://localhost:8000/"}}, true},
+		{ServerConfig{Federates: []string{"bogbody.biz"}}, false},
+		{ServerConfig{Federates: []string{"ftp://bogbody.biz"}}, false},
+		{ServerConfig{Federates: []string{"https://"}}, false},
+		{ServerConfig{Federates: []string{"https://bogbody.biz/?page=2"}}, false},
+		{ServerConfig{PropagateTo: []string{"bogbody.biz"}}, false},
+		{ServerConfig{Federates: []string{"https://a.example", "https://b.example"}, MaxFederates: 1}, false},
+	} {
+		_, err := newReloadableSettings(test.config)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("Federates %v and push list %v (at most %d): got %v", test.config.Federates, test.config.PropagateTo, test.config.MaxFederates, err)
+		}
+	}
+}
+
+// slowRepo holds every board lookup until release is closed, then finds
+// nothing. If entered is set, it's sent on as each lookup starts waiting.
+type slowRepo struct {
+	BoardRepo
+	release chan struct{}
+	entered chan struct{}
+}
+
+func (repo slowRepo) GetBoardMeta(key string) (*BoardMeta, error) {
+	if repo.entered != nil {
+		repo.entered <- struct{}{}
+	}
+	<-repo.release
+	return nil, nil
+}
+
+func TestSlowRequestsTimeOut(t *testing.T) {
+	repo := slowRepo{BoardRepo: newTestSqliteRepo(t), release: make(chan struct{})}
+	t.Cleanup(func() { close(repo.release) })
+	server := newTestServerWithRepo(repo, ServerConfig{RequestTimeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/"+testKey(1), nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("A request stuck on the repo got %d, want 503", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("The stuck request took %s to time out", elapsed)
+	}
+
+	// Requests that don't touch the slow lookup are unaffected.
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "/index.json", nil)); w.Code != http.StatusOK {
+		t.Errorf("A fast request got %d", w.Code)
+	}
+}
+
+// renderedKeys returns the keys of the boards on an HTML index page, in the
+// order they're shown.
+func renderedKeys(t *testing.T, server *Spring83Server, url string) []string {
+	t.Helper()
+	body := serve(server, httptest.NewRequest(http.MethodGet, url, nil)).Body.String()
+	keys := []string{}
+	for _, match := range regexp.MustCompile(`id="b([0-9a-f]{64})"`).FindAllStringSubmatch(body, -1) {
+		keys = append(keys, match[1])
+	}
+	return keys
+}
+
+func TestPinnedOrderShowsPinnedBoardsFirst(t *testing.T) {
+	now := time.Now()
+	pinned := []string{testKey(4), testKey(1)}
+	for _, test := range []struct {
+		order IndexOrder
+		want  []string
+	}{
+		{IndexOrderPinned, []string{testKey(4), testKey(1), testKey(5), testKey(3), testKey(2)}},
+		{IndexOrderModified, []string{testKey(5), testKey(4), testKey(3), testKey(2), testKey(1)}},
+	} {
+		server := newTestServer(t, ServerConfig{IndexOrder: test.order, PinnedBoards: pinned})
+		for i := 1; i <= 5; i++ {
+			mustPublish(t, server.repo, testBoard(testKey(i), now.Add(time.Duration(i-10)*time.Minute), fmt.Sprintf("board %d", i)))
+		}
+		if got := renderedKeys(t, server, "/"); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("Index ordered by %q shows %v, want %v", test.order, got, test.want)
+		}
+	}
+}
+
+func TestEmptyAndTagOnlyBoards(t *testing.T) {
+	key := testKey(1)
+	empty := Board{Key: key, Modified: time.Now(), Signature: hex.EncodeToString(testSignature(key, nil))}
+	w := put(newTestServer(t, ServerConfig{}), empty)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Empty board") {
+		t.Errorf("A zero-length board got %d %q, want 400 Empty board", w.Code, w.Body.String())
+	}
+
+	tagOnly := testBoard(key, time.Now(), " \n")
+	for _, test := range []struct {
+		reject bool
+		want   int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusBadRequest},
+	} {
+		server := newTestServer(t, ServerConfig{RejectTagOnlyBoards: test.reject})
+		if w := put(server, tagOnly); w.Code != test.want {
+			t.Errorf("With RejectTagOnlyBoards %t, a tag-only board got %d %q, want %d", test.reject, w.Code, w.Body.String(), test.want)
+		}
+	}
+}
+
+func TestMultiHopViaChainAvoidsLoops(t *testing.T) {
+	chain := parseViaChain([]string{
+		"Spring/83 a.example, Spring/83 b.example",
+		"Spring/83 c.example\nSpring/83 d.example",
+	})
+	if want := []string{"a.example", "b.example", "c.example", "d.example"}; fmt.Sprint(chain) != fmt.Sprint(want) {
+		t.Errorf("Parsed the Via chain as %v, want %v", chain, want)
+	}
+
+	server := newTestServer(t, ServerConfig{
+		FQDN:      "me.example",
+		Federates: []string{"https://a.example", "https://c.example", "https://e.example", "https://f.example"},
+	})
+	// Federates anywhere in the chain are skipped, not only the sender.
+	targets := server.relayTargets(testKey(1), chain)
+	if want := []string{"https://e.example", "https://f.example"}; fmt.Sprint(targets) != fmt.Sprint(want) {
+		t.Errorf("Relaying to %v, want %v", targets, want)
+	}
+	// A board that already passed through this server isn't relayed again.
+	if targets := server.relayTargets(testKey(1), []string{"a.example", "me.example", "b.example"}); len(targets) != 0 {
+		t.Errorf("A board that looped back is relayed to %v", targets)
+	}
+
+	// Relays carry the chain on, with this server appended.
+	stub, puts := newCapturingServer(t)
+	relaying := newTestServer(t, ServerConfig{FQDN: "me.example", Federates: []string{stub.URL}})
+	r := putRequest(testBoard(testKey(1), time.Now(), "<p>hello</p>"))
+	r.Header.Add("Via", "Spring/83 a.example, Spring/83 b.example")
+	if w := serve(relaying, r); w.Code != http.StatusOK {
+		t.Fatalf("PUT got %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case put := <-puts:
+		if want := "Spring/83 a.example, Spring/83 b.example, Spring/83 me.example"; put.via != want {
+			t.Errorf("Relayed with Via %q, want %q", put.via, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Board wasn't relayed")
+	}
+}
+
+// bodyCountingRepo counts how many times boards' bodies are loaded.
+type bodyCountingRepo struct {
+	BoardRepo
+	mutex  sync.Mutex
+	bodies int
+}
+
+func (repo *bodyCountingRepo) GetBoard(key string) (*Board, error) {
+	repo.mutex.Lock()
+	repo.bodies++
+	repo.mutex.Unlock()
+	return repo.BoardRepo.GetBoard(key)
+}
+
+func (repo *bodyCountingRepo) loaded() int {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return repo.bodies
+}
+
+func TestShowBoardOnlyLoadsBodyWhenSendingIt(t *testing.T) {
+	repo := &bodyCountingRepo{BoardRepo: newTestSqliteRepo(t)}
+	server := newTestServerWithRepo(repo, ServerConfig{})
+	board := testBoard(testKey(1), time.Now().Add(-time.Hour), "<p>hello</p>")
+	mustPublish(t, repo, board)
+
+	conditional := httptest.NewRequest(http.MethodGet, "/"+board.Key, nil)
+	conditional.Header.Set("If-Modified-Since", board.Modified.Add(time.Minute).Format(http.TimeFormat))
+	if w := serve(server, conditional); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Conditional GET got %d %q, want 304 without a body", w.Code, w.Body.String())
+	}
+	if w := serve(server, httptest.NewRequest(http.MethodHead, "/"+board.Key, nil)); w.Code != http.StatusOK {
+		t.Errorf("HEAD got %d", w.Code)
+	}
+	if loaded := repo.loaded(); loaded != 0 {
+		t.Errorf("Loaded the board's body %d times for a 304 and a HEAD", loaded)
+	}
+
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "/"+board.Key, nil)); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), board.Board) {
+		t.Errorf("GET got %d %q, want the board", w.Code, w.Body.String())
+	}
+	if loaded := repo.loaded(); loaded != 1 {
+		t.Errorf("Loaded the board's body %d times for a GET, want once", loaded)
+	}
+}
+
+func TestBoardCSPBlocksConnectionsByDefault(t *testing.T) {
+	board := testBoard(testKey(1), time.Now(), "<p>hello</p>")
+	for _, test := range []struct {
+		allow bool
+		want  string
+	}{
+		{false, "connect-src 'none'"},
+		{true, "connect-src *"},
+	} {
+		server := newTestServer(t, ServerConfig{AllowBoardConnections: test.allow})
+		mustPublish(t, server.repo, board)
+		csp := serve(server, httptest.NewRequest(http.MethodGet, "/"+board.Key, nil)).Header().Get("Content-Security-Policy")
+		if !strings.Contains(csp, test.want) {
+			t.Errorf("With AllowBoardConnections %t, the board's CSP is %q, want %s", test.allow, csp, test.want)
+		}
+		if !test.allow && strings.Contains(csp, "connect-src *") {
+			t.Errorf("Default CSP lets boards connect anywhere: %q", csp)
+		}
+	}
+}
+
+func TestBoardSizeLimitAppliesToReceivedBytes(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	now := time.Now()
+	atLimit := testBoard(testKey(1), now, strings.Repeat("a", MaxContentSize))
+	if len(atLimit.Board) != MaxBoardSize {
+		t.Fatalf("Board is %d bytes, want MaxBoardSize", len(atLimit.Board))
+	}
+	if w := put(server, atLimit); w.Code != http.StatusOK {
+		t.Errorf("A board of exactly MaxBoardSize bytes got %d: %s", w.Code, w.Body.String())
+	}
+
+	overLimit := testBoard(testKey(2), now, strings.Repeat("a", MaxContentSize+1))
+	if w := put(server, overLimit); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("A board one byte over MaxBoardSize got %d, want 413", w.Code)
+	}
+	if stored, _ := server.repo.GetBoard(overLimit.Key); stored != nil {
+		t.Errorf("Oversized board was stored")
+	}
+}
+
+func TestIndexReportsAgeFraction(t *testing.T) {
+	ttl := 48 * time.Hour
+	server := newTestServer(t, ServerConfig{BoardTTL: ttl})
+	mustPublish(t, server.repo, testBoard(testKey(1), time.Now().Add(-ttl/2), "halfway"))
+
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/index.json", nil))
+	var index struct {
+		Boards []struct {
+			Key         string  `json:"key"`
+			AgeFraction float64 `json:"ageFraction"`
+		} `json:"boards"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+		t.Fatalf("index.json isn't JSON (%q): %s", w.Body.String(), err)
+	}
+	if len(index.Boards) != 1 {
+		t.Fatalf("index.json lists %d boards, want 1", len(index.Boards))
+	}
+	if fraction := index.Boards[0].AgeFraction; fraction < 0.49 || fraction > 0.51 {
+		t.Errorf("A board at half its TTL has ageFraction %f, want about 0.5", fraction)
+	}
+
+	now := time.Now()
+	for _, test := range []struct {
+		modified time.Time
+		want     float64
+	}{
+		{now, 0},
+		{now.Add(time.Hour), 0},
+		{now.Add(-ttl), 1},
+		{now.Add(-2 * ttl), 1},
+	} {
+		if fraction := ageFraction(test.modified, now, ttl); fraction != test.want {
+			t.Errorf("Board modified %s from now has ageFraction %f, want %f", test.modified.Sub(now), fraction, test.want)
+		}
+	}
+}
+
+func TestAgeFractionFollowsPurgePolicy(t *testing.T) {
+	// Posted on March 1st with a key that expires on April 1st, and seen
+	// halfway to the key's expiry, a quarter of the way through the TTL.
+	modified := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	board := testBoard(testKeyExpiring(1, modified), modified, "hello")
+	now := modified.Add(31 * 12 * time.Hour)
+	ttl := 62 * 24 * time.Hour
+	for _, test := range []struct {
+		policy PurgePolicy
+		want   float64
+	}{
+		{PurgeFixedTTL, 0.25},
+		{PurgeKeyExpiry, 0.5},
+		{PurgeEarliest, 0.5},
+	} {
+		server := newTestServer(t, ServerConfig{PurgePolicy: test.policy, BoardTTL: ttl})
+		if fraction := server.boardAgeFraction(board, now); math.Abs(fraction-test.want) > 1e-9 {
+			t.Errorf("With purge policy %s, ageFraction is %f, want %f", test.policy, fraction, test.want)
+		}
+	}
+}
+
+func TestOversizedHeadersAreRejected(t *testing.T) {
+	url := runTestServer(t, ServerConfig{MaxHeaderBytes: 4 << 10})
+
+	r, err := http.NewRequest(http.MethodGet, url+"/index.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("A request with ordinary headers got %d", resp.StatusCode)
+	}
+
+	// net/http allows some slack over MaxHeaderBytes, so go well past it.
+	for i := 0; i < 16; i++ {
+		r.Header.Add(fmt.Sprintf("X-Padding-%d", i), strings.Repeat("a", 1<<10))
+	}
+	resp, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("A request with 16KB of headers got %d, want 431", resp.StatusCode)
+	}
+}
+
+func TestRelayedBoardKeepsItsContentType(t *testing.T) {
+	stub, puts := newCapturingServer(t)
+	server := newTestServer(t, ServerConfig{Federates: []string{stub.URL}})
+
+	for i, test := range []struct {
+		sent string
+		want string
+	}{
+		{"text/html; charset=us-ascii", "text/html; charset=us-ascii"},
+		{"", DefaultContentType},
+	} {
+		board := testBoard(testKey(i+1), time.Now(), "<p>hello</p>")
+		r := putRequest(board)
+		if test.sent != "" {
+			r.Header.Set("Content-Type", test.sent)
+		}
+		if w := serve(server, r); w.Code != http.StatusOK {
+			t.Fatalf("PUT with Content-Type %q got %d: %s", test.sent, w.Code, w.Body.String())
+		}
+		if stored, _ := server.repo.GetBoard(board.Key); stored == nil || stored.MediaType() != test.want {
+			t.Errorf("Board PUT with Content-Type %q was stored as %+v, want %q", test.sent, stored, test.want)
+		}
+		select {
+		case put := <-puts:
+			if put.contentType != test.want {
+				t.Errorf("Board PUT with Content-Type %q was relayed with %q, want %q", test.sent, put.contentType, test.want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Board PUT with Content-Type %q wasn't relayed", test.sent)
+		}
+	}
+}
+
+func TestShowBoardsFetchesSeveralKeys(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	first := testBoard(testKey(1), time.Now(), "first")
+	second := testBoard(testKey(2), time.Now(), "second")
+	mustPublish(t, server.repo, first)
+	mustPublish(t, server.repo, second)
+
+	url := "/boards?keys=" + first.Key + "," + testKey(3) + "," + strings.ToUpper(second.Key) + "," + first.Key
+	w := serve(server, httptest.NewRequest(http.MethodGet, url, nil))
+	var response struct {
+		Boards []struct {
+			Key       string `json:"key"`
+			Board     string `json:"board"`
+			Signature string `json:"signature"`
+		} `json:"boards"`
+		Missing []string `json:"missing"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("/boards didn't return JSON (%d %q): %s", w.Code, w.Body.String(), err)
+	}
+	if len(response.Boards) != 2 {
+		t.Fatalf("Got %d boards, want 2: %q", len(response.Boards), w.Body.String())
+	}
+	for i, want := range []Board{first, second} {
+		got := response.Boards[i]
+		if got.Key != want.Key || got.Board != want.Board || got.Signature != want.Signature {
+			t.Errorf("Board %d is %+v, want %+v", i, got, want)
+		}
+	}
+	if len(response.Missing) != 1 || response.Missing[0] != testKey(3) {
+		t.Errorf("Missing keys are %v, want only %s", response.Missing, testKey(3))
+	}
+
+	tooMany := make([]string, MaxBoardsPerRequest+1)
+	for i := range tooMany {
+		tooMany[i] = testKey(i + 1)
+	}
+	for name, url := range map[string]string{
+		"no keys":        "/boards",
+		"an invalid key": "/boards?keys=nothex",
+		"too many keys":  "/boards?keys=" + strings.Join(tooMany, ","),
+	} {
+		if w := serve(server, httptest.NewRequest(http.MethodGet, url, nil)); w.Code != http.StatusBadRequest {
+			t.Errorf("Asking for %s got %d, want 400", name, w.Code)
+		}
+	}
+}
+
+func TestSpecTestKeyIsUnauthorized(t *testing.T) {
+	server := newTestServer(t, ServerConfig{NoDifficulty: true})
+	board := testBoard(TestPublicKey, time.Now(), "<p>testing</p>")
+	w := put(server, board)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("PUT with the spec's test key got %d %q, want 401", w.Code, w.Body.String())
+	}
+	if err := errorFromResponse(w.Code, w.Body.Bytes()); !errors.Is(err, ErrKeyDenied) {
+		t.Errorf("Client sees %v, want ErrKeyDenied", err)
+	}
+	if stored, _ := server.repo.GetBoard(TestPublicKey); stored != nil {
+		t.Errorf("Board for the test key was stored")
+	}
+}
+
+func TestServesUnderPathPrefix(t *testing.T) {
+	server := newTestServer(t, ServerConfig{PathPrefix: "spring/", Federates: []string{"https://peer.example"}})
+	board := testBoard(testKey(1), time.Now(), "<p>hello</p>")
+	r := putRequest(board)
+	r.URL.Path = "/spring/" + board.Key
+	if w := serve(server, r); w.Code != http.StatusOK {
+		t.Fatalf("PUT under the prefix got %d: %s", w.Code, w.Body.String())
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		return serve(server, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if w := get("/spring/" + board.Key); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), board.Board) {
+		t.Errorf("Board under the prefix got %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/spring/"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `src="/spring/`+board.Key+`?embed=1"`) {
+		t.Errorf("Index under the prefix doesn't link boards under it: %d %q", w.Code, w.Body.String())
+	}
+	if keys := indexKeys(t, server, "/spring/index.json"); len(keys) != 1 || keys[0] != board.Key {
+		t.Errorf("index.json under the prefix lists %v", keys)
+	}
+	if w := get("/spring/federation.txt"); w.Code != http.StatusOK || w.Body.String() != "https://peer.example\n" {
+		t.Errorf("federation.txt under the prefix got %d %q", w.Code, w.Body.String())
+	}
+	if w := get("/spring"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/spring/" {
+		t.Errorf("The bare prefix got %d to %q, want a redirect to /spring/", w.Code, w.Header().Get("Location"))
+	}
+	for _, path := range []string{"/" + board.Key, "/index.json", "/springboard/"} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("%s outside the prefix got %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestStreamedIndexMatchesMarshaledIndex(t *testing.T) {
+	now := time.Now()
+	server := newTestServer(t, ServerConfig{AdminBoard: testKey(100), CountViews: true})
+	mustPublish(t, server.repo, testBoard(testKey(100), now, "<p>admin</p>"))
+	mustPublish(t, server.repo, testBoard(testKeyExpiring(101, now.AddDate(-1, 0, 0)), now, "expired"))
+	for i := 1; i <= 25; i++ {
+		mustPublish(t, server.repo, testBoard(testKey(i), now.Add(-time.Duration(i)*time.Minute), fmt.Sprintf(`<p>board "%d" &amp; more</p>`, i)))
+	}
+
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/index.json", nil))
+	var streamed map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &streamed); err != nil {
+		t.Fatalf("Streamed index isn't valid JSON (%q): %s", w.Body.String(), err)
+	}
+
+	// What marshaling the whole index at once would give.
+	type entry struct {
+		Key     string    `json:"key"`
+		Posted  time.Time `json:"posted"`
+		Preview string    `json:"preview"`
+		Views   *int      `json:"views,omitempty"`
+	}
+	toEntry := func(board Board) entry {
+		views := 0
+		return entry{board.Key, board.Modified, board.Preview(), &views}
+	}
+	boards, err := server.loadBoards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := struct {
+		AdminBoard entry   `json:"adminBoard"`
+		Boards     []entry `json:"boards"`
+	}{Boards: []entry{}}
+	for _, board := range boards {
+		if board.Key == testKey(100) {
+			index.AdminBoard = toEntry(board)
+		} else {
+			index.Boards = append(index.Boards, toEntry(board))
+		}
+	}
+	encoded, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var marshaled map[string]interface{}
+	if err := json.Unmarshal(encoded, &marshaled); err != nil {
+		t.Fatal(err)
+	}
+
+	// ageFraction depends on when it's computed, so it's only checked for
+	// being in range.
+	entries := append([]interface{}{streamed["adminBoard"]}, streamed["boards"].([]interface{})...)
+	for _, entry := range entries {
+		fields := entry.(map[string]interface{})
+		if fraction, ok := fields["ageFraction"].(float64); !ok || fraction < 0 || fraction > 1 {
+			t.Errorf("Entry %v has ageFraction %v", fields["key"], fields["ageFraction"])
+		}
+		delete(fields, "ageFraction")
+	}
+	if got, want := fmt.Sprint(streamed), fmt.Sprint(marshaled); got != want {
+		t.Errorf("Streamed index is\n%s\nwant\n%s", got, want)
+	}
+	if len(index.Boards) != 25 {
+		t.Errorf("Index has %d boards, want 25 (without the admin board or the expired key)", len(index.Boards))
+	}
+}
+
+// stallingRepo lists boards as they're read, waiting pause before each one
+// after the first, then fails with err if it's set.
+type stallingRepo struct {
+	BoardRepo
+	pause time.Duration
+	err   error
+}
+
+func (repo stallingRepo) IterateBoards(fn func(Board) error) error {
+	first := true
+	err := repo.BoardRepo.IterateBoards(func(board Board) error {
+		if !first {
+			time.Sleep(repo.pause)
+		}
+		first = false
+		return fn(board)
+	})
+	if err != nil {
+		return err
+	}
+	return repo.err
+}
+
+func TestCutShortIndexIsStillJSON(t *testing.T) {
+	base := newTestSqliteRepo(t)
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		mustPublish(t, base, testBoard(testKey(i), now.Add(-time.Duration(i)*time.Minute), "hello"))
+	}
+
+	for _, test := range []struct {
+		name   string
+		repo   stallingRepo
+		boards int
+	}{
+		{"a failing read", stallingRepo{BoardRepo: base, err: errors.New("disk on fire")}, 3},
+		{"the request timeout", stallingRepo{BoardRepo: base, pause: 100 * time.Millisecond}, 1},
+	} {
+		server := newTestServerWithRepo(test.repo, ServerConfig{RequestTimeout: 50 * time.Millisecond})
+		w := serve(server, httptest.NewRequest(http.MethodGet, "/index.json", nil))
+		// The index streams, so it isn't buffered by the request timeout,
+		// which would answer 503 and drop what was already written.
+		if w.Code != http.StatusOK {
+			t.Errorf("An index cut short by %s got %d", test.name, w.Code)
+		}
+		var index struct {
+			Boards []struct {
+				Key string `json:"key"`
+			} `json:"boards"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+			t.Errorf("An index cut short by %s isn't JSON (%q): %s", test.name, w.Body.String(), err)
+			continue
+		}
+		if len(index.Boards) != test.boards || index.Error == "" {
+			t.Errorf("An index cut short by %s lists %d boards with error %q, want %d and an error", test.name, len(index.Boards), index.Error, test.boards)
+		}
+
+		stub := httptest.NewServer(server.Handler())
+		_, err := NewClient(stub.URL).GetIndex()
+		stub.Close()
+		if err == nil {
+			t.Errorf("GetIndex took an index cut short by %s as complete", test.name)
+		}
+	}
+}
+
+func TestReplaySchedulesOnlyRecentBoards(t *testing.T) {
+	stub, puts := newCapturingServer(t)
+	ttl := 24 * time.Hour
+	server := newTestServer(t, ServerConfig{Federates: []string{stub.URL}, BoardTTL: ttl})
+	now := time.Now()
+	recent := testBoard(testKey(1), now.Add(-time.Hour), "<p>recent</p>")
+	mustPublish(t, server.repo, recent)
+	mustPublish(t, server.repo, testBoard(testKey(2), now.Add(-2*ttl), "<p>past the TTL</p>"))
+	mustPublish(t, server.repo, testBoard(testKeyExpiring(3, now.AddDate(0, -2, 0)), now.Add(-time.Hour), "<p>expired key</p>"))
+	unsigned := testBoard(testKey(4), now.Add(-time.Hour), "<p>migrated</p>")
+	unsigned.Signature = ""
+	mustPublish(t, server.repo, unsigned)
+
+	replayed, err := server.replayRecentBoards(now, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 1 {
+		t.Errorf("Replayed %d boards, want only the recent one", replayed)
+	}
+	select {
+	case put := <-puts:
+		if put.body != recent.Board {
+			t.Errorf("Replayed %q, want the recent board", put.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Recent board wasn't relayed")
+	}
+	select {
+	case put := <-puts:
+		t.Errorf("Also replayed %q", put.body)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestUnsupportedMethodsGet405WithAllow(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	for _, test := range []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodPatch, "/" + testKey(1), "GET, HEAD, PUT, DELETE, OPTIONS"},
+		{http.MethodDelete, "/", "GET, HEAD, OPTIONS"},
+		{http.MethodPost, "/index.json", "GET, HEAD, OPTIONS"},
+		{http.MethodPatch, "/admin/purge-all", "POST, OPTIONS"},
+	} {
+		w := serve(server, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s got %d, want 405", test.method, test.path, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != test.allow {
+			t.Errorf("%s %s got Allow %q, want %q", test.method, test.path, allow, test.allow)
+		}
+	}
+}
+
+func TestIndexShowsBoardPreviews(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	mustPublish(t, server.repo, testBoard(testKey(1), time.Now(), "<h1>Hello</h1><p>world</p>"))
+	mustPublish(t, server.repo, testBoard(testKey(2), time.Now().Add(-time.Minute), "<br>"))
+
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/index.json", nil))
+	var index struct {
+		Boards []struct {
+			Key     string `json:"key"`
+			Preview string `json:"preview"`
+		} `json:"boards"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Boards) != 2 || index.Boards[0].Preview != "Hello world" || index.Boards[1].Preview != "" {
+		t.Errorf("index.json previews are %+v, want \"Hello world\" and nothing for the tag-only board", index.Boards)
+	}
+
+	page := serve(server, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String()
+	if !strings.Contains(page, `title="Hello world"`) || !strings.Contains(page, `title="`+testKey(2)+`"`) {
+		t.Errorf("Index page's iframes aren't titled by preview, or by key without one")
+	}
+}
+
+func TestSaturatedServerAnswers503(t *testing.T) {
+	repo := slowRepo{BoardRepo: newTestSqliteRepo(t), release: make(chan struct{}), entered: make(chan struct{}, 1)}
+	server := newTestServerWithRepo(repo, ServerConfig{MaxConcurrentReads: 1, MaxConcurrentWrites: 1})
+
+	// A board lookup stuck in the repo holds the only read slot.
+	done := make(chan int)
+	go func() {
+		done <- serve(server, httptest.NewRequest(http.MethodGet, "/"+testKey(1), nil)).Code
+	}()
+	<-repo.entered
+
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/index.json", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("A read while reads are saturated got %d, want 503 with Retry-After", w.Code)
+	}
+	// Writes have their own limit.
+	if w := put(server, testBoard(testKey(2), time.Now(), "hello")); w.Code != http.StatusOK {
+		t.Errorf("A write while reads are saturated got %d: %s", w.Code, w.Body.String())
+	}
+
+	close(repo.release)
+	<-done
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "/index.json", nil)); w.Code != http.StatusOK {
+		t.Errorf("A read once the slot is free got %d", w.Code)
+	}
+}
+
+// writeCountingRepo counts the boards published to it, in or out of a
+// transaction.
+type writeCountingRepo struct {
+	BoardRepo
+	writes *int64
+}
+
+func (repo writeCountingRepo) PublishBoard(board Board) error {
+	atomic.AddInt64(repo.writes, 1)
+	return repo.BoardRepo.PublishBoard(board)
+}
+
+func (repo writeCountingRepo) WithTx(fn func(BoardRepo) error) error {
+	return repo.BoardRepo.WithTx(func(tx BoardRepo) error {
+		return fn(writeCountingRepo{tx, repo.writes})
+	})
+}
+
+// unreadableBody fails the test if anything reads it.
+type unreadableBody struct{ t *testing.T }
+
+func (body unreadableBody) Read([]byte) (int, error) {
+	body.t.Errorf("Read the body of a duplicate board")
+	return 0, io.EOF
+}
+
+func TestDuplicateFederatedBoardSkipsWrite(t *testing.T) {
+	var writes int64
+	server := newTestServerWithRepo(writeCountingRepo{newTestSqliteRepo(t), &writes}, ServerConfig{})
+	board := testBoard(testKey(1), time.Now().Add(-time.Minute), "<p>hello</p>")
+	if w := put(server, board); w.Code != http.StatusOK {
+		t.Fatalf("First PUT got %d: %s", w.Code, w.Body.String())
+	}
+
+	r := putRequest(board)
+	r.Body = io.NopCloser(unreadableBody{t})
+	r.Header.Set("Via", "1.1 peer.example")
+	if w := serve(server, r); w.Code != http.StatusOK {
+		t.Errorf("Duplicate PUT got %d: %s", w.Code, w.Body.String())
+	}
+	if got := atomic.LoadInt64(&writes); got != 1 {
+		t.Errorf("Duplicate PUT wrote to the repo: %d writes, want 1", got)
+	}
+
+	changed := testBoard(testKey(1), time.Now(), "<p>changed</p>")
+	if w := put(server, changed); w.Code != http.StatusOK {
+		t.Errorf("Changed board got %d: %s", w.Code, w.Body.String())
+	}
+	if got := atomic.LoadInt64(&writes); got != 2 {
+		t.Errorf("Changed board made %d writes in all, want 2", got)
+	}
+}
+
+func TestMaxExpiryHorizon(t *testing.T) {
+	now := time.Now()
+	key := testKeyExpiring(1, now.AddDate(3, 0, 0))
+
+	strict := newTestServer(t, ServerConfig{})
+	if w := put(strict, testBoard(key, now, "<p>hello</p>")); w.Code != http.StatusBadRequest {
+		t.Errorf("3-year key under the default horizon got %d, want 400", w.Code)
+	}
+
+	relaxed := newTestServer(t, ServerConfig{MaxExpiryHorizon: 4 * 365 * 24 * time.Hour})
+	if w := put(relaxed, testBoard(key, now, "<p>hello</p>")); w.Code != http.StatusOK {
+		t.Errorf("3-year key under a 4-year horizon got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The default horizon counts calendar years, as the two-year limit always
+	// has, so a leap day doesn't narrow it.
+	if err := validateKeyWithin(fmt.Sprintf("%057x83e0626", 1), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), DefaultMaxExpiryHorizon); err != nil {
+		t.Errorf("A key two calendar years out, across a leap day, got %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServerConfig{MaxExpiryHorizon: -time.Hour}
+	if err := RunServerWithListener(listener, config); err == nil || !strings.Contains(err.Error(), "MaxExpiryHorizon") {
+		t.Errorf("A negative horizon got %v", err)
+	}
+}
+
+func TestServesOnPortZeroListener(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ServerConfig{SQLDriver: "sqlite", SQLConnectionString: filepath.Join(t.TempDir(), "springboard.db")}
+	stopped := make(chan error, 1)
+	go func() { stopped <- RunServerWithListener(listener, config) }()
+	defer func() {
+		listener.Close()
+		<-stopped
+	}()
+
+	// The listener is bound before the server starts, so the first request
+	// connects without retrying.
+	port := listener.Addr().(*net.TCPAddr).Port
+	if port == 0 {
+		t.Fatalf("Listener reports port 0")
+	}
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET / on the reported port got %d", resp.StatusCode)
+	}
+}
+
+// untouchableRepo fails the test if a board is looked up or written.
+type untouchableRepo struct {
+	BoardRepo
+	t *testing.T
+}
+
+func (repo untouchableRepo) GetBoard(key string) (*Board, error) {
+	repo.t.Errorf("Looked up the board for %s", key)
+	return repo.BoardRepo.GetBoard(key)
+}
+
+func (repo untouchableRepo) GetBoardMeta(key string) (*BoardMeta, error) {
+	repo.t.Errorf("Looked up the board metadata for %s", key)
+	return repo.BoardRepo.GetBoardMeta(key)
+}
+
+func (repo untouchableRepo) BoardCount() (int, error) {
+	repo.t.Errorf("Counted the boards")
+	return repo.BoardRepo.BoardCount()
+}
+
+func (repo untouchableRepo) WithTx(fn func(BoardRepo) error) error {
+	repo.t.Errorf("Started a transaction")
+	return repo.BoardRepo.WithTx(fn)
+}
+
+func TestMalformedKeyOrSignatureSkipsDatabase(t *testing.T) {
+	server := newTestServerWithRepo(untouchableRepo{newTestSqliteRepo(t), t}, ServerConfig{})
+	board := testBoard(testKey(1), time.Now(), "<p>hello</p>")
+
+	for name, mangle := range map[string]func(r *http.Request){
+		"short key":          func(r *http.Request) { r.URL.Path = "/" + board.Key[2:] },
+		"non-hex key":        func(r *http.Request) { r.URL.Path = "/" + "zz" + board.Key[2:] },
+		"missing signature":  func(r *http.Request) { r.Header.Del("Spring-Signature") },
+		"short signature":    func(r *http.Request) { r.Header.Set("Spring-Signature", board.Signature[2:]) },
+		"non-hex signature":  func(r *http.Request) { r.Header.Set("Spring-Signature", "zz"+board.Signature[2:]) },
+		"too long signature": func(r *http.Request) { r.Header.Set("Spring-Signature", board.Signature+"00") },
+	} {
+		r := putRequest(board)
+		mangle(r)
+		if w := serve(server, r); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT with a %s got %d, want 400", name, w.Code)
+		}
+	}
+}
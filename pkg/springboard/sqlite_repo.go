@@ -2,8 +2,10 @@ package springboard
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/glebarez/go-sqlite"
@@ -11,7 +13,20 @@ import (
 )
 
 type SqliteRepo struct {
-	db *sql.DB
+	db dbtx
+	// conn is the connection pool, or nil if the repo is already running
+	// in a transaction.
+	conn *sql.DB
+}
+
+// WithTx implements BoardRepo
+func (repo *SqliteRepo) WithTx(fn func(BoardRepo) error) error {
+	if repo.conn == nil {
+		return fn(repo)
+	}
+	return inTx(repo.conn, func(tx *sql.Tx) error {
+		return fn(&SqliteRepo{db: tx})
+	})
 }
 
 // BoardCount implements BoardRepo
@@ -36,7 +51,7 @@ func (repo *SqliteRepo) BoardCount() (int, error) {
 }
 
 // DeleteBoardsBefore implements BoardRepo
-func (repo *SqliteRepo) DeleteBoardsBefore(expiry string) error {
+func (repo *SqliteRepo) DeleteBoardsBefore(expiry string) (int, error) {
 	query := `
 		  SELECT COUNT(*)
 		  FROM boards
@@ -46,16 +61,269 @@ func (repo *SqliteRepo) DeleteBoardsBefore(expiry string) error {
 	var count string
 	err := row.Scan(&count)
 	if err != nil {
-		return errors.Wrap(err, "Error determining how many boards to delete")
+		return 0, errors.Wrap(err, "Error determining how many boards to delete")
 	}
 	log.Printf("  %s boards to delete", count)
 	query = `
 		  DELETE FROM boards
 		  WHERE DATETIME(modified) < DATETIME(?)
 		`
-	_, err = repo.db.Exec(query, expiry)
+	var deleted int
+	err = atomically(repo.conn, repo.db, func(db dbtx) error {
+		result, err := db.Exec(query, expiry)
+		if err != nil {
+			return errors.Wrap(err, "Error running deletion query")
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "Could not determine how many boards were deleted")
+		}
+		deleted = int(affected)
+		return deleteViews(db, `
+			DELETE FROM board_views
+			WHERE key NOT IN (SELECT key FROM boards)
+			`)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// DeleteBoard implements BoardRepo
+func (repo *SqliteRepo) DeleteBoard(key string) error {
+	return atomically(repo.conn, repo.db, func(db dbtx) error {
+		_, err := db.Exec(`
+			DELETE FROM boards
+			WHERE key = ?
+			`, key)
+		if err != nil {
+			return errors.Wrap(err, "Could not delete board")
+		}
+		return deleteViews(db, `
+			DELETE FROM board_views
+			WHERE key = ?
+			`, key)
+	})
+}
+
+// DeleteAllBoards implements BoardRepo
+func (repo *SqliteRepo) DeleteAllBoards() (deleted int, err error) {
+	err = atomically(repo.conn, repo.db, func(db dbtx) error {
+		result, err := db.Exec(`DELETE FROM boards`)
+		if err != nil {
+			return errors.Wrap(err, "Could not delete boards")
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "Could not determine how many boards were deleted")
+		}
+		deleted = int(affected)
+		return deleteViews(db, `DELETE FROM board_views`)
+	})
+	return
+}
+
+// DeleteBoardOlderThan implements BoardRepo
+func (repo *SqliteRepo) DeleteBoardOlderThan(key string, modified time.Time) error {
+	return atomically(repo.conn, repo.db, func(db dbtx) error {
+		result, err := db.Exec(`
+			DELETE FROM boards
+			WHERE key = ? AND DATETIME(modified) < DATETIME(?)
+			`, key, modified.Format(time.RFC3339))
+		if err != nil {
+			return errors.Wrap(err, "Could not delete board")
+		}
+		if err = staleUnlessAffected(result); err == ErrStaleBoard {
+			var count int
+			err = db.QueryRow(`
+				SELECT count(*)
+				FROM boards
+				WHERE key = ?
+				`, key).Scan(&count)
+			if err != nil {
+				return errors.Wrap(err, "Could not check for board")
+			}
+			if count > 0 {
+				return ErrStaleBoard
+			}
+		} else if err != nil {
+			return err
+		}
+		_, err = db.Exec(`
+			INSERT INTO tombstones (key, modified)
+			            values(?, ?)
+			ON CONFLICT(key) DO UPDATE SET
+				    modified=excluded.modified
+			WHERE DATETIME(tombstones.modified) < DATETIME(excluded.modified)
+			`, key, modified.UTC().Format(time.RFC3339))
+		if err != nil {
+			return errors.Wrap(err, "Could not record tombstone")
+		}
+		return deleteViews(db, `
+			DELETE FROM board_views
+			WHERE key = ?
+			`, key)
+	})
+}
+
+// DeleteTombstonesBefore implements BoardRepo
+func (repo *SqliteRepo) DeleteTombstonesBefore(before time.Time) error {
+	_, err := repo.db.Exec(`
+		DELETE FROM tombstones
+		WHERE DATETIME(modified) < DATETIME(?)
+		`, before.UTC().Format(time.RFC3339))
 	if err != nil {
-		return errors.Wrap(err, "Error running deletion query")
+		return errors.Wrap(err, "Could not purge tombstones")
+	}
+	return nil
+}
+
+// IncrementViews implements BoardRepo
+func (repo *SqliteRepo) IncrementViews(key string) error {
+	_, err := repo.db.Exec(`
+		INSERT INTO board_views (key, views)
+		            values(?, 1)
+		ON CONFLICT(key) DO UPDATE SET
+			    views=views + 1
+		`, key)
+	if err != nil {
+		return errors.Wrap(err, "Could not count view")
+	}
+	return nil
+}
+
+// GetViewCounts implements BoardRepo
+func (repo *SqliteRepo) GetViewCounts() (map[string]int, error) {
+	rows, err := repo.db.Query(`
+		SELECT key, views
+		FROM board_views
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var key string
+		var views int
+		if err = rows.Scan(&key, &views); err != nil {
+			return nil, err
+		}
+		counts[key] = views
+	}
+	return counts, rows.Err()
+}
+
+// LogPropagation implements BoardRepo
+func (repo *SqliteRepo) LogPropagation(entry PropagationLogEntry) error {
+	_, err := repo.db.Exec(`
+		INSERT INTO propagation_log (key, destination, outcome, attempts, logged_at)
+		            values(?, ?, ?, ?, ?)
+		`, entry.Key, entry.Destination, string(entry.Outcome), entry.Attempts, entry.LoggedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return errors.Wrap(err, "Could not log propagation")
+	}
+	return nil
+}
+
+// GetPropagationLog implements BoardRepo
+func (repo *SqliteRepo) GetPropagationLog(limit int) ([]PropagationLogEntry, error) {
+	rows, err := repo.db.Query(`
+		SELECT key, destination, outcome, attempts, logged_at
+		FROM propagation_log
+		ORDER BY logged_at DESC, rowid DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanPropagationLog(rows)
+}
+
+// DeletePropagationLogBefore implements BoardRepo
+func (repo *SqliteRepo) DeletePropagationLogBefore(before time.Time) error {
+	_, err := repo.db.Exec(`
+		DELETE FROM propagation_log
+		WHERE DATETIME(logged_at) < DATETIME(?)
+		`, before.UTC().Format(time.RFC3339))
+	if err != nil {
+		return errors.Wrap(err, "Could not purge the propagation log")
+	}
+	return nil
+}
+
+// GetBoardsToVerify implements BoardRepo
+func (repo *SqliteRepo) GetBoardsToVerify(limit int) ([]Board, error) {
+	rows, err := repo.db.Query(`
+		SELECT key, board, modified, signature, COALESCE(content_type, '')
+		FROM boards
+		WHERE quarantined = 0 AND signature != ''
+		ORDER BY last_verified IS NOT NULL, last_verified
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanBoards(rows)
+}
+
+// RecordVerification implements BoardRepo
+func (repo *SqliteRepo) RecordVerification(board Board, at time.Time, valid bool) error {
+	quarantine := 0
+	if !valid {
+		quarantine = 1
+	}
+	_, err := repo.db.Exec(`
+		UPDATE boards
+		SET last_verified = ?, quarantined = ?
+		WHERE key = ? AND signature = ?
+	`, at.UTC().Format(time.RFC3339), quarantine, board.Key, board.Signature)
+	if err != nil {
+		return errors.Wrap(err, "Could not record verification")
+	}
+	return nil
+}
+
+// GetVerificationCounts implements BoardRepo
+func (repo *SqliteRepo) GetVerificationCounts() (verified int, quarantined int, err error) {
+	row := repo.db.QueryRow(`
+		SELECT
+			COUNT(CASE WHEN last_verified IS NOT NULL AND quarantined = 0 THEN 1 END),
+			COUNT(CASE WHEN quarantined = 1 THEN 1 END)
+		FROM boards
+	`)
+	err = row.Scan(&verified, &quarantined)
+	return
+}
+
+// GetFeaturedKeys implements BoardRepo
+func (repo *SqliteRepo) GetFeaturedKeys() ([]string, error) {
+	rows, err := repo.db.Query(`
+		SELECT key
+		FROM featured_boards
+		ORDER BY position
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return scanKeys(rows)
+}
+
+// SetFeaturedKeys implements BoardRepo
+func (repo *SqliteRepo) SetFeaturedKeys(keys []string) error {
+	if _, err := repo.db.Exec(`DELETE FROM featured_boards`); err != nil {
+		return err
+	}
+	for position, key := range keys {
+		_, err := repo.db.Exec(`
+			INSERT INTO featured_boards (key, position)
+			            values(?, ?)
+		`, key, position)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -63,50 +331,107 @@ func (repo *SqliteRepo) DeleteBoardsBefore(expiry string) error {
 // GetAllBoards implements BoardRepo
 func (repo *SqliteRepo) GetAllBoards() ([]Board, error) {
 	query := `
-	  SELECT key, board, modified
+	  SELECT key, board, modified, signature, COALESCE(content_type, '')
 	  FROM boards
+	  WHERE quarantined = 0
 	  ORDER BY modified DESC
 	`
 	rows, err := repo.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
+	return scanBoards(rows)
+}
 
-	boards := []Board{}
-	for rows.Next() {
-		var key, board, modified string
+// IterateBoards implements BoardRepo
+func (repo *SqliteRepo) IterateBoards(fn func(Board) error) error {
+	query := `
+	  SELECT key, board, modified, signature, COALESCE(content_type, '')
+	  FROM boards
+	  WHERE quarantined = 0
+	  ORDER BY modified DESC
+	`
+	rows, err := repo.db.Query(query)
+	if err != nil {
+		return err
+	}
+	return iterateRows(rows, fn)
+}
 
-		err = rows.Scan(&key, &board, &modified)
-		if err != nil {
-			return nil, err
-		}
+// GetBoard implements BoardRepo
+func (repo *SqliteRepo) GetBoard(key string) (*Board, error) {
+	query := `
+		SELECT key, board, modified, signature, COALESCE(content_type, '')
+		FROM boards
+		WHERE key=? AND quarantined = 0
+	`
+	row := repo.db.QueryRow(query, key)
 
-		modifiedTime, err := time.Parse(time.RFC3339, modified)
-		if err != nil {
+	var dbkey, board, modified, signature, contentType string
+	err := row.Scan(&dbkey, &board, &modified, &signature, &contentType)
+	if err != nil {
+		if err != sql.ErrNoRows {
 			return nil, err
 		}
+		return nil, nil
+	}
 
-		boards = append(boards, Board{
-			Key:      key,
-			Board:    board,
-			Modified: modifiedTime,
-		})
+	modifiedTime, err := time.Parse(time.RFC3339, modified)
+	if err != nil {
+		return nil, err
 	}
 
+	return &Board{
+		Key:         key,
+		Board:       board,
+		Modified:    modifiedTime,
+		Signature:   signature,
+		ContentType: contentType,
+	}, nil
+}
+
+// GetBoards implements BoardRepo
+func (repo *SqliteRepo) GetBoards(keys []string) (map[string]Board, error) {
+	boards := map[string]Board{}
+	if len(keys) == 0 {
+		return boards, nil
+	}
+	placeholders := make([]string, len(keys))
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		placeholders[i] = "?"
+		args[i] = key
+	}
+	query := fmt.Sprintf(`
+		SELECT key, board, modified, signature, COALESCE(content_type, '')
+		FROM boards
+		WHERE key IN (%s) AND quarantined = 0
+	`, strings.Join(placeholders, ", "))
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	found, err := scanBoards(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, board := range found {
+		boards[board.Key] = board
+	}
 	return boards, nil
 }
 
-// GetBoard implements BoardRepo
-func (repo *SqliteRepo) GetBoard(key string) (*Board, error) {
+// GetBoardMeta implements BoardRepo
+func (repo *SqliteRepo) GetBoardMeta(key string) (*BoardMeta, error) {
 	query := `
-		SELECT key, board, modified, signature
+		SELECT modified, signature, COALESCE(content_type, ''), COALESCE(content_hash, '')
 		FROM boards
-		WHERE key=?
+		WHERE key=? AND quarantined = 0
 	`
 	row := repo.db.QueryRow(query, key)
 
-	var dbkey, board, modified, signature string
-	err := row.Scan(&dbkey, &board, &modified, &signature)
+	var modified, signature, contentType, contentHash string
+	err := row.Scan(&modified, &signature, &contentType, &contentHash)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return nil, err
@@ -119,42 +444,75 @@ func (repo *SqliteRepo) GetBoard(key string) (*Board, error) {
 		return nil, err
 	}
 
-	return &Board{
-		Key:       key,
-		Board:     board,
-		Modified:  modifiedTime,
-		Signature: signature,
+	return &BoardMeta{
+		Key:         key,
+		Modified:    modifiedTime,
+		Signature:   signature,
+		ContentType: contentType,
+		ContentHash: contentHash,
 	}, nil
 }
 
 // PublishBoard implements BoardRepo
 func (repo *SqliteRepo) PublishBoard(newBoard Board) error {
-	_, err := repo.db.Exec(`
-		INSERT INTO boards (key, board, modified, signature)
-		            values(?, ?, ?, ?)
+	// The tombstone check is part of the insert, rather than a query before
+	// it, so a transaction doesn't need to upgrade its read lock.
+	result, err := repo.db.Exec(`
+		INSERT INTO boards (key, board, modified, signature, content_type, content_hash)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (
+			SELECT 1
+			FROM tombstones
+			WHERE key = ? AND DATETIME(modified) >= DATETIME(?)
+		)
 		ON CONFLICT(key) DO UPDATE SET
 			    board=?,
 			    modified=?,
-			    signature=?
-		`, newBoard.Key, newBoard.Board, newBoard.ModifiedAtDBFormat(), newBoard.Signature,
-		newBoard.Board, newBoard.ModifiedAtDBFormat(), newBoard.Signature)
+			    signature=?,
+			    content_type=?,
+			    content_hash=?,
+			    last_verified=NULL,
+			    quarantined=0
+		WHERE DATETIME(boards.modified) < DATETIME(excluded.modified)
+		`, newBoard.Key, newBoard.Board, newBoard.ModifiedAtDBFormat(), newBoard.Signature, newBoard.ContentType, newBoard.ContentHash(),
+		newBoard.Key, newBoard.ModifiedAtDBFormat(),
+		newBoard.Board, newBoard.ModifiedAtDBFormat(), newBoard.Signature, newBoard.ContentType, newBoard.ContentHash())
 	if err != nil {
 		return errors.Wrap(err, "Could not save board")
-	} else {
-		return nil
 	}
+	return staleUnlessAffected(result)
+}
+
+// sqliteBusyTimeout is how long a connection waits for another one's lock
+// before failing with SQLITE_BUSY.
+const sqliteBusyTimeout = 5 * time.Second
+
+// sqliteDSN adds the pragmas every connection needs to a database path, which
+// may already have its own query parameters. WAL mode lets readers carry on
+// while a board is being written.
+func sqliteDSN(dbName string) (path string, dsn string) {
+	path = dbName
+	separator := "?"
+	if i := strings.Index(dbName, "?"); i >= 0 {
+		path = dbName[:i]
+		separator = "&"
+	}
+	dsn = fmt.Sprintf("%s%s_pragma=journal_mode(WAL)&_pragma=busy_timeout(%d)", dbName, separator, sqliteBusyTimeout.Milliseconds())
+	return
 }
 
 func newSqliteRepo(dbName string) *SqliteRepo {
+	path, dsn := sqliteDSN(dbName)
+	_, statErr := os.Stat(path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		panic(err)
+	}
+	repo := SqliteRepo{db: db, conn: db}
+
 	// if the db doesn't exist, create it
-	repo := SqliteRepo{}
-	if _, err := os.Stat(dbName); errors.Is(err, os.ErrNotExist) {
+	if errors.Is(statErr, os.ErrNotExist) {
 		log.Printf("initializing new database")
-		db, err := sql.Open("sqlite", dbName)
-		if err != nil {
-			panic(err)
-		}
-
 		initSQL := `
 		CREATE TABLE boards (
 			key text NOT NULL PRIMARY KEY,
@@ -169,13 +527,111 @@ func newSqliteRepo(dbName string) *SqliteRepo {
 		if err != nil {
 			log.Fatalf("%q: %s\n", err, initSQL)
 		}
-		repo.db = db
-	} else {
-		db, err := sql.Open("sqlite", dbName)
+	}
+
+	// tables added after the boards table are created on existing databases too
+	migrateSQL := `
+	CREATE TABLE IF NOT EXISTS board_views (
+		key text NOT NULL PRIMARY KEY,
+		views integer NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS propagation_log (
+		key text NOT NULL,
+		destination text NOT NULL,
+		outcome text NOT NULL,
+		attempts integer NOT NULL,
+		logged_at text NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS propagation_log_logged_at ON propagation_log(logged_at);
+	CREATE TABLE IF NOT EXISTS featured_boards (
+		key text NOT NULL PRIMARY KEY,
+		position integer NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS tombstones (
+		key text NOT NULL PRIMARY KEY,
+		modified text NOT NULL
+	);
+	`
+	_, err = repo.db.Exec(migrateSQL)
+	if err != nil {
+		log.Fatalf("%q: %s\n", err, migrateSQL)
+	}
+
+	if err = addMissingColumns(db); err != nil {
+		log.Fatalf("Could not migrate the boards table: %s", err)
+	}
+	if err = repo.backfillContentHashes(); err != nil {
+		log.Fatalf("Could not hash stored boards: %s", err)
+	}
+	return &repo
+}
+
+// sqliteAddedColumns are the columns added to the boards table after it was
+// first created, in the order they were added. New columns go at the end.
+var sqliteAddedColumns = []struct{ name, definition string }{
+	{"content_type", "text"},
+	{"content_hash", "text"},
+	{"last_verified", "text"},
+	{"quarantined", "integer NOT NULL DEFAULT 0"},
+}
+
+// addMissingColumns adds any of sqliteAddedColumns a database created by an
+// older springboard lacks.
+func addMissingColumns(db *sql.DB) error {
+	for _, column := range sqliteAddedColumns {
+		exists, err := hasColumn(db, "boards", column.name)
 		if err != nil {
-			panic(err)
+			return errors.Wrap(err, "Could not read the boards table's columns")
+		}
+		if !exists {
+			if _, err = db.Exec(fmt.Sprintf(`ALTER TABLE boards ADD COLUMN %s %s`, column.name, column.definition)); err != nil {
+				return errors.Wrapf(err, "Could not add the %s column", column.name)
+			}
 		}
-		repo.db = db
 	}
-	return &repo
+	return nil
+}
+
+// backfillContentHashes stores the content hash of boards published before
+// the content_hash column existed. SQLite has no SHA-256 function, so
+// they're hashed here.
+func (repo *SqliteRepo) backfillContentHashes() error {
+	rows, err := repo.db.Query(`
+		SELECT key, board, modified, signature, COALESCE(content_type, '')
+		FROM boards
+		WHERE content_hash IS NULL AND board IS NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+	boards, err := scanBoards(rows)
+	if err != nil {
+		return err
+	}
+	for _, board := range boards {
+		_, err = repo.db.Exec(`UPDATE boards SET content_hash=? WHERE key=?`, board.ContentHash(), board.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasColumn reports whether an sqlite table has a column.
+func hasColumn(db *sql.DB, table string, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
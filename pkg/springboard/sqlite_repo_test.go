@@ -0,0 +1,43 @@
+package springboard
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSqliteRepoUsesWAL(t *testing.T) {
+	dbName := filepath.Join(t.TempDir(), "springboard.db")
+	assertPragmas := func(t *testing.T, repo *SqliteRepo) {
+		t.Helper()
+		var journalMode string
+		if err := repo.conn.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode); err != nil {
+			t.Fatal(err)
+		}
+		if journalMode != "wal" {
+			t.Errorf("journal_mode is %q, want wal", journalMode)
+		}
+		var busyTimeout int64
+		if err := repo.conn.QueryRow(`PRAGMA busy_timeout`).Scan(&busyTimeout); err != nil {
+			t.Fatal(err)
+		}
+		if busyTimeout != sqliteBusyTimeout.Milliseconds() {
+			t.Errorf("busy_timeout is %d, want %d", busyTimeout, sqliteBusyTimeout.Milliseconds())
+		}
+	}
+
+	t.Run("new database", func(t *testing.T) {
+		repo := newSqliteRepo(dbName)
+		defer repo.conn.Close()
+		assertPragmas(t, repo)
+	})
+	t.Run("existing database", func(t *testing.T) {
+		repo := newSqliteRepo(dbName)
+		defer repo.conn.Close()
+		assertPragmas(t, repo)
+	})
+	t.Run("path with its own parameters", func(t *testing.T) {
+		repo := newSqliteRepo(filepath.Join(t.TempDir(), "params.db") + "?_pragma=foreign_keys(1)")
+		defer repo.conn.Close()
+		assertPragmas(t, repo)
+	})
+}
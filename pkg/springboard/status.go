@@ -0,0 +1,194 @@
+package springboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statusCacheDuration is how long /status responses are reused, since
+// computing them reads every board.
+const statusCacheDuration = 30 * time.Second
+
+// sizeBucketWidth is the width, in bytes, of the buckets in the board size
+// histogram. The last bucket ends at MaxBoardSize.
+const sizeBucketWidth = 256
+
+type sizeBucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Count int `json:"count"`
+}
+
+type serverStatus struct {
+	BoardCount       int          `json:"boardCount"`
+	DifficultyFactor float64      `json:"difficultyFactor"`
+	AverageSize      float64      `json:"averageSize"`
+	SizeHistogram    []sizeBucket `json:"sizeHistogram"`
+	// VerifiedBoards counts boards whose signatures have been checked
+	// again since they were stored, and QuarantinedBoards those that
+	// failed and aren't served.
+	VerifiedBoards    int `json:"verifiedBoards"`
+	QuarantinedBoards int `json:"quarantinedBoards"`
+	// DifficultyRejections counts new keys rejected since the server
+	// started because they exceeded the difficulty threshold. It's never
+	// cached.
+	DifficultyRejections int64 `json:"difficultyRejections"`
+}
+
+type statusCache struct {
+	mutex      sync.Mutex
+	computedAt time.Time
+	status     *serverStatus
+}
+
+// sizeHistogram buckets boards by the size of their bodies as they're added,
+// and tracks their average size.
+type sizeHistogram struct {
+	buckets []sizeBucket
+	count   int
+	total   int
+}
+
+func newSizeHistogram() *sizeHistogram {
+	histogram := &sizeHistogram{}
+	for min := 0; min < MaxBoardSize; min += sizeBucketWidth {
+		max := min + sizeBucketWidth
+		if max > MaxBoardSize {
+			max = MaxBoardSize
+		}
+		histogram.buckets = append(histogram.buckets, sizeBucket{Min: min, Max: max})
+	}
+	return histogram
+}
+
+func (histogram *sizeHistogram) Add(board Board) {
+	size := len(board.Board)
+	histogram.count++
+	histogram.total += size
+	bucket := size / sizeBucketWidth
+	if bucket >= len(histogram.buckets) {
+		bucket = len(histogram.buckets) - 1
+	}
+	histogram.buckets[bucket].Count++
+}
+
+func (histogram *sizeHistogram) Average() float64 {
+	if histogram.count == 0 {
+		return 0
+	}
+	return float64(histogram.total) / float64(histogram.count)
+}
+
+func (s *Spring83Server) computeStatus() (status serverStatus, err error) {
+	histogram := newSizeHistogram()
+	err = s.repo.IterateBoards(func(board Board) error {
+		histogram.Add(board)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	status.BoardCount = histogram.count
+	status.DifficultyFactor, _, err = s.getDifficulty()
+	if err != nil {
+		return
+	}
+	status.SizeHistogram, status.AverageSize = histogram.buckets, histogram.Average()
+	status.VerifiedBoards, status.QuarantinedBoards, err = s.repo.GetVerificationCounts()
+	return
+}
+
+// showStatus reports statistics about the boards on this server as JSON.
+func (s *Spring83Server) showStatus(w http.ResponseWriter, r *http.Request) {
+	s.statusCache.mutex.Lock()
+	defer s.statusCache.mutex.Unlock()
+
+	if s.statusCache.status == nil || time.Since(s.statusCache.computedAt) > statusCacheDuration {
+		status, err := s.computeStatus()
+		if err != nil {
+			log.Printf("Error in showStatus: %s", err)
+			http.Error(w, "Unable to compute status", http.StatusInternalServerError)
+			return
+		}
+		s.statusCache.status = &status
+		s.statusCache.computedAt = time.Now()
+	}
+
+	status := *s.statusCache.status
+	status.DifficultyRejections = atomic.LoadInt64(&s.difficultyRejections)
+	response, err := json.Marshal(status)
+	if err != nil {
+		log.Printf("Error in showStatus: %s", err)
+		http.Error(w, "Unable to compute status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// DefaultPropagationBacklogDepth is how many queued or in-flight relays make
+// /readyz report the server as degraded when no depth is configured.
+const DefaultPropagationBacklogDepth = 500
+
+// DefaultPropagationBacklogAge is how long a relay can be queued before
+// /readyz reports the server as degraded when no age is configured.
+const DefaultPropagationBacklogAge = time.Hour
+
+type readiness struct {
+	// Status is "ok", "degraded" if boards aren't being relayed to
+	// federates, or "unavailable" if the database can't be read.
+	Status                string     `json:"status"`
+	Problems              []string   `json:"problems,omitempty"`
+	PropagationQueueDepth int        `json:"propagationQueueDepth"`
+	OldestQueuedRelay     *time.Time `json:"oldestQueuedRelay,omitempty"`
+}
+
+// checkReadiness reports whether the server can serve boards and whether
+// relays to federates are backing up.
+func (s *Spring83Server) checkReadiness(now time.Time) (ready readiness) {
+	ready.Status = "ok"
+	depth, oldest := s.propagationTracker.Backlog()
+	ready.PropagationQueueDepth = depth
+	if !oldest.IsZero() {
+		ready.OldestQueuedRelay = &oldest
+	}
+	if depth > s.propagationBacklogDepth {
+		ready.Status = "degraded"
+		ready.Problems = append(ready.Problems, fmt.Sprintf("%d relays are queued or in flight, more than %d", depth, s.propagationBacklogDepth))
+	}
+	if !oldest.IsZero() && now.Sub(oldest) > s.propagationBacklogAge {
+		ready.Status = "degraded"
+		ready.Problems = append(ready.Problems, fmt.Sprintf("A relay has been queued since %s, longer than %s", oldest.UTC().Format(time.RFC3339), s.propagationBacklogAge))
+	}
+	if _, err := s.repo.BoardCount(); err != nil {
+		log.Printf("Error in checkReadiness: %s", err)
+		ready.Status = "unavailable"
+		ready.Problems = append(ready.Problems, "Could not read the database")
+	}
+	return
+}
+
+// showReadiness reports whether the server is ready as JSON. It responds 503
+// Service Unavailable if the database can't be read, so load balancers stop
+// sending it requests. A propagation backlog doesn't stop the server from
+// serving boards, so it's only reported as "degraded", for monitoring to
+// alert on.
+func (s *Spring83Server) showReadiness(w http.ResponseWriter, r *http.Request) {
+	ready := s.checkReadiness(time.Now())
+	response, err := json.Marshal(ready)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if ready.Status == "unavailable" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(response)
+}
@@ -0,0 +1,123 @@
+package springboard
+
+import (
+	"container/heap"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getStatus fetches and decodes the server's /status.
+func getStatus(t *testing.T, server *Spring83Server) serverStatus {
+	t.Helper()
+	w := serve(server, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status serverStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Status didn't parse (%d %q): %s", w.Code, w.Body.String(), err)
+	}
+	return status
+}
+
+func TestStatusSizeHistogramCountsEveryBoard(t *testing.T) {
+	server := newTestServer(t, ServerConfig{})
+	total := 0
+	for i, size := range []int{0, 100, 300, 300, 1500, MaxContentSize} {
+		board := testBoard(testKey(i+1), time.Now(), strings.Repeat("x", size))
+		mustPublish(t, server.repo, board)
+		total += len(board.Board)
+	}
+
+	status := getStatus(t, server)
+	if status.BoardCount != 6 {
+		t.Errorf("Status counts %d boards, want 6", status.BoardCount)
+	}
+	sum := 0
+	for _, bucket := range status.SizeHistogram {
+		sum += bucket.Count
+	}
+	if sum != status.BoardCount {
+		t.Errorf("Histogram buckets sum to %d, want the board count %d", sum, status.BoardCount)
+	}
+	if last := status.SizeHistogram[len(status.SizeHistogram)-1]; last.Max != MaxBoardSize || last.Count != 1 {
+		t.Errorf("Last bucket is %+v, want one board up to %d bytes", last, MaxBoardSize)
+	}
+	if want := float64(total) / 6; status.AverageSize != want {
+		t.Errorf("Average size is %f, want %f", status.AverageSize, want)
+	}
+}
+
+func TestStatusCountsDifficultyRejections(t *testing.T) {
+	repo := crowdedRepo{BoardRepo: newTestSqliteRepo(t), count: 5_000_000}
+	server := newTestServerWithRepo(repo, ServerConfig{})
+	highKey := "f8" + testKey(1)[2:]
+
+	if w := put(server, testBoard(highKey, time.Now(), "too hard")); w.Code != http.StatusForbidden {
+		t.Fatalf("High key got %d, want 403", w.Code)
+	}
+	if w := put(server, testBoard(testKeyExpiring(2, time.Now().AddDate(0, -2, 0)), time.Now(), "expired")); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expired key got %d, want 400", w.Code)
+	}
+	if rejections := getStatus(t, server).DifficultyRejections; rejections != 1 {
+		t.Errorf("Status counts %d difficulty rejections, want 1", rejections)
+	}
+
+	// The count isn't cached with the rest of the status.
+	put(server, testBoard(highKey, time.Now(), "still too hard"))
+	if rejections := getStatus(t, server).DifficultyRejections; rejections != 2 {
+		t.Errorf("Status counts %d difficulty rejections, want 2", rejections)
+	}
+}
+
+// backUpRelays queues relays of n boards directly, as if their federates were
+// down, without starting the queue's background thread.
+func backUpRelays(server *Spring83Server, n int, queuedAt time.Time) {
+	tracker := server.propagationTracker
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	for i := 1; i <= n; i++ {
+		heap.Push(tracker.queue, &relayInformation{
+			board:         testBoard(testKey(i), queuedAt, "hello"),
+			destination:   "https://down.example",
+			queuedAt:      queuedAt,
+			firstQueuedAt: queuedAt,
+			nextAttempt:   queuedAt.Add(time.Hour),
+		})
+	}
+}
+
+func TestReadinessDegradesWhenRelaysBackUp(t *testing.T) {
+	now := time.Now()
+	readyStatus := func(server *Spring83Server) readiness {
+		t.Helper()
+		w := serve(server, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var ready readiness
+		if err := json.Unmarshal(w.Body.Bytes(), &ready); err != nil {
+			t.Fatalf("/readyz didn't parse (%d %q): %s", w.Code, w.Body.String(), err)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("/readyz got %d, want 200 even when degraded", w.Code)
+		}
+		return ready
+	}
+
+	server := newTestServer(t, ServerConfig{PropagationBacklogDepth: 3, PropagationBacklogAge: time.Hour})
+	backUpRelays(server, 3, now)
+	if ready := readyStatus(server); ready.Status != "ok" || ready.PropagationQueueDepth != 3 {
+		t.Errorf("With 3 relays queued, readiness is %+v, want ok", ready)
+	}
+
+	deep := newTestServer(t, ServerConfig{PropagationBacklogDepth: 3, PropagationBacklogAge: time.Hour})
+	backUpRelays(deep, 4, now)
+	if ready := readyStatus(deep); ready.Status != "degraded" || len(ready.Problems) != 1 {
+		t.Errorf("With 4 relays queued, readiness is %+v, want degraded", ready)
+	}
+
+	old := newTestServer(t, ServerConfig{PropagationBacklogDepth: 3, PropagationBacklogAge: time.Hour})
+	backUpRelays(old, 1, now.Add(-2*time.Hour))
+	if ready := readyStatus(old); ready.Status != "degraded" || ready.OldestQueuedRelay == nil {
+		t.Errorf("With a relay queued 2 hours ago, readiness is %+v, want degraded", ready)
+	}
+}
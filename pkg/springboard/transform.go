@@ -0,0 +1,138 @@
+package springboard
+
+import (
+	"regexp"
+	"strings"
+)
+
+// BoardTransformer rewrites a board's body when it's displayed in a browser,
+// e.g. to render a board written in another format as HTML. It never changes
+// what's stored, propagated, or served raw, so signatures stay valid.
+type BoardTransformer interface {
+	Transform(board Board) (body string, err error)
+}
+
+// PassthroughTransformer displays boards exactly as they were published.
+type PassthroughTransformer struct{}
+
+func (PassthroughTransformer) Transform(board Board) (string, error) {
+	return board.Board, nil
+}
+
+var formatHintRegExp = regexp.MustCompile(`(?i)<meta\s+name\s*=\s*"spring83-format"\s+content\s*=\s*"([^"]*)"\s*/?>`)
+
+// BoardFormat returns the format an author declared for their board with a
+// <meta name="spring83-format" content="..."> tag, lowercased, or "html" if
+// there's no such tag. Transformers use it to decide which boards to rewrite.
+func BoardFormat(board Board) string {
+	match := formatHintRegExp.FindStringSubmatch(board.Board)
+	if match == nil {
+		return "html"
+	}
+	return strings.ToLower(strings.TrimSpace(match[1]))
+}
+
+// MinifyingTransformer minifies the HTML of boards displayed in a browser,
+// after Next has transformed them, to serve fewer bytes. Like any
+// transformer, it never touches the stored, signed board.
+type MinifyingTransformer struct {
+	Next BoardTransformer
+}
+
+func (transformer MinifyingTransformer) Transform(board Board) (string, error) {
+	body, err := transformer.Next.Transform(board)
+	if err != nil {
+		return "", err
+	}
+	return minifyHTML(body), nil
+}
+
+// rawTextElements are the elements whose content minifyHTML copies as is,
+// since whitespace in them is significant or isn't HTML.
+var rawTextElements = map[string]bool{"pre": true, "textarea": true, "script": true, "style": true}
+
+// minifyHTML removes comments and collapses runs of whitespace between tags
+// to a single space, which browsers render the same. Tags, including their
+// attribute values, and the content of rawTextElements are left as they
+// are.
+func minifyHTML(body string) string {
+	var out strings.Builder
+	out.Grow(len(body))
+	// spaced is whether the last byte written was a collapsed space, so
+	// whitespace on both sides of a removed comment becomes one space.
+	spaced := false
+	for i := 0; i < len(body); {
+		switch {
+		case strings.HasPrefix(body[i:], "<!--"):
+			end := strings.Index(body[i+4:], "-->")
+			if end < 0 {
+				return strings.TrimSpace(out.String())
+			}
+			i += 4 + end + 3
+		case body[i] == '<' && i+1 < len(body) && (isASCIILetter(body[i+1]) || body[i+1] == '/' || body[i+1] == '!'):
+			tagEnd := endOfTag(body, i)
+			tag := body[i:tagEnd]
+			out.WriteString(tag)
+			spaced = false
+			i = tagEnd
+			if name := tagName(tag); rawTextElements[name] {
+				closing := strings.Index(strings.ToLower(body[i:]), "</"+name)
+				if closing < 0 {
+					closing = len(body) - i
+				}
+				out.WriteString(body[i : i+closing])
+				i += closing
+			}
+		case isHTMLSpace(body[i]):
+			for i < len(body) && isHTMLSpace(body[i]) {
+				i++
+			}
+			if !spaced {
+				out.WriteByte(' ')
+				spaced = true
+			}
+		default:
+			out.WriteByte(body[i])
+			spaced = false
+			i++
+		}
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// endOfTag returns the index just past the > closing the tag starting at
+// start, skipping any > in quoted attribute values.
+func endOfTag(body string, start int) int {
+	var quote byte
+	for i := start + 1; i < len(body); i++ {
+		switch {
+		case quote != 0:
+			if body[i] == quote {
+				quote = 0
+			}
+		case body[i] == '"' || body[i] == '\'':
+			quote = body[i]
+		case body[i] == '>':
+			return i + 1
+		}
+	}
+	return len(body)
+}
+
+// tagName returns the lowercased name of an opening tag, or "" for closing
+// tags, comments, and doctypes.
+func tagName(tag string) string {
+	end := 1
+	for end < len(tag) && isASCIILetter(tag[end]) {
+		end++
+	}
+	return strings.ToLower(tag[1:end])
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,98 @@
+package springboard
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shoutingTransformer upper-cases boards that declare the "shout" format.
+type shoutingTransformer struct{}
+
+func (shoutingTransformer) Transform(board Board) (string, error) {
+	if BoardFormat(board) != "shout" {
+		return board.Board, nil
+	}
+	return strings.ToUpper(board.Board), nil
+}
+
+func TestTransformerOnlyChangesBrowserDisplay(t *testing.T) {
+	server := newTestServer(t, ServerConfig{BoardTransformer: shoutingTransformer{}})
+	board := testBoard(testKey(1), time.Now(), `<meta name="spring83-format" content="Shout"><p>hello</p>`)
+	plain := testBoard(testKey(2), time.Now(), `<p>hello</p>`)
+	mustPublish(t, server.repo, board)
+	mustPublish(t, server.repo, plain)
+
+	browser := httptest.NewRequest(http.MethodGet, "/"+board.Key, nil)
+	browser.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := serve(server, browser)
+	if w.Body.String() != strings.ToUpper(board.Board) {
+		t.Errorf("Browser got %q, want the transformed board", w.Body.String())
+	}
+	if w.Header().Get("Spring-Signature") != "" {
+		t.Errorf("Transformed board was served with the stored board's signature")
+	}
+
+	for _, program := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/"+board.Key, nil),
+		httptest.NewRequest(http.MethodGet, "/"+board.Key+"?raw=1", nil),
+	} {
+		w := serve(server, program)
+		if w.Body.String() != board.Board || w.Header().Get("Spring-Signature") != board.Signature {
+			t.Errorf("GET %s without a browser's headers got %q, want the stored, signed board", program.URL, w.Body.String())
+		}
+	}
+
+	plainRequest := httptest.NewRequest(http.MethodGet, "/"+plain.Key, nil)
+	plainRequest.Header.Set("Sec-Fetch-Dest", "iframe")
+	if w := serve(server, plainRequest); w.Body.String() != plain.Board || w.Header().Get("Spring-Signature") != plain.Signature {
+		t.Errorf("Untransformed board lost its signature in an iframe")
+	}
+
+	if stored, _ := server.repo.GetBoard(board.Key); stored == nil || stored.Board != board.Board {
+		t.Errorf("Displaying the board changed what's stored")
+	}
+}
+
+func TestMinifiedDisplayLeavesStoredBoardUntouched(t *testing.T) {
+	server := newTestServer(t, ServerConfig{MinifyBoards: true})
+	board := testBoard(testKey(1), time.Now(), "\n<!-- a note -->\n<div>\n    <p>hello</p>\n\n</div>\n")
+	if w := put(server, board); w.Code != http.StatusOK {
+		t.Fatalf("PUT got %d: %s", w.Code, w.Body.String())
+	}
+
+	displayed := serve(server, httptest.NewRequest(http.MethodGet, "/"+board.Key+"?embed=1", nil))
+	if body := displayed.Body.String(); body == board.Board || len(body) >= len(board.Board) || strings.Contains(body, "a note") {
+		t.Errorf("Board displayed in a browser wasn't minified: %q", body)
+	}
+	if displayed.Header().Get("Spring-Signature") != "" {
+		t.Errorf("Minified board was served with the signature of the stored bytes")
+	}
+
+	raw := httptest.NewRequest(http.MethodGet, "/"+board.Key, nil)
+	raw.Header.Set("Accept", "application/spring-83")
+	for name, r := range map[string]*http.Request{
+		"raw":     raw,
+		"program": httptest.NewRequest(http.MethodGet, "/"+board.Key, nil),
+	} {
+		w := serve(server, r)
+		if w.Body.String() != board.Board || w.Header().Get("Spring-Signature") != board.Signature {
+			t.Errorf("%s request got %q signed %q, want the signed bytes", name, w.Body.String(), w.Header().Get("Spring-Signature"))
+		}
+	}
+
+	stored, err := server.repo.GetBoard(board.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Board != board.Board {
+		t.Errorf("Stored board is %q, want the bytes that were signed", stored.Board)
+	}
+	signature, _ := hex.DecodeString(stored.Signature)
+	if err := server.verifier.Verify(stored.Key, stored.Bytes(), signature); err != nil {
+		t.Errorf("Stored board's signature no longer verifies: %s", err)
+	}
+}
@@ -0,0 +1,45 @@
+package springboard
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// dbtx is what the repos need to run queries, satisfied by both *sql.DB and
+// *sql.Tx, so the same repo code runs inside or outside a transaction.
+type dbtx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// inTx runs fn in a transaction on db, committing if it returns nil and
+// rolling back otherwise.
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "Could not begin transaction")
+	}
+	if err = fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Wrapf(err, "rollback also failed: %s", rollbackErr)
+		}
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "Could not commit transaction")
+	}
+	return nil
+}
+
+// atomically runs fn in a transaction on conn, or straight on db if conn is
+// nil because db is already a transaction.
+func atomically(conn *sql.DB, db dbtx, fn func(db dbtx) error) error {
+	if conn == nil {
+		return fn(db)
+	}
+	return inTx(conn, func(tx *sql.Tx) error {
+		return fn(tx)
+	})
+}
@@ -0,0 +1,314 @@
+package springboard
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// MaxBoardSize is the largest board body, in bytes, that may be published.
+// It applies to the bytes that are signed, sent, and stored, which include
+// the board's <time> tag, so authors have MaxContentSize bytes for the rest.
+const MaxBoardSize = 2217
+
+// DefaultMaxExpiryHorizon is how far in the future a key may expire, per the
+// spec: two years, which keyValidFrom counts in calendar years.
+const DefaultMaxExpiryHorizon = 2 * 365 * 24 * time.Hour
+
+// MaxContentSize is the most an author can write in a board: MaxBoardSize
+// less the <time> tag clients add to it.
+const MaxContentSize = MaxBoardSize - len(`<time datetime="YYYY-MM-DDTHH:MM:SSZ"></time>`)
+
+// TestPublicKey is the public key of the test keypair published in the
+// Spring '83 spec. Its private key is public too, so servers must refuse its
+// boards with 401 Unauthorized.
+const TestPublicKey = "ab589f4dde9fce4180fcf42c7b05185b0a02a5d682e353fa39177995083e0583"
+
+// timeTagRegExp matches a <time> tag with an RFC 3339 datetime. Fractional
+// seconds and numeric offsets are matched so that they can be parsed, but
+// validateBoardBody only accepts times in UTC.
+var timeTagRegExp = regexp.MustCompile(`(?i)<\s*time\s+datetime\s*=\s*"(\d\d\d\d-\d\d-\d\dT\d\d:\d\d:\d\d(?:\.\d+)?(?:Z|[+-]\d\d:\d\d))"\s*\/?\s*>`)
+
+// ValidationError describes why a board was rejected. Kind is one of the Err*
+// values so callers can branch with errors.Is, and Message is suitable for
+// showing to the board's author.
+type ValidationError struct {
+	Kind    error
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Kind
+}
+
+func invalid(kind error, format string, args ...any) error {
+	return &ValidationError{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// validationStatus is the HTTP status a server responds with for a
+// validation error.
+func validationStatus(err error) int {
+	if errors.Is(err, ErrTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	if errors.Is(err, ErrUnsupportedMediaType) {
+		return http.StatusUnsupportedMediaType
+	}
+	if errors.Is(err, ErrKeyDenied) {
+		return http.StatusUnauthorized
+	}
+	if errors.Is(err, ErrDifficulty) || errors.Is(err, ErrForbidden) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// ValidateBoard runs every check on a board that doesn't need the network:
+// the key's format and expiry, the body's size and encoding, its <time> tag,
+// and finally the signature. The cryptographic check is done last, as the spec
+// requires.
+func ValidateBoard(key string, body []byte, signature []byte, now time.Time) error {
+	for _, check := range boardChecks(key, body, signature, now) {
+		if err := check.run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckResult is the outcome of one of ValidateBoard's checks: "key",
+// "board", or "signature". Err is nil if it passed.
+type CheckResult struct {
+	Check string
+	Err   error
+}
+
+// CheckBoard runs each of ValidateBoard's checks and reports every outcome,
+// instead of stopping at the first failure.
+func CheckBoard(key string, body []byte, signature []byte, now time.Time) []CheckResult {
+	results := []CheckResult{}
+	for _, check := range boardChecks(key, body, signature, now) {
+		results = append(results, CheckResult{Check: check.name, Err: check.run()})
+	}
+	return results
+}
+
+type boardCheck struct {
+	name string
+	run  func() error
+}
+
+// boardChecks are the checks ValidateBoard runs, in order.
+func boardChecks(key string, body []byte, signature []byte, now time.Time) []boardCheck {
+	return []boardCheck{
+		{"key", func() error { return validateKey(key, now) }},
+		{"board", func() error {
+			_, err := validateBoardBody(body, now)
+			return err
+		}},
+		{"signature", func() error { return verifyBoardSignature(key, body, signature) }},
+	}
+}
+
+// validateKey checks that a hex-encoded key is well formed and within its
+// validity window. Keys end in 83eMMYY and must not have expired (they remain
+// valid until the first day of the month after MMYY, like a credit card) nor
+// expire more than two years from now.
+func validateKey(key string, now time.Time) error {
+	return validateKeyWithin(key, now, DefaultMaxExpiryHorizon)
+}
+
+// validateKeyWithin is validateKey with a different limit on how far in the
+// future keys may expire. A key is accepted from keyValidFrom until
+// parseKeyExpiry.
+func validateKeyWithin(key string, now time.Time, horizon time.Duration) error {
+	if decoded, err := hex.DecodeString(key); err != nil || len(decoded) != ed25519.PublicKeySize {
+		return invalid(ErrInvalidKey, "Invalid key")
+	}
+	expiresAt, err := parseKeyExpiry(key)
+	if err != nil {
+		return invalid(ErrInvalidKey, "Signature must end with 83eMMYY. You might be using an old key format. Delete your old key, update your client, and try again.")
+	}
+	if now.After(expiresAt) {
+		return invalid(ErrKeyExpired, "Key has expired")
+	}
+	if validFrom := keyValidFrom(expiresAt, horizon); now.Before(validFrom) {
+		limit := horizon.String()
+		if horizon == DefaultMaxExpiryHorizon {
+			limit = "two years"
+		}
+		return invalid(ErrInvalidKey, fmt.Sprintf("Key is set to expire more than %s in the future; it's accepted from %s", limit, validFrom.Format("2006-01-02")))
+	}
+	return nil
+}
+
+// keyValidFrom returns the moment a key that stops being valid at expiresAt
+// starts being accepted: horizon before the first day of its MMYY month. The
+// default horizon is counted in calendar years, so a key becomes valid on the
+// first day of its expiry month two years earlier, leap days or not.
+func keyValidFrom(expiresAt time.Time, horizon time.Duration) time.Time {
+	expiryMonth := expiresAt.AddDate(0, -1, 0)
+	if horizon == DefaultMaxExpiryHorizon {
+		return expiryMonth.AddDate(-2, 0, 0)
+	}
+	return expiryMonth.Add(-horizon)
+}
+
+// parseKeyExpiry returns the moment a key stops being valid: the first day of
+// the month following the MMYY in its 83eMMYY suffix.
+func parseKeyExpiry(key string) (expiresAt time.Time, err error) {
+	if len(key) != 64 || key[57:60] != "83e" {
+		err = fmt.Errorf("key %s does not end with 83eMMYY", key)
+		return
+	}
+	expiry, err := time.Parse("0106", key[60:64])
+	if err != nil {
+		return
+	}
+	expiresAt = expiry.AddDate(0, 1, 0)
+	return
+}
+
+// keyExpiresBetween reports whether a key's expiry falls between from and
+// to. Keys without a valid expiry never do.
+func keyExpiresBetween(key string, from time.Time, to time.Time) bool {
+	expiresAt, err := parseKeyExpiry(key)
+	return err == nil && !expiresAt.Before(from) && !expiresAt.After(to)
+}
+
+// parseExpiryWindow parses a window like "30d" (a number of days) or any
+// duration time.ParseDuration accepts. The window can't be negative.
+func parseExpiryWindow(window string) (duration time.Duration, err error) {
+	if days := strings.TrimSuffix(window, "d"); days != window {
+		var count int
+		count, err = strconv.Atoi(days)
+		duration = time.Duration(count) * 24 * time.Hour
+	} else {
+		duration, err = time.ParseDuration(window)
+	}
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("Invalid expiry window %q: use a number of days like 30d or a duration like 72h", window)
+	}
+	return
+}
+
+// keyExpired reports whether a key has passed its 83eMMYY expiry. Keys
+// without a valid expiry are treated as expired.
+func keyExpired(key string, now time.Time) bool {
+	expiresAt, err := parseKeyExpiry(key)
+	return err != nil || now.After(expiresAt)
+}
+
+// validateBoardBody checks a board's size, encoding, and <time> tag, and
+// returns the time from the tag. Besides the canonical YYYY-MM-DDTHH:MM:SSZ,
+// the tag may have fractional seconds or a +00:00 offset; the returned time is
+// normalized to whole seconds in UTC.
+func validateBoardBody(body []byte, now time.Time) (modified time.Time, err error) {
+	if len(body) > MaxBoardSize {
+		err = invalid(ErrTooLarge, "Board is larger than %d bytes, including its time tag", MaxBoardSize)
+		return
+	}
+	if !utf8.Valid(body) {
+		err = invalid(ErrBadRequest, "Board must be valid UTF-8")
+		return
+	}
+
+	modified, err = parseTimeTag(body)
+	if err != nil {
+		return
+	}
+	if modified.After(now) {
+		err = invalid(ErrInvalidTimeTag, "Board's <time> tag is in the future")
+		return
+	}
+	return
+}
+
+// parseTimeTag returns the time in a board's <time> tag, which must appear
+// exactly once. Boards with several are rejected rather than picking one, so
+// content appended after a board's tag can't change how fresh it looks to
+// servers that would pick differently.
+func parseTimeTag(body []byte) (modified time.Time, err error) {
+	submatches := timeTagRegExp.FindAllSubmatch(body, -1)
+	if submatches == nil {
+		err = invalid(ErrInvalidTimeTag, `Missing <time datetime="YYYY-MM-DDTHH:MM:SSZ"> tag`)
+		return
+	}
+	if len(submatches) > 1 {
+		err = invalid(ErrInvalidTimeTag, `Board must contain exactly one <time datetime="YYYY-MM-DDTHH:MM:SSZ"> tag`)
+		return
+	}
+	maybeDate := string(submatches[0][1])
+	modified, err = time.Parse(time.RFC3339Nano, maybeDate)
+	if err != nil {
+		err = invalid(ErrInvalidTimeTag, "Could not parse date %s", maybeDate)
+		return
+	}
+	if _, offset := modified.Zone(); offset != 0 {
+		err = invalid(ErrInvalidTimeTag, "Date %s must be in UTC", maybeDate)
+		return
+	}
+	modified = modified.UTC().Truncate(time.Second)
+	return
+}
+
+// validateContentType checks that a submitted board's Content-Type, if it
+// has one, is text/html, and returns it to be stored with the board.
+func validateContentType(contentType string) (string, error) {
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "" {
+		return "", nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "text/html" {
+		return "", invalid(ErrUnsupportedMediaType, "Boards must be text/html, not %q", contentType)
+	}
+	return contentType, nil
+}
+
+// timeTag returns the <time> tag that marks when a board was modified. The
+// time is always written in UTC with a literal Z, whatever modified's zone.
+func timeTag(modified time.Time) []byte {
+	return []byte(fmt.Sprintf(`<time datetime="%s"></time>`, modified.UTC().Format("2006-01-02T15:04:05Z")))
+}
+
+// Tombstone returns the body of a tombstone: a board containing nothing but a
+// <time> tag. Once signed, a tombstone newer than a key's board tells servers
+// to delete that board.
+func Tombstone(modified time.Time) []byte {
+	return timeTag(modified)
+}
+
+// validateTombstone checks that body is a tombstone and returns its time.
+func validateTombstone(body []byte, now time.Time) (modified time.Time, err error) {
+	modified, err = validateBoardBody(body, now)
+	if err != nil {
+		return
+	}
+	if !isTagOnly(body) {
+		err = invalid(ErrBadRequest, "A tombstone must contain nothing but a <time> tag")
+	}
+	return
+}
+
+// isTagOnly reports whether body has nothing but its <time> tag and
+// whitespace.
+func isTagOnly(body []byte) bool {
+	rest := timeTagRegExp.ReplaceAll(body, nil)
+	rest = bytes.Replace(bytes.ToLower(rest), []byte("</time>"), nil, 1)
+	return len(bytes.TrimSpace(rest)) == 0
+}
@@ -0,0 +1,177 @@
+package springboard
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheckBoard(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A real key can't be ground with a valid suffix in a test, so the
+	// signature check uses one without, and the key check fake keys.
+	signedKey := hex.EncodeToString(pubkey)
+	validKey := testKeyExpiring(1, time.Date(2027, 12, 1, 0, 0, 0, 0, time.UTC))
+	body := string(timeTag(now.Add(-time.Hour))) + "<p>hello</p>"
+	signature := ed25519.Sign(privkey, []byte(body))
+
+	tests := []struct {
+		name      string
+		key       string
+		body      string
+		signature []byte
+		// want is the error kind each of the key, board, and signature
+		// checks fails with, or nil if it passes.
+		want [3]error
+	}{
+		{"signed board", signedKey, body, signature, [3]error{ErrInvalidKey, nil, nil}},
+		{"valid key", validKey, body, signature, [3]error{nil, nil, ErrInvalidSignature}},
+		{"not hex", strings.Repeat("z", 57) + "83e1227", body, signature, [3]error{ErrInvalidKey, nil, ErrInvalidKey}},
+		{"short key", "83e1227", body, signature, [3]error{ErrInvalidKey, nil, ErrInvalidKey}},
+		{"expired key", testKeyExpiring(1, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)), body, signature, [3]error{ErrKeyExpired, nil, ErrInvalidSignature}},
+		{"key expiring this month", testKeyExpiring(1, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)), body, signature, [3]error{nil, nil, ErrInvalidSignature}},
+		{"key too far ahead", testKeyExpiring(1, time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)), body, signature, [3]error{ErrInvalidKey, nil, ErrInvalidSignature}},
+		{"bad month", strings.Repeat("0", 57) + "83e1327", body, signature, [3]error{ErrInvalidKey, nil, ErrInvalidSignature}},
+		{"too large", signedKey, body + strings.Repeat("a", MaxBoardSize), signature, [3]error{ErrInvalidKey, ErrTooLarge, ErrInvalidSignature}},
+		{"not UTF-8", signedKey, body + "\xff", signature, [3]error{ErrInvalidKey, ErrBadRequest, ErrInvalidSignature}},
+		{"no time tag", signedKey, "<p>hello</p>", signature, [3]error{ErrInvalidKey, ErrInvalidTimeTag, ErrInvalidSignature}},
+		{"two time tags", signedKey, body + string(timeTag(now)), signature, [3]error{ErrInvalidKey, ErrInvalidTimeTag, ErrInvalidSignature}},
+		{"future time tag", signedKey, string(timeTag(now.Add(time.Hour))), signature, [3]error{ErrInvalidKey, ErrInvalidTimeTag, ErrInvalidSignature}},
+		{"time tag not in UTC", signedKey, `<time datetime="2026-10-16T10:00:00+02:00">`, signature, [3]error{ErrInvalidKey, ErrInvalidTimeTag, ErrInvalidSignature}},
+		{"unparseable date", signedKey, `<time datetime="2026-13-16T10:00:00Z">`, signature, [3]error{ErrInvalidKey, ErrInvalidTimeTag, ErrInvalidSignature}},
+		{"tampered body", signedKey, body + " ", signature, [3]error{ErrInvalidKey, nil, ErrInvalidSignature}},
+		{"short signature", signedKey, body, signature[:32], [3]error{ErrInvalidKey, nil, ErrInvalidSignature}},
+		{"no signature", signedKey, body, nil, [3]error{ErrInvalidKey, nil, ErrInvalidSignature}},
+	}
+	for _, test := range tests {
+		results := CheckBoard(test.key, []byte(test.body), test.signature, now)
+		if len(results) != 3 {
+			t.Fatalf("%s: got %d results, want 3", test.name, len(results))
+		}
+		for i, result := range results {
+			if test.want[i] == nil && result.Err != nil || test.want[i] != nil && !errors.Is(result.Err, test.want[i]) {
+				t.Errorf("%s: %s check got %v, want %v", test.name, result.Check, result.Err, test.want[i])
+			}
+		}
+		// ValidateBoard fails with the first failing check's error.
+		err := ValidateBoard(test.key, []byte(test.body), test.signature, now)
+		for i, result := range results {
+			if result.Err != nil {
+				if !errors.Is(err, test.want[i]) {
+					t.Errorf("%s: ValidateBoard got %v, want %v", test.name, err, test.want[i])
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestTimeTagFormats(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	want := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	for _, datetime := range []string{
+		"2026-10-16T10:00:00Z",
+		"2026-10-16T10:00:00.000Z",
+		"2026-10-16T10:00:00.5Z",
+		"2026-10-16T10:00:00+00:00",
+		"2026-10-16T10:00:00.000+00:00",
+	} {
+		modified, err := validateBoardBody([]byte(`<time datetime="`+datetime+`"></time><p>hi</p>`), now)
+		if err != nil {
+			t.Errorf("%s was rejected: %s", datetime, err)
+		} else if !modified.Equal(want) || modified.Location() != time.UTC {
+			t.Errorf("%s was read as %s, want %s", datetime, modified, want)
+		}
+	}
+
+	for _, datetime := range []string{
+		"2026-10-16T12:00:00+02:00",
+		"2026-10-16T08:00:00-02:00",
+		"2026-10-16T10:00:00",
+	} {
+		if _, err := validateBoardBody([]byte(`<time datetime="`+datetime+`"></time><p>hi</p>`), now); !errors.Is(err, ErrInvalidTimeTag) {
+			t.Errorf("%s got %v, want ErrInvalidTimeTag", datetime, err)
+		}
+	}
+}
+
+func TestDuplicateTimeTagsAreRejected(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	earlier := string(timeTag(now.Add(-time.Hour)))
+	later := string(timeTag(now.Add(-time.Minute)))
+	for _, body := range []string{
+		earlier + "<p>hi</p>" + later,
+		later + "<p>hi</p>" + earlier,
+		earlier + earlier + "<p>hi</p>",
+	} {
+		if _, err := validateBoardBody([]byte(body), now); !errors.Is(err, ErrInvalidTimeTag) {
+			t.Errorf("Body %q got %v, want ErrInvalidTimeTag", body, err)
+		}
+	}
+
+	server := newTestServer(t, ServerConfig{})
+	board := testBoard(testKey(1), time.Now().Add(-time.Minute), "<p>hi</p>"+string(timeTag(time.Now().Add(-time.Hour))))
+	if w := put(server, board); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "exactly one") {
+		t.Errorf("PUT with two time tags got %d %q, want 400", w.Code, w.Body.String())
+	}
+
+	// Clients appending to a board replace its tag rather than adding one.
+	_, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appended := append(stripTimeTag([]byte(earlier+"<p>hi</p>")), "<p>more</p>"...)
+	prepared, err := PrepareBoard(appended, privkey, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified, err := validateBoardBody(prepared.Bytes(), now)
+	if err != nil || !modified.Equal(now) {
+		t.Errorf("Appended board is dated %s (%v), want its new time %s", modified, err, now)
+	}
+}
+
+func TestKeyAcceptanceWindow(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	key := func(mmyy string) string { return fmt.Sprintf("%057x83e%s", 1, mmyy) }
+	const month = 30 * 24 * time.Hour
+
+	for _, test := range []struct {
+		name    string
+		key     string
+		now     time.Time
+		horizon time.Duration
+		want    error
+	}{
+		{"expiring this month", key("0624"), at("2024-06-15T12:00:00Z"), DefaultMaxExpiryHorizon, nil},
+		{"expiring next month", key("0724"), at("2024-06-15T12:00:00Z"), DefaultMaxExpiryHorizon, nil},
+		{"expired last month", key("0524"), at("2024-06-15T12:00:00Z"), DefaultMaxExpiryHorizon, ErrKeyExpired},
+		{"last moment before expiry", key("0624"), at("2024-07-01T00:00:00Z"), DefaultMaxExpiryHorizon, nil},
+		{"first moment after expiry", key("0624"), at("2024-07-01T00:00:01Z"), DefaultMaxExpiryHorizon, ErrKeyExpired},
+		{"two years out, the widest window", key("0626"), at("2024-06-01T00:00:00Z"), DefaultMaxExpiryHorizon, nil},
+		{"just over two years out", key("0726"), at("2024-06-30T23:59:59Z"), DefaultMaxExpiryHorizon, ErrInvalidKey},
+		{"first day of a two year window", key("0726"), at("2024-07-01T00:00:00Z"), DefaultMaxExpiryHorizon, nil},
+		{"inside a one month horizon", key("0724"), at("2024-06-15T12:00:00Z"), month, nil},
+		{"beyond a one month horizon", key("0824"), at("2024-06-15T12:00:00Z"), month, ErrInvalidKey},
+	} {
+		if err := validateKeyWithin(test.key, test.now, test.horizon); !errors.Is(err, test.want) {
+			t.Errorf("Key %s, %s, got %v, want %v", test.name, test.key[57:], err, test.want)
+		}
+	}
+}
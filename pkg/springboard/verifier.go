@@ -0,0 +1,62 @@
+package springboard
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+)
+
+// SignatureScheme names an algorithm boards are signed with. Spring '83 only
+// uses ed25519 today.
+type SignatureScheme string
+
+// SchemeEd25519 is the ed25519 signatures Spring '83 specifies.
+const SchemeEd25519 SignatureScheme = "ed25519"
+
+// DefaultSignatureScheme is the scheme used when none is configured.
+const DefaultSignatureScheme = SchemeEd25519
+
+// Verifier checks board signatures for one signature scheme.
+type Verifier interface {
+	// Verify returns an ErrInvalidKey error if key (hex encoded) isn't a
+	// valid public key, and an ErrInvalidSignature error if signature isn't
+	// its signature of body.
+	Verify(key string, body []byte, signature []byte) error
+}
+
+// Ed25519Verifier verifies ed25519 signatures.
+type Ed25519Verifier struct{}
+
+// Verify implements Verifier
+func (Ed25519Verifier) Verify(key string, body []byte, signature []byte) error {
+	decodedKey, err := hex.DecodeString(key)
+	if err != nil || len(decodedKey) != ed25519.PublicKeySize {
+		return invalid(ErrInvalidKey, "Invalid key")
+	}
+	if len(signature) != ed25519.SignatureSize || !ed25519.Verify(decodedKey, body, signature) {
+		return invalid(ErrInvalidSignature, "Invalid signature")
+	}
+	return nil
+}
+
+var verifiers = map[SignatureScheme]Verifier{
+	SchemeEd25519: Ed25519Verifier{},
+}
+
+// VerifierFor returns the verifier for a signature scheme, or
+// DefaultSignatureScheme's if scheme is empty.
+func VerifierFor(scheme SignatureScheme) (Verifier, error) {
+	if scheme == "" {
+		scheme = DefaultSignatureScheme
+	}
+	verifier, found := verifiers[scheme]
+	if !found {
+		return nil, fmt.Errorf("Unsupported signature scheme %q", scheme)
+	}
+	return verifier, nil
+}
+
+// verifyBoardSignature checks a signature with DefaultSignatureScheme.
+func verifyBoardSignature(key string, body []byte, signature []byte) error {
+	return verifiers[DefaultSignatureScheme].Verify(key, body, signature)
+}
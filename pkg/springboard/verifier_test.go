@@ -0,0 +1,71 @@
+package springboard
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// inlineVerify is the check publishBoard made before verifiers: decode the
+// key and call ed25519.Verify.
+func inlineVerify(key string, body []byte, signature []byte) bool {
+	decodedKey, err := hex.DecodeString(key)
+	if err != nil || len(decodedKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(decodedKey, body, signature)
+}
+
+func TestEd25519VerifierMatchesInlineCheck(t *testing.T) {
+	pubkey, privkey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := hex.EncodeToString(pubkey)
+	body := []byte(`<time datetime="2022-06-01T10:00:00Z"></time>hello`)
+	signature := ed25519.Sign(privkey, body)
+
+	for _, test := range []struct {
+		name      string
+		key       string
+		body      []byte
+		signature []byte
+		wantErr   error
+	}{
+		{"valid", key, body, signature, nil},
+		{"changed body", key, append(body, '!'), signature, ErrInvalidSignature},
+		{"another key", hex.EncodeToString(otherKey), body, signature, ErrInvalidSignature},
+		{"truncated signature", key, body, signature[:len(signature)-1], ErrInvalidSignature},
+		{"no signature", key, body, nil, ErrInvalidSignature},
+		{"key not hex", "not a key", body, signature, ErrInvalidKey},
+		{"short key", key[:62], body, signature, ErrInvalidKey},
+	} {
+		err := Ed25519Verifier{}.Verify(test.key, test.body, test.signature)
+		if (err == nil) != inlineVerify(test.key, test.body, test.signature) {
+			t.Errorf("%s: verifier got %v, but the inline check disagrees", test.name, err)
+		}
+		if test.wantErr == nil && err != nil || test.wantErr != nil && !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestVerifierFor(t *testing.T) {
+	for _, scheme := range []SignatureScheme{"", SchemeEd25519} {
+		verifier, err := VerifierFor(scheme)
+		if err != nil {
+			t.Errorf("Scheme %q got %s", scheme, err)
+		} else if _, ok := verifier.(Ed25519Verifier); !ok {
+			t.Errorf("Scheme %q got %T, want Ed25519Verifier", scheme, verifier)
+		}
+	}
+	if _, err := VerifierFor("rsa"); err == nil {
+		t.Errorf("An unknown scheme got a verifier")
+	}
+}
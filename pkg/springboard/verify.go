@@ -0,0 +1,47 @@
+package springboard
+
+import (
+	"encoding/hex"
+	"log"
+	"time"
+)
+
+// DefaultReverifyBatchSize is how many boards are re-verified each
+// ReverifyInterval when no batch size is configured.
+const DefaultReverifyBatchSize = 100
+
+func (s *Spring83Server) periodicallyReverifyBoards(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if _, _, err := s.reverifyBoards(time.Now()); err != nil {
+			log.Printf("Could not re-verify boards: %s", err)
+		}
+	}
+}
+
+// reverifyBoards checks the signatures of the boards verified longest ago,
+// in case they were corrupted in storage, and quarantines those that no
+// longer verify so they aren't served.
+func (s *Spring83Server) reverifyBoards(now time.Time) (verified int, quarantined int, err error) {
+	boards, err := s.repo.GetBoardsToVerify(s.reverifyBatchSize)
+	if err != nil {
+		return
+	}
+	for _, board := range boards {
+		valid := true
+		signature, err := hex.DecodeString(board.Signature)
+		if err != nil || s.verifier.Verify(board.Key, board.Bytes(), signature) != nil {
+			valid = false
+		}
+		if err = s.repo.RecordVerification(board, now, valid); err != nil {
+			return verified, quarantined, err
+		}
+		if valid {
+			verified++
+		} else {
+			log.Printf("Board for %s no longer matches its signature; quarantined it", board.Key)
+			quarantined++
+		}
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package springboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReverifyQuarantinesCorruptedBoards(t *testing.T) {
+	repo := newTestSqliteRepo(t)
+	server := newTestServerWithRepo(repo, ServerConfig{})
+	now := time.Now()
+	intact := testBoard(testKey(1), now.Add(-time.Minute), "<p>intact</p>")
+	corrupted := testBoard(testKey(2), now, "<p>corrupted</p>")
+	mustPublish(t, repo, intact)
+	mustPublish(t, repo, corrupted)
+	if _, err := repo.conn.Exec(`UPDATE boards SET board=? WHERE key=?`, "<p>c0rrupted</p>", corrupted.Key); err != nil {
+		t.Fatal(err)
+	}
+
+	verified, quarantined, err := server.reverifyBoards(now)
+	if err != nil || verified != 1 || quarantined != 1 {
+		t.Fatalf("Re-verifying got %d verified and %d quarantined (%v), want 1 and 1", verified, quarantined, err)
+	}
+
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "/"+corrupted.Key, nil)); w.Code != http.StatusNotFound {
+		t.Errorf("Quarantined board got %d, want 404", w.Code)
+	}
+	if w := serve(server, httptest.NewRequest(http.MethodGet, "/"+intact.Key, nil)); w.Code != http.StatusOK {
+		t.Errorf("Intact board got %d, want 200", w.Code)
+	}
+	if keys := renderedKeys(t, server, "/"); len(keys) != 1 || keys[0] != intact.Key {
+		t.Errorf("Index shows %v, want only the intact board", keys)
+	}
+
+	var status serverStatus
+	if err := json.Unmarshal(serve(server, httptest.NewRequest(http.MethodGet, "/status", nil)).Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.VerifiedBoards != 1 || status.QuarantinedBoards != 1 {
+		t.Errorf("Status reports %d verified and %d quarantined, want 1 and 1", status.VerifiedBoards, status.QuarantinedBoards)
+	}
+
+	// The next pass skips the quarantined board.
+	if verified, quarantined, err := server.reverifyBoards(now); err != nil || verified != 1 || quarantined != 0 {
+		t.Errorf("Second pass got %d verified and %d quarantined (%v), want 1 and 0", verified, quarantined, err)
+	}
+}
@@ -0,0 +1,92 @@
+package springboard
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// viewDebounceWindow is how long repeat views of a board from the same
+// address are ignored.
+const viewDebounceWindow = 30 * time.Minute
+
+// viewDebouncer remembers which (address, key) pairs have recently viewed a
+// board so a reader reloading the page doesn't inflate its count. Addresses
+// are never stored: entries are keyed by a hash salted with a random value
+// that only lives as long as the process.
+type viewDebouncer struct {
+	mutex    sync.Mutex
+	salt     []byte
+	lastSeen map[[sha256.Size]byte]time.Time
+	// seenOrder lists views oldest first, so entries leaving the window are
+	// found without scanning lastSeen.
+	seenOrder []seenView
+}
+
+type seenView struct {
+	id [sha256.Size]byte
+	at time.Time
+}
+
+func newViewDebouncer() *viewDebouncer {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return &viewDebouncer{
+		salt:     salt,
+		lastSeen: map[[sha256.Size]byte]time.Time{},
+	}
+}
+
+// ShouldCount reports whether a view of key from r should be counted, and
+// records it if so.
+func (debouncer *viewDebouncer) ShouldCount(r *http.Request, key string, now time.Time) bool {
+	hash := sha256.New()
+	hash.Write(debouncer.salt)
+	hash.Write([]byte(remoteHost(r)))
+	hash.Write([]byte(key))
+	var id [sha256.Size]byte
+	copy(id[:], hash.Sum(nil))
+
+	debouncer.mutex.Lock()
+	defer debouncer.mutex.Unlock()
+	debouncer.forgetOldViews(now)
+	if lastSeen, seen := debouncer.lastSeen[id]; seen && now.Sub(lastSeen) < viewDebounceWindow {
+		return false
+	}
+	debouncer.lastSeen[id] = now
+	debouncer.seenOrder = append(debouncer.seenOrder, seenView{id, now})
+	return true
+}
+
+// forgetOldViews drops the entries that have left the debounce window. Only
+// those are visited, so counting a view stays cheap however many are kept.
+func (debouncer *viewDebouncer) forgetOldViews(now time.Time) {
+	expired := 0
+	for _, view := range debouncer.seenOrder {
+		if now.Sub(view.at) < viewDebounceWindow {
+			break
+		}
+		// The pair may have been seen again since, in a later entry.
+		if debouncer.lastSeen[view.id].Equal(view.at) {
+			delete(debouncer.lastSeen, view.id)
+		}
+		expired++
+	}
+	debouncer.seenOrder = debouncer.seenOrder[expired:]
+}
+
+// deleteViews runs query to delete the view counts of deleted boards, so
+// they don't outlive the boards or carry over to a board published later
+// under the same key.
+func deleteViews(db dbtx, query string, args ...any) error {
+	if _, err := db.Exec(query, args...); err != nil {
+		return errors.Wrap(err, "Could not delete view counts")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package springboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestViewsCountGetsOncePerAddress(t *testing.T) {
+	server := newTestServer(t, ServerConfig{CountViews: true})
+	board := testBoard(testKey(1), time.Now().Add(-time.Minute), "<p>hello</p>")
+	mustPublish(t, server.repo, board)
+	view := func(method string, address string) {
+		r := httptest.NewRequest(method, "/"+board.Key, nil)
+		r.RemoteAddr = address
+		if w := serve(server, r); w.Code != http.StatusOK {
+			t.Fatalf("%s got %d", method, w.Code)
+		}
+	}
+	views := func() int {
+		counts, err := server.repo.GetViewCounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return counts[board.Key]
+	}
+
+	view(http.MethodHead, "192.0.2.1:1234")
+	if got := views(); got != 0 {
+		t.Errorf("HEAD counted a view: %d", got)
+	}
+	view(http.MethodGet, "192.0.2.1:1234")
+	view(http.MethodGet, "192.0.2.1:5678")
+	if got := views(); got != 1 {
+		t.Errorf("Two GETs from one address counted %d views, want 1", got)
+	}
+	view(http.MethodGet, "192.0.2.2:1234")
+	if got := views(); got != 2 {
+		t.Errorf("A GET from another address made %d views, want 2", got)
+	}
+}
+
+func TestViewDebouncerForgetsViewsOutsideTheWindow(t *testing.T) {
+	debouncer := newViewDebouncer()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	now := time.Now()
+	if !debouncer.ShouldCount(r, "a", now) || !debouncer.ShouldCount(r, "b", now.Add(time.Minute)) {
+		t.Fatal("First views weren't counted")
+	}
+	if debouncer.ShouldCount(r, "a", now.Add(viewDebounceWindow-time.Second)) {
+		t.Error("A repeat view inside the window was counted")
+	}
+	if !debouncer.ShouldCount(r, "a", now.Add(viewDebounceWindow)) {
+		t.Error("A repeat view after the window wasn't counted")
+	}
+	// Only b's view, and a's second one, are still remembered.
+	if len(debouncer.lastSeen) != 2 || len(debouncer.seenOrder) != 2 {
+		t.Errorf("Remembering %d views in %d entries, want 2", len(debouncer.lastSeen), len(debouncer.seenOrder))
+	}
+}
@@ -0,0 +1,120 @@
+package springboard
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// DefaultWatchDebounce is how long WatchBoard waits for a file to stop
+// changing before reposting it. Editors often write a file in several steps.
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+// boardReposter signs and posts a board file, making sure each post is newer
+// than the last one.
+type boardReposter struct {
+	client       Client
+	path         string
+	privkey      ed25519.PrivateKey
+	lastModified time.Time
+	post         func(boardText []byte, modified time.Time) error
+}
+
+// WatchBoard posts the board in path, then reposts a freshly signed copy each
+// time the file changes, until the watch fails. Failed posts are reported on
+// standard error and don't stop the watch.
+func (client Client) WatchBoard(path string, keyFolder string, debounce time.Duration) (err error) {
+	_, privkey, err := GetKeys(keyFolder)
+	if err != nil {
+		return
+	}
+	reposter := &boardReposter{
+		client:  client,
+		path:    path,
+		privkey: privkey,
+	}
+	reposter.post = reposter.signAndPost
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return
+	}
+	defer watcher.Close()
+	// Watch the directory rather than the file, since many editors save by
+	// replacing the file, which would end a watch on the file itself.
+	if err = watcher.Add(filepath.Dir(path)); err != nil {
+		return errors.Wrapf(err, "Could not watch %s", path)
+	}
+
+	reposter.repost()
+	return reposter.watch(watcher.Events, watcher.Errors, debounce)
+}
+
+// watch reposts the board once events for its file have stopped arriving for
+// debounce.
+func (r *boardReposter) watch(events <-chan fsnotify.Event, watchErrors <-chan error, debounce time.Duration) error {
+	target := filepath.Clean(r.path)
+	var settled <-chan time.Time
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != target || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			settled = time.After(debounce)
+		case err, ok := <-watchErrors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-settled:
+			settled = nil
+			r.repost()
+		}
+	}
+}
+
+func (r *boardReposter) repost() {
+	boardText, err := ioutil.ReadFile(r.path)
+	if err == nil {
+		err = r.postNewer(boardText, time.Now())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not repost %s: %s\n", r.path, err)
+	}
+}
+
+// postNewer posts boardText with a timestamp after the last one we posted. If
+// the server still has newer content (e.g. posted from another machine
+// without backdating), it retries once without the backdating buffer.
+func (r *boardReposter) postNewer(boardText []byte, now time.Time) error {
+	modified := now.Add(-r.client.TimeBuffer).UTC().Truncate(time.Second)
+	if !modified.After(r.lastModified) {
+		modified = r.lastModified.Add(time.Second)
+	}
+	err := r.post(boardText, modified)
+	if errors.Is(err, ErrOldContent) {
+		bumped := now.UTC().Truncate(time.Second)
+		if bumped.After(modified) {
+			modified = bumped
+			err = r.post(boardText, modified)
+		}
+	}
+	if err == nil {
+		r.lastModified = modified
+	}
+	return err
+}
+
+func (r *boardReposter) signAndPost(boardText []byte, modified time.Time) error {
+	return r.client.signAndPostBoard(boardText, r.privkey, modified)
+}
@@ -0,0 +1,81 @@
+package springboard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatchRepostsChangedBoard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "board.html")
+	if err := os.WriteFile(path, []byte("<p>edited</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	posts := make(chan string, 10)
+	reposter := &boardReposter{
+		path: path,
+		post: func(boardText []byte, modified time.Time) error {
+			posts <- string(boardText)
+			return nil
+		},
+	}
+
+	events := make(chan fsnotify.Event)
+	done := make(chan error)
+	go func() { done <- reposter.watch(events, make(chan error), 10*time.Millisecond) }()
+
+	// Several writes in a row, and changes to other files, repost once.
+	events <- fsnotify.Event{Name: path, Op: fsnotify.Write}
+	events <- fsnotify.Event{Name: path, Op: fsnotify.Write}
+	events <- fsnotify.Event{Name: filepath.Join(filepath.Dir(path), "other.html"), Op: fsnotify.Write}
+	select {
+	case posted := <-posts:
+		if posted != "<p>edited</p>" {
+			t.Errorf("Reposted %q, want the file's content", posted)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Changing the file didn't repost it")
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(events)
+	if err := <-done; err != nil {
+		t.Errorf("Watch failed: %s", err)
+	}
+	if len(posts) != 0 {
+		t.Errorf("Reposted %d more times, want once per burst of changes", len(posts))
+	}
+}
+
+func TestWatchBumpsTimestampOnOldContent(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	var posted []time.Time
+	serverHas := now.Add(-time.Second)
+	reposter := &boardReposter{
+		client: Client{TimeBuffer: time.Minute},
+		post: func(boardText []byte, modified time.Time) error {
+			posted = append(posted, modified)
+			if !modified.After(serverHas) {
+				return invalid(ErrOldContent, "Old content")
+			}
+			return nil
+		},
+	}
+
+	if err := reposter.postNewer([]byte("hello"), now); err != nil {
+		t.Fatalf("Repost failed: %s", err)
+	}
+	if len(posted) != 2 || !posted[0].Equal(now.Add(-time.Minute)) || !posted[1].Equal(now) {
+		t.Errorf("Posted at %v, want the backdated time and then now", posted)
+	}
+
+	// The next repost is newer than the last, even within the same second.
+	if err := reposter.postNewer([]byte("hello again"), now); err != nil {
+		t.Fatalf("Second repost failed: %s", err)
+	}
+	if last := posted[len(posted)-1]; !last.After(now) {
+		t.Errorf("Second repost was dated %s, not after the first", last)
+	}
+}
@@ -0,0 +1,132 @@
+package springboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WebhookEvent is what happened to a board when webhooks are called.
+type WebhookEvent string
+
+const (
+	// WebhookPublished means a board was published on this server.
+	WebhookPublished WebhookEvent = "published"
+	// WebhookPropagated means a federate accepted a board relayed to it.
+	WebhookPropagated WebhookEvent = "propagated"
+)
+
+// WebhookPayload is the JSON body POSTed to each webhook.
+type WebhookPayload struct {
+	Event    WebhookEvent `json:"event"`
+	Key      string       `json:"key"`
+	Modified time.Time    `json:"modified"`
+	// Server is the FQDN of the server calling the webhook.
+	Server string `json:"server"`
+	// Destination is the federate a propagated board was relayed to.
+	Destination string `json:"destination,omitempty"`
+}
+
+const (
+	// webhookQueueSize is how many calls may wait to be made. Events
+	// beyond it are dropped rather than slowing down requests.
+	webhookQueueSize = 100
+	// webhookTimeout bounds each call to a webhook.
+	webhookTimeout = 10 * time.Second
+	// webhookAttempts is how many times a failing call is made.
+	webhookAttempts = 3
+)
+
+// validateWebhooks checks that each webhook is an absolute http or https URL.
+func validateWebhooks(webhooks []string) error {
+	for _, webhook := range webhooks {
+		parsed, err := url.Parse(webhook)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("webhooks entry %q must be an absolute http:// or https:// URL", webhook)
+		}
+	}
+	return nil
+}
+
+type webhookCall struct {
+	url  string
+	body []byte
+}
+
+// webhookNotifier calls webhooks one at a time in the background, so slow or
+// failing webhooks never hold up the requests that trigger them.
+type webhookNotifier struct {
+	calls     chan webhookCall
+	client    *http.Client
+	retryWait time.Duration
+	start     sync.Once
+}
+
+func newWebhookNotifier() *webhookNotifier {
+	return &webhookNotifier{
+		calls:     make(chan webhookCall, webhookQueueSize),
+		client:    &http.Client{Timeout: webhookTimeout},
+		retryWait: 5 * time.Second,
+	}
+}
+
+// Notify queues a call with payload to each of webhooks.
+func (notifier *webhookNotifier) Notify(webhooks []string, payload WebhookPayload) {
+	if len(webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Could not encode webhook payload: %s", err)
+		return
+	}
+	notifier.start.Do(func() { go notifier.run() })
+	for _, webhook := range webhooks {
+		select {
+		case notifier.calls <- webhookCall{webhook, body}:
+		default:
+			log.Printf("Webhook queue is full; dropping the %s event for %s", payload.Event, payload.Key)
+		}
+	}
+}
+
+func (notifier *webhookNotifier) run() {
+	for call := range notifier.calls {
+		notifier.call(call)
+	}
+}
+
+// call POSTs to a webhook, trying again after a wait that grows with each
+// failed attempt.
+func (notifier *webhookNotifier) call(call webhookCall) {
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		resp, err := notifier.client.Post(call.url, "application/json", bytes.NewReader(call.body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return
+			}
+			err = fmt.Errorf("status %s", resp.Status)
+		}
+		log.Printf("Webhook %s failed (attempt %d of %d): %s", call.url, attempt, webhookAttempts, err)
+		if attempt < webhookAttempts {
+			time.Sleep(time.Duration(attempt) * notifier.retryWait)
+		}
+	}
+}
+
+// notifyWebhooks tells the configured webhooks that event happened to board.
+func (s *Spring83Server) notifyWebhooks(event WebhookEvent, board Board, destination string) {
+	s.webhooks.Notify(s.settings().webhooks, WebhookPayload{
+		Event:       event,
+		Key:         board.Key,
+		Modified:    board.Modified,
+		Server:      s.fqdn,
+		Destination: destination,
+	})
+}
@@ -0,0 +1,55 @@
+package springboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookIsCalledOnPublish(t *testing.T) {
+	var calls int64
+	payloads := make(chan WebhookPayload, 1)
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first call, so the payload only arrives on a retry.
+		if atomic.AddInt64(&calls, 1) == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		var payload WebhookPayload
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Webhook got %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Webhook payload doesn't decode: %s", err)
+		}
+		payloads <- payload
+	}))
+	t.Cleanup(stub.Close)
+
+	server := newTestServer(t, ServerConfig{FQDN: "board.example", Webhooks: []string{stub.URL}})
+	server.webhooks.retryWait = time.Millisecond
+	board := testBoard(testKey(1), time.Now().Truncate(time.Second), "<p>hello</p>")
+	if w := put(server, board); w.Code != http.StatusOK {
+		t.Fatalf("PUT got %d: %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case payload := <-payloads:
+		if payload.Event != WebhookPublished || payload.Key != board.Key || !payload.Modified.Equal(board.Modified) || payload.Server != "board.example" {
+			t.Errorf("Webhook got %+v, want a published event for %s", payload, board.Key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Webhook wasn't called")
+	}
+}
+
+func TestWebhooksMustBeHTTPURLs(t *testing.T) {
+	for _, webhook := range []string{"ftp://hooks.example/", "/relative", "https://"} {
+		if _, err := newReloadableSettings(ServerConfig{Webhooks: []string{webhook}}); err == nil {
+			t.Errorf("Webhook %q was accepted", webhook)
+		}
+	}
+}